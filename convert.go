@@ -0,0 +1,130 @@
+// Copyright 2016 Nika Jones. All rights reserved.
+// Use of this source code is governed by the MIT license.
+// license that can be found in the LICENSE file.
+
+package particle
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"strconv"
+)
+
+// Convert decodes the frontmatter metadata of src with the from encoding and
+// returns it encoded with the to encoding, before the unchanged content of
+// src. If src has no frontmatter (or an empty one), just the content is
+// returned.
+//
+// The metadata goes through a map[string]interface{}, so the conversion is
+// only as good as the formats allow, and it can be lossy:
+//
+//   - YAML dates and times are decoded as strings, so they become TOML
+//     strings, not TOML datetimes.
+//   - TOML datetimes are decoded as time.Time, so they become RFC 3339
+//     strings in YAML and JSON.
+//   - JSON numbers are decoded as float64, so whole numbers become floats in
+//     TOML (i.e. 3 becomes 3.0).
+//   - Map keys come out in sorted order, and comments are dropped.
+//
+// Formats that can't hold a value return an error from encoding, i.e. TOML
+// has no null and doesn't allow arrays of mixed types.
+func Convert(from, to *Encoding, src []byte) ([]byte, error) {
+	v := make(map[string]interface{})
+	content, err := from.DecodeReader(bytes.NewReader(src), &v)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(v) == 0 {
+		return content, nil
+	}
+	return to.AppendEncode(nil, content, stringMaps(v))
+}
+
+// stringMaps returns v with every nested map converted to a
+// map[string]interface{}, so formats that need string keys (i.e. JSON) can
+// encode the maps that YAML decodes.
+func stringMaps(v interface{}) interface{} {
+	if m, ok := stringMap(v); ok {
+		sm := make(map[string]interface{}, len(m))
+		for k, v := range m {
+			sm[k] = stringMaps(v)
+		}
+		return sm
+	}
+
+	if s, ok := v.([]interface{}); ok {
+		ss := make([]interface{}, len(s))
+		for i, v := range s {
+			ss[i] = stringMaps(v)
+		}
+		return ss
+	}
+	return v
+}
+
+// DecodeToJSON decodes the frontmatter metadata of src with e, and returns it
+// as a JSON object along with the bytes of src without the frontmatter, so
+// the metadata of any format can be read the same way. The object is
+// compact, with sorted keys, and is "{}" when src has no metadata.
+//
+// Numbers are normalized, as the formats decode them to different Go types:
+//
+//   - Integers (YAML int, uint64 and TOML int64) are written as they are,
+//     without losing precision.
+//   - Floats are written in their shortest form, so a whole float such as
+//     the TOML 3.0 is written as 3, the same as the integer.
+//   - JSON input numbers are decoded as float64, so integers above 2^53
+//     lose precision before they are written.
+//   - Infinities and NaN, which YAML and TOML allow but JSON doesn't, are
+//     written as the strings "+Inf", "-Inf" and "NaN".
+//
+// TOML datetimes are written as RFC 3339 strings.
+func (e *Encoding) DecodeToJSON(src []byte, opts ...DecodeOption) (metaJSON []byte, content []byte, err error) {
+	v := make(map[string]interface{})
+	if content, err = e.DecodeReader(bytes.NewReader(src), &v, opts...); err != nil {
+		return nil, content, err
+	}
+
+	metaJSON, err = json.Marshal(jsonValue(v))
+	if err != nil {
+		return nil, content, err
+	}
+	return metaJSON, content, nil
+}
+
+// jsonValue returns v with every nested map converted to a
+// map[string]interface{}, the same as stringMaps, and with the floats that
+// JSON can't hold converted to strings.
+func jsonValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case float32:
+		return jsonFloat(float64(v))
+	case float64:
+		return jsonFloat(v)
+	case []interface{}:
+		s := make([]interface{}, len(v))
+		for i, v := range v {
+			s[i] = jsonValue(v)
+		}
+		return s
+	}
+
+	if m, ok := stringMap(v); ok {
+		sm := make(map[string]interface{}, len(m))
+		for k, v := range m {
+			sm[k] = jsonValue(v)
+		}
+		return sm
+	}
+	return v
+}
+
+// jsonFloat returns f, or its string when it is an infinity or NaN.
+func jsonFloat(f float64) interface{} {
+	if math.IsInf(f, 0) || math.IsNaN(f) {
+		return strconv.FormatFloat(f, 'g', -1, 64)
+	}
+	return f
+}
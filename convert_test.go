@@ -0,0 +1,96 @@
+package particle
+
+import (
+	"testing"
+)
+
+func TestConvert(t *testing.T) {
+	var runner = []struct {
+		Name     string
+		From, To *Encoding
+		File     string
+		Want     string
+	}{
+		{
+			"YAMLToTOML", YAMLEncoding, TOMLEncoding,
+			"---\ntitle: example\ntags: [a, b]\nauthor:\n  name: John Doe\n---\n\n" + wantContent,
+			"+++\ntags = [\"a\", \"b\"]\ntitle = \"example\"\n\n[author]\n  name = \"John Doe\"\n+++\n\n" + wantContent,
+		},
+		{
+			"YAMLToJSON", YAMLEncoding, JSONEncoding,
+			"---\ntitle: example\nauthor:\n  name: John Doe\n---\n\n" + wantContent,
+			"{\n\t\"author\": {\n\t\t\"name\": \"John Doe\"\n\t},\n\t\"title\": \"example\"\n}\n\n" + wantContent,
+		},
+		{
+			"JSONToYAML", JSONEncoding, YAMLEncoding,
+			"{\n\"title\": \"example\",\n\"count\": 3\n}\n\n" + wantContent,
+			"---\ncount: 3\ntitle: example\n---\n\n" + wantContent,
+		},
+		{
+			"TOMLToYAML", TOMLEncoding, YAMLEncoding,
+			"+++\ntitle = \"example\"\ndate = 2016-10-10T00:00:00Z\n+++\n\n" + wantContent,
+			"---\ndate: 2016-10-10T00:00:00Z\ntitle: example\n---\n\n" + wantContent,
+		},
+		{
+			"None", YAMLEncoding, TOMLEncoding,
+			wantContent,
+			wantContent,
+		},
+	}
+
+	for _, r := range runner {
+		have, err := Convert(r.From, r.To, []byte(r.File))
+		if err != nil {
+			t.Errorf(r.Name+": err: %s", err)
+		}
+
+		if r.Want != string(have) {
+			t.Errorf(r.Name+": \nwant: %q \nhave: %q", r.Want, string(have))
+		}
+	}
+}
+
+func TestDecodeToJSON(t *testing.T) {
+	var runner = []struct {
+		Name     string
+		Encoding *Encoding
+		File     string
+		Want     string
+	}{
+		{
+			"YAML", YAMLEncoding,
+			"---\ntitle: example\ncount: 3\nratio: 3.0\nbig: 9007199254740993\nlimit: .inf\nauthor:\n  name: John Doe\n---\n\n" + wantContent,
+			`{"author":{"name":"John Doe"},"big":9007199254740993,"count":3,"limit":"+Inf","ratio":3,"title":"example"}`,
+		},
+		{
+			"TOML", TOMLEncoding,
+			"+++\ntitle = \"example\"\ncount = 3\nratio = 3.0\nbig = 9007199254740993\ndate = 2016-10-10T00:00:00Z\n\n[author]\nname = \"John Doe\"\n+++\n\n" + wantContent,
+			`{"author":{"name":"John Doe"},"big":9007199254740993,"count":3,"date":"2016-10-10T00:00:00Z","ratio":3,"title":"example"}`,
+		},
+		{
+			"JSON", JSONEncoding,
+			"{\n\"title\": \"example\",\n\"count\": 3,\n\"ratio\": 3.5,\n\"author\": {\"name\": \"John Doe\"}\n}\n\n" + wantContent,
+			`{"author":{"name":"John Doe"},"count":3,"ratio":3.5,"title":"example"}`,
+		},
+		{
+			"None", YAMLEncoding,
+			wantContent,
+			`{}`,
+		},
+	}
+
+	for _, r := range runner {
+		haveJSON, haveContent, err := r.Encoding.DecodeToJSON([]byte(r.File))
+		if err != nil {
+			t.Errorf(r.Name+": err: %s", err)
+		}
+
+		if r.Want != string(haveJSON) {
+			t.Errorf(r.Name+": \nwant: %s \nhave: %s", r.Want, string(haveJSON))
+		}
+
+		if wantContent != string(haveContent) {
+			t.Errorf(r.Name+": \nwant: %q \nhave: %q", wantContent, string(haveContent))
+		}
+	}
+}
@@ -4,6 +4,9 @@ import (
 	"bytes"
 	"fmt"
 	"strings"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/structpb"
 )
 
 func ExampleNewDecoder() {
@@ -96,3 +99,68 @@ func ExampleEncoding_EncodeToString() {
 	// output: content: 7b 0a 09 22 4e 61 6d 65 22 3a 20 22 41 20 45 6e 63 6f 64 65 54 6f 53 74 72 69 6e 67 20 45 78 61 6d 70 6c 65 22 0a 7d 0a 0a 43 6f 6e 74 65 6e 74 2e 2e 2e
 
 }
+
+// protoMarshal and protoUnmarshal marshal protobuf messages, either ones
+// generated by protoc or the well known types such as structpb.Struct. Maps
+// are marshaled deterministically, so the same message has the same bytes.
+func protoMarshal(v interface{}) ([]byte, error) {
+	m, ok := v.(proto.Message)
+	if !ok {
+		return nil, fmt.Errorf("%T is not a proto.Message", v)
+	}
+	return proto.MarshalOptions{Deterministic: true}.Marshal(m)
+}
+
+func protoUnmarshal(b []byte, v interface{}) error {
+	m, ok := v.(proto.Message)
+	if !ok {
+		return fmt.Errorf("%T is not a proto.Message", v)
+	}
+	return proto.Unmarshal(b, m)
+}
+
+func ExampleLengthPrefixedDelimiter() {
+
+	// Setup the encoding for protobuf messages...
+	protoEncoding, err := NewEncoding(
+		WithName("proto"),
+		WithDelimiter("PB"),
+		WithSplitFunc(LengthPrefixedDelimiter),
+		WithMarshalFunc(protoMarshal),
+		WithUnmarshalFunc(protoUnmarshal),
+	)
+	if err != nil {
+		// handle errors here
+		fmt.Println(err)
+	}
+
+	// Setup the message...
+	post, err := structpb.NewStruct(map[string]interface{}{"title": "A Protobuf Example", "views": 300})
+	if err != nil {
+		// handle errors here
+		fmt.Println(err)
+	}
+
+	// Do the encoding...
+	src, err := protoEncoding.AppendEncode(nil, []byte("Content..."), post)
+	if err != nil {
+		// handle errors here
+		fmt.Println(err)
+	}
+
+	// Do the decoding...
+	v := &structpb.Struct{}
+	content, err := protoEncoding.DecodeString(string(src), v)
+	if err != nil {
+		// handle errors here
+		fmt.Println(err)
+	}
+
+	fmt.Printf("frame: % x\ntitle: %s\nviews: %v\ncontent: %s", src[:6], v.Fields["title"].GetStringValue(), v.Fields["views"].GetNumberValue(), content)
+
+	// Output:
+	// frame: 50 42 00 00 00 33
+	// title: A Protobuf Example
+	// views: 300
+	// content: Content...
+}
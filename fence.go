@@ -0,0 +1,81 @@
+// Copyright 2016 Nika Jones. All rights reserved.
+// Use of this source code is governed by the MIT license.
+// license that can be found in the LICENSE file.
+
+package particle
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+)
+
+// NewMultiFenceEncoding returns an Encoding that decodes files that use any
+// of encodings, picked by the opening delimiter of each file, so a single
+// Encoding reads a mix of i.e. "---" YAML and "+++" TOML files. The first
+// encoding whose opening delimiter starts the input (after a byte order
+// mark) decodes it, with all of its options, and the first encoding decodes
+// an input that none of them match. Encoding writes with the first encoding.
+//
+// Only the start of the input is looked at, so the encodings must use the
+// HeaderPosition, and preamble lines before the opening delimiter aren't
+// skipped. Options given to Clone, or as DecodeOptions, apply to all of the
+// encodings. It panics if no encodings are given.
+func NewMultiFenceEncoding(encodings ...*Encoding) *Encoding {
+	if len(encodings) == 0 {
+		panic("particle: NewMultiFenceEncoding needs at least one encoding")
+	}
+
+	e := encodings[0].Clone()
+	e.fences = append([]*Encoding(nil), encodings...)
+	return e
+}
+
+// fenceFor returns the encoding of e that decodes the input that starts with
+// b, or e itself when it isn't a multi fence encoding.
+func (e *Encoding) fenceFor(b []byte) *Encoding {
+	if e.fences == nil {
+		return e
+	}
+
+	b = bytes.TrimPrefix(b, utf8BOM)
+	for _, f := range e.fences {
+		if f.position == HeaderPosition && !f.wholeDocument && bytes.HasPrefix(b, []byte(f.start)) {
+			return f
+		}
+	}
+	return e.fences[0]
+}
+
+// fencePeekLen returns the number of bytes at the start of an input that
+// fenceFor needs to pick an encoding.
+func (e *Encoding) fencePeekLen() int {
+	n := 0
+	for _, f := range e.fences {
+		if len(f.start) > n {
+			n = len(f.start)
+		}
+	}
+	return len(utf8BOM) + n
+}
+
+// fenceReader returns the encoding of e that decodes r, as fenceFor, and a
+// reader that should be used in place of r. A *bufio.Reader is peeked in
+// place.
+func (e *Encoding) fenceReader(r io.Reader) (*Encoding, io.Reader) {
+	if e.fences == nil {
+		return e, r
+	}
+
+	if br, ok := r.(*bufio.Reader); ok {
+		p, _ := br.Peek(e.fencePeekLen())
+		return e.fenceFor(p), br
+	}
+
+	p := make([]byte, e.fencePeekLen())
+	n, err := io.ReadFull(r, p)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return e.fences[0], io.MultiReader(bytes.NewReader(p[:n]), errReader{err})
+	}
+	return e.fenceFor(p[:n]), io.MultiReader(bytes.NewReader(p[:n]), r)
+}
@@ -0,0 +1,86 @@
+package particle
+
+import (
+	"bytes"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+func TestMultiFenceEncoding(t *testing.T) {
+	e := NewMultiFenceEncoding(YAMLEncoding, TOMLEncoding, JSONEncoding)
+
+	var runner = []struct {
+		Name        string
+		File        string
+		WantContent string
+		WantTitle   string
+	}{
+		{"YAML", testCaseData["YAML"]["file"], wantContent, "example YAML"},
+		{"TOML", testCaseData["TOML"]["file"], wantContent, "example TOML"},
+		{"JSON", testCaseData["JSON"]["file"], wantContent, "example JSON"},
+		{"None", wantContent, wantContent, ""},
+	}
+
+	for _, r := range runner {
+		decoders := []struct {
+			Name   string
+			Decode func(v *testMetaData) ([]byte, error)
+		}{
+			{"DecodeString", func(v *testMetaData) ([]byte, error) { return e.DecodeString(r.File, v) }},
+			{"DecodeReader", func(v *testMetaData) ([]byte, error) {
+				return e.DecodeReader(iotest.OneByteReader(strings.NewReader(r.File)), v)
+			}},
+			{"Metadata", func(v *testMetaData) ([]byte, error) {
+				if err := e.Metadata([]byte(r.File), v); err != nil {
+					return nil, err
+				}
+				return e.StripFrontmatter([]byte(r.File))
+			}},
+			{"StreamDecoder", func(v *testMetaData) ([]byte, error) {
+				d := e.NewStreamDecoder(strings.NewReader(r.File))
+				b, err := ioutil.ReadAll(d)
+				if err != nil {
+					return nil, err
+				}
+				return b, d.Decode(v)
+			}},
+			{"DecodeReaderAt", func(v *testMetaData) ([]byte, error) {
+				offset, err := e.DecodeReaderAt(strings.NewReader(r.File), 16, v)
+				return []byte(r.File[offset:]), err
+			}},
+			{"DecodeString(opts)", func(v *testMetaData) ([]byte, error) { return e.DecodeString(r.File, v, WithTrimSpace()) }},
+		}
+
+		for _, d := range decoders {
+			var haveMetaData testMetaData
+			haveContent, err := d.Decode(&haveMetaData)
+			if err != nil {
+				t.Errorf(r.Name+"("+d.Name+"): err: %s", err)
+			}
+
+			wantContent := r.WantContent
+			if strings.Contains(d.Name, "opts") {
+				wantContent = strings.TrimSpace(wantContent)
+			}
+			if wantContent != string(haveContent) {
+				t.Errorf(r.Name+"("+d.Name+"): \nwant: %q \nhave: %q", wantContent, string(haveContent))
+			}
+
+			if r.WantTitle != haveMetaData.Title {
+				t.Errorf(r.Name+"("+d.Name+"): \nwant: %q \nhave: %q", r.WantTitle, haveMetaData.Title)
+			}
+		}
+	}
+
+	have, err := e.AppendEncode(nil, []byte(wantContent), map[string]string{"title": "example"})
+	if want := "---\ntitle: example\n---\n\n" + wantContent; err != nil || want != string(have) {
+		t.Errorf("(AppendEncode): \nwant: %q \nhave: %q %v", want, string(have), err)
+	}
+
+	matter, _, err := e.DecodeRaw([]byte(testCaseData["TOML"]["file"]))
+	if err != nil || !bytes.HasPrefix(matter, []byte("Name = ")) {
+		t.Errorf("(DecodeRaw): want the TOML metadata have: %q %v", matter, err)
+	}
+}
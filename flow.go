@@ -0,0 +1,121 @@
+// Copyright 2016 Nika Jones. All rights reserved.
+// Use of this source code is governed by the MIT license.
+// license that can be found in the LICENSE file.
+
+package particle
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// WithYAMLFlowStyle writes the nested maps and sequences of the metadata in
+// the YAML flow style (i.e. "tags: [a, b]"). The top level keys are still
+// written one to a line.
+//
+// A value is only written in the flow style when its line fits in width
+// bytes; a width of zero or less has no limit. It is only for YAML
+// encodings.
+func WithYAMLFlowStyle(width int) EncodingOptionFunc {
+	return func(e *Encoding) error {
+		if err := e.onlyYAML("WithYAMLFlowStyle"); err != nil {
+			return err
+		}
+
+		marshal := e.marshalFunc
+		e.marshalFunc = func(v interface{}) ([]byte, error) {
+			b, err := marshal(v)
+			if err != nil {
+				return nil, err
+			}
+			return yamlFlow(b, width), nil
+		}
+		return nil
+	}
+}
+
+// yamlFlow rewrites the values of the top level keys of the YAML document b
+// that are maps or sequences in the flow style, when they fit in width. The
+// other lines of b are kept as they are. A document that isn't a map is
+// returned as is.
+func yamlFlow(b []byte, width int) []byte {
+	var items yaml.MapSlice
+	if err := yaml.Unmarshal(b, &items); err != nil {
+		return b
+	}
+
+	// each top level key starts a chunk of lines at the first column, the
+	// lines of its value are indented, or are "- " entries of a sequence
+	var chunks []string
+	for _, line := range strings.SplitAfter(string(b), "\n") {
+		if line == "" {
+			continue
+		}
+		if len(chunks) > 0 && yamlContinued(line) {
+			chunks[len(chunks)-1] += line
+			continue
+		}
+		chunks = append(chunks, line)
+	}
+	if len(chunks) != len(items) {
+		return b // i.e. a comment from another marshal func
+	}
+
+	out := new(bytes.Buffer)
+	for i, item := range items {
+		switch item.Value.(type) {
+		case yaml.MapSlice, []interface{}:
+			line := yamlFlowScalar(item.Key) + ": " + yamlFlowValue(item.Value)
+			if width <= 0 || len(line) <= width {
+				out.WriteString(line + "\n")
+				continue
+			}
+		}
+		out.WriteString(chunks[i])
+	}
+	return out.Bytes()
+}
+
+// yamlContinued reports if line continues the value of the top level key of
+// the lines before it.
+func yamlContinued(line string) bool {
+	return strings.HasPrefix(line, " ") || line == "\n" ||
+		strings.HasPrefix(line, "- ") || line == "-\n"
+}
+
+// yamlFlowValue returns v, a value unmarshaled to a yaml.MapSlice, in the YAML
+// flow style.
+func yamlFlowValue(v interface{}) string {
+	var vals []string
+	switch v := v.(type) {
+	case yaml.MapSlice:
+		for _, item := range v {
+			vals = append(vals, yamlFlowScalar(item.Key)+": "+yamlFlowValue(item.Value))
+		}
+		return "{" + strings.Join(vals, ", ") + "}"
+	case []interface{}:
+		for _, val := range v {
+			vals = append(vals, yamlFlowValue(val))
+		}
+		return "[" + strings.Join(vals, ", ") + "]"
+	}
+	return yamlFlowScalar(v)
+}
+
+// yamlFlowScalar returns the scalar v as yaml.v2 writes it, or as a double
+// quoted string when that can't be used in a flow value (i.e. a block scalar,
+// or a plain string with a ",").
+func yamlFlowScalar(v interface{}) string {
+	b, _ := yaml.Marshal(v) // an unmarshaled scalar always marshals
+	s := strings.TrimSuffix(string(b), "\n")
+	if str, ok := v.(string); ok {
+		plain := s != "" && s[0] != '"' && s[0] != '\''
+		if strings.Contains(s, "\n") || plain && strings.ContainsAny(s, ",[]{}") {
+			return strconv.Quote(str)
+		}
+	}
+	return s
+}
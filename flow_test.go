@@ -0,0 +1,60 @@
+package particle
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestYAMLFlowStyle(t *testing.T) {
+	v := map[string]interface{}{
+		"author": map[string]interface{}{"name": "John Doe", "id": 1},
+		"tags":   []interface{}{"a, b", "c", map[string]interface{}{"d": []interface{}{1, 2}}},
+		"body":   "line one\nline two\n",
+		"title":  "yes",
+		"empty":  []interface{}{},
+	}
+
+	var runner = []struct {
+		Name  string
+		Width int
+		Want  string
+	}{
+		{"All", 0, "---\nauthor: {id: 1, name: John Doe}\nbody: |\n  line one\n  line two\nempty: []\ntags: [\"a, b\", c, {d: [1, 2]}]\ntitle: \"yes\"\n---\n\n"},
+		{"Width", 30, "---\nauthor:\n  id: 1\n  name: John Doe\nbody: |\n  line one\n  line two\nempty: []\ntags: [\"a, b\", c, {d: [1, 2]}]\ntitle: \"yes\"\n---\n\n"},
+	}
+
+	for _, r := range runner {
+		haveEnc := YAMLEncoding.Clone(WithYAMLFlowStyle(r.Width))
+		have, err := haveEnc.AppendEncode(nil, nil, v)
+		if err != nil {
+			t.Errorf(r.Name+": err: %s", err)
+		}
+
+		if r.Want != string(have) {
+			t.Errorf(r.Name+": \nwant: %q \nhave: %q", r.Want, string(have))
+		}
+
+		// the metadata is the same in the flow style
+		haveMap := make(map[string]interface{})
+		if _, err := haveEnc.DecodeString(string(have), &haveMap); err != nil {
+			t.Errorf(r.Name+": err: %s", err)
+		}
+
+		wantMap := make(map[string]interface{})
+		if _, err := YAMLEncoding.DecodeString(YAMLEncoding.EncodeToString(nil, v), &wantMap); err != nil {
+			t.Errorf(r.Name+": err: %s", err)
+		}
+
+		if !reflect.DeepEqual(wantMap, haveMap) {
+			t.Errorf(r.Name+": \nwant: %#v \nhave: %#v", wantMap, haveMap)
+		}
+	}
+
+	defer func() {
+		if want, have := `particle: WithYAMLFlowStyle is only for YAML encodings, not "toml"`, fmt.Sprint(recover()); want != have {
+			t.Errorf("TOML: \nwant: %s \nhave: %s", want, have)
+		}
+	}()
+	TOMLEncoding.Clone(WithYAMLFlowStyle(0))
+}
@@ -0,0 +1,87 @@
+package particle
+
+import (
+	"io/ioutil"
+	"runtime"
+	"strings"
+	"testing"
+	"testing/iotest"
+	"time"
+)
+
+func FuzzDecode(f *testing.F) {
+	for _, data := range testCaseData {
+		f.Add(data["file"])
+	}
+
+	f.Add("---")
+	f.Add("---\n")
+	f.Add("---\n---\n")
+	f.Add("---\nname: John Doe\n")
+	f.Add("---\nname: John Doe\n---")
+	f.Add("---\r\nname: John Doe\r\n---\r\n\r\nbody")
+	f.Add("\xef\xbb\xbf---\nname: John Doe\n---\n\nbody")
+	f.Add("+++\n+++x\n+++\n\n+++")
+	f.Add("{\n}\n")
+
+	f.Fuzz(func(t *testing.T, src string) {
+		for _, enc := range []*Encoding{YAMLEncoding, TOMLEncoding, JSONEncoding} {
+			content, err := enc.DecodeString(src, &map[string]interface{}{})
+			if err != nil {
+				continue
+			}
+
+			// the content is never changed, just split from the frontmatter
+			if !strings.HasSuffix(src, string(content)) {
+				t.Errorf("%s: the content is not the end of the input \nsrc: %q \ncontent: %q", enc.Name(), src, content)
+			}
+
+			// reading a byte at a time splits the same
+			r, err := enc.DecodeReader(iotest.OneByteReader(strings.NewReader(src)), &map[string]interface{}{})
+			if err != nil {
+				t.Errorf("%s(OneByteReader): err: %s", enc.Name(), err)
+			}
+
+			if string(content) != string(r) {
+				t.Errorf("%s(OneByteReader): \nwant: %q \nhave: %q", enc.Name(), content, r)
+			}
+
+			rs, err := enc.DecodeSeeker(strings.NewReader(src), &map[string]interface{}{})
+			if err != nil {
+				t.Errorf("%s(DecodeSeeker): err: %s", enc.Name(), err)
+				continue
+			}
+
+			if have, _ := ioutil.ReadAll(rs); string(content) != string(have) {
+				t.Errorf("%s(DecodeSeeker): \nwant: %q \nhave: %q", enc.Name(), content, have)
+			}
+		}
+	})
+}
+
+func TestDecodeGoroutines(t *testing.T) {
+	var files = []string{
+		"---\nname: [John, Doe\n---\n\n" + wantContent, // invalid metadata
+		"---\nname: John Doe\n",                        // never closed
+		"---\nname: John Doe\n---",                     // closed at the end
+		testCaseData["YAML"]["file"],
+	}
+
+	before := runtime.NumGoroutine()
+	for i := 0; i < 100; i++ {
+		for _, file := range files {
+			YAMLEncoding.Decode(make([]byte, 4), []byte(file), &testMetaData{}) // shorter than the content
+			YAMLEncoding.DecodeString(file, &testMetaData{})
+			YAMLEncoding.DecodeReader(iotest.OneByteReader(strings.NewReader(file)), &testMetaData{})
+		}
+	}
+
+	// the split goroutines may take a moment to finish
+	for i := 0; i < 100 && runtime.NumGoroutine() > before; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if have := runtime.NumGoroutine(); have > before {
+		t.Errorf("want: %d goroutines have: %d", before, have)
+	}
+}
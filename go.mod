@@ -0,0 +1,12 @@
+module github.com/njones/particle
+
+go 1.20
+
+require (
+	github.com/BurntSushi/toml v0.3.0
+	github.com/vmihailenco/msgpack/v5 v5.4.1
+	google.golang.org/protobuf v1.34.2
+	gopkg.in/yaml.v2 v2.4.0
+)
+
+require github.com/vmihailenco/tagparser/v2 v2.0.0 // indirect
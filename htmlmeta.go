@@ -0,0 +1,236 @@
+// Copyright 2016 Nika Jones. All rights reserved.
+// Use of this source code is governed by the MIT license.
+// license that can be found in the LICENSE file.
+
+package particle
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// htmlMetaTag is the struct tag that names the meta tag of a field for
+// HTMLMetaEncoding.
+const htmlMetaTag = "meta"
+
+// htmlPreamble reports if line is a line that may come before the <head> of
+// an HTML document: a blank line, or a line of nothing but doctype, <html>
+// and comment tags (i.e. "<!DOCTYPE html><html lang="en">").
+func htmlPreamble(line string) bool {
+	s := strings.ToLower(strings.TrimSpace(line))
+	for s != "" {
+		end := ">"
+		switch {
+		case strings.HasPrefix(s, "<!--"):
+			end = "-->"
+		case strings.HasPrefix(s, "<!doctype"), htmlTag(s, "<html"):
+		default:
+			return false
+		}
+
+		i := strings.Index(s, end)
+		if i < 0 {
+			return false
+		}
+		s = strings.TrimSpace(s[i+len(end):])
+	}
+	return true
+}
+
+// htmlDelimiter returns the <head> or </head> tag that line stands for, and
+// the preamble before a <head> tag on the same line (i.e. "<html>" of
+// "<html><head>"). The tags are matched without regard to case, and a <head>
+// tag may have attributes (i.e. <head lang="en">). Any other line is returned
+// as it is.
+func htmlDelimiter(line string) (pre, delim string) {
+	s := strings.TrimRight(line, " \t")
+	lower := strings.ToLower(s)
+	if lower == "</head>" {
+		return "", "</head>"
+	}
+
+	i := strings.Index(lower, "<head")
+	if i < 0 || !htmlTag(lower[i:], "<head") || strings.IndexByte(lower[i:], '>') != len(lower)-i-1 || !htmlPreamble(s[:i]) {
+		return "", line
+	}
+	return s[:i], "<head>"
+}
+
+// htmlTag reports if s starts with the tag name (i.e. "<html"), followed by
+// the end of the tag or its attributes.
+func htmlTag(s, name string) bool {
+	return strings.HasPrefix(s, name) && len(s) > len(name) && strings.ContainsRune(" \t\r\n>", rune(s[len(name)]))
+}
+
+// htmlMetaMarshal marshals the map or struct v to <meta name="..."
+// content="..."> tags, one on each line. Map keys are written in sorted
+// order, struct fields in the order they are declared, named by their meta
+// tag or else their lower cased name. Values are formatted with fmt.Sprint,
+// and empty values are skipped.
+func htmlMetaMarshal(v interface{}) ([]byte, error) {
+	rv := reflect.Indirect(reflect.ValueOf(v))
+
+	var names, contents []string
+	switch rv.Kind() {
+	case reflect.Map:
+		if rv.Type().Key().Kind() != reflect.String {
+			return nil, fmt.Errorf("htmlmeta: can't marshal %T", v)
+		}
+		for _, k := range rv.MapKeys() {
+			names = append(names, k.String())
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			contents = append(contents, fmt.Sprint(rv.MapIndex(reflect.ValueOf(name).Convert(rv.Type().Key()))))
+		}
+	case reflect.Struct:
+		for i := 0; i < rv.NumField(); i++ {
+			name, ok := fieldKey(rv.Type().Field(i), htmlMetaTag)
+			if !ok {
+				continue
+			}
+			names = append(names, name)
+			contents = append(contents, fmt.Sprint(rv.Field(i)))
+		}
+	default:
+		return nil, fmt.Errorf("htmlmeta: can't marshal %T", v)
+	}
+
+	buf := new(bytes.Buffer)
+	for i, name := range names {
+		if contents[i] == "" {
+			continue
+		}
+		fmt.Fprintf(buf, "<meta name=\"%s\" content=\"%s\">\n", html.EscapeString(name), html.EscapeString(contents[i]))
+	}
+	return buf.Bytes(), nil
+}
+
+// htmlMetaUnmarshal unmarshals the name and content of the <meta> tags in
+// data to v, a pointer to a map of strings (or interface{} values) or to a
+// struct. Struct fields are matched to the names without regard to case,
+// and only string fields can be set. Other tags and text are ignored, as
+// are <meta> tags without both a name and a content attribute.
+func htmlMetaUnmarshal(data []byte, v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return fmt.Errorf("htmlmeta: can't unmarshal to %T", v)
+	}
+	rv = rv.Elem()
+
+	var fields map[string]reflect.Value
+	switch {
+	case rv.Kind() == reflect.Map && rv.Type().Key().Kind() == reflect.String:
+		if rv.IsNil() {
+			rv.Set(reflect.MakeMap(rv.Type()))
+		}
+	case rv.Kind() == reflect.Struct:
+		fields = make(map[string]reflect.Value)
+		for i := 0; i < rv.NumField(); i++ {
+			if name, ok := fieldKey(rv.Type().Field(i), htmlMetaTag); ok {
+				fields[strings.ToLower(name)] = rv.Field(i)
+			}
+		}
+	default:
+		return fmt.Errorf("htmlmeta: can't unmarshal to %T", v)
+	}
+
+	for _, attrs := range htmlMetaTags(data) {
+		name, ok := attrs["name"]
+		content, ok2 := attrs["content"]
+		if !ok || !ok2 {
+			continue
+		}
+
+		if fields == nil {
+			val := reflect.ValueOf(content)
+			if !val.Type().AssignableTo(rv.Type().Elem()) {
+				return fmt.Errorf("htmlmeta: can't unmarshal %q to %s", name, rv.Type().Elem())
+			}
+			rv.SetMapIndex(reflect.ValueOf(name).Convert(rv.Type().Key()), val)
+			continue
+		}
+
+		field, ok := fields[strings.ToLower(name)]
+		if !ok {
+			continue
+		}
+		if field.Kind() != reflect.String {
+			return fmt.Errorf("htmlmeta: can't unmarshal %q to %s", name, field.Type())
+		}
+		field.SetString(content)
+	}
+	return nil
+}
+
+// htmlMetaTags returns the attributes of each <meta> tag in data, with the
+// attribute names lower cased and the values unescaped.
+func htmlMetaTags(data []byte) []map[string]string {
+	var tags []map[string]string
+
+	s := string(data)
+	for {
+		i := strings.Index(strings.ToLower(s), "<meta")
+		if i < 0 {
+			return tags
+		}
+		s = s[i+len("<meta"):]
+		if s == "" || !strings.ContainsRune(" \t\r\n/>", rune(s[0])) {
+			continue // i.e. <metadata>
+		}
+
+		attrs := make(map[string]string)
+		s = htmlAttrs(s, attrs)
+		tags = append(tags, attrs)
+	}
+}
+
+// htmlAttrs reads the attributes of a tag from s into attrs, and returns s
+// after the end of the tag.
+func htmlAttrs(s string, attrs map[string]string) string {
+	for {
+		s = strings.TrimLeft(s, " \t\r\n/")
+		if s == "" {
+			return s
+		}
+		if s[0] == '>' {
+			return s[1:]
+		}
+
+		i := strings.IndexAny(s, " \t\r\n/>=")
+		if i < 0 {
+			i = len(s)
+		}
+		name := strings.ToLower(s[:i])
+		s = strings.TrimLeft(s[i:], " \t\r\n")
+
+		if !strings.HasPrefix(s, "=") {
+			attrs[name] = ""
+			continue
+		}
+		s = strings.TrimLeft(s[1:], " \t\r\n")
+
+		var val string
+		switch {
+		case s == "":
+		case s[0] == '"' || s[0] == '\'':
+			j := strings.IndexByte(s[1:], s[0])
+			if j < 0 {
+				val, s = s[1:], ""
+			} else {
+				val, s = s[1:j+1], s[j+2:]
+			}
+		default:
+			j := strings.IndexAny(s, " \t\r\n>")
+			if j < 0 {
+				j = len(s)
+			}
+			val, s = s[:j], s[j:]
+		}
+		attrs[name] = html.UnescapeString(val)
+	}
+}
@@ -0,0 +1,113 @@
+package particle
+
+import (
+	"reflect"
+	"testing"
+)
+
+type testHTMLMetaData struct {
+	Description string
+	Author      string
+	OGTitle     string `meta:"og:title"`
+	Robots      string `meta:"-"`
+}
+
+func TestHTMLMetaEncoding(t *testing.T) {
+	page := `<!DOCTYPE html>
+<html lang="en">
+<head>
+  <meta charset="utf-8">
+  <title>Example</title>
+  <meta name="description" content="An &quot;example&quot; page">
+  <meta name='Author' content='John Doe' />
+  <meta name=og:title content=Example>
+  <meta name="robots" content="noindex">
+  <meta property="og:type" content="article">
+</head>
+<body>
+<p>This is an example page.</p>
+</body>
+</html>
+`
+	wantContent := "<!DOCTYPE html>\n<html lang=\"en\">\n<body>\n<p>This is an example page.</p>\n</body>\n</html>\n"
+	wantMetaData := testHTMLMetaData{Description: `An "example" page`, Author: "John Doe", OGTitle: "Example"}
+
+	var haveMetaData testHTMLMetaData
+	haveContent, err := HTMLMetaEncoding.DecodeString(page, &haveMetaData)
+	if err != nil {
+		t.Errorf("(DecodeString): err: %s", err)
+	}
+
+	if wantContent != string(haveContent) {
+		t.Errorf("(DecodeString): \nwant: %q \nhave: %q", wantContent, string(haveContent))
+	}
+
+	if !reflect.DeepEqual(wantMetaData, haveMetaData) {
+		t.Errorf("(DecodeString): \nwant: %+v \nhave: %+v", wantMetaData, haveMetaData)
+	}
+
+	haveMap := make(map[string]string)
+	if _, err := HTMLMetaEncoding.DecodeString(page, &haveMap); err != nil || haveMap["robots"] != "noindex" || len(haveMap) != 4 {
+		t.Errorf("(map): want the 4 name and content pairs have: %v %v", haveMap, err)
+	}
+
+	wantFile := "<!DOCTYPE html>\n<html lang=\"en\">\n<head>\n<meta name=\"description\" content=\"An &#34;example&#34; page\">\n<meta name=\"author\" content=\"John Doe\">\n<meta name=\"og:title\" content=\"Example\">\n</head>\n\n<body>\n<p>This is an example page.</p>\n</body>\n</html>\n"
+	haveFile, err := HTMLMetaEncoding.AppendEncode(nil, []byte(wantContent), wantMetaData)
+	if err != nil {
+		t.Errorf("(AppendEncode): err: %s", err)
+	}
+
+	if wantFile != string(haveFile) {
+		t.Errorf("(AppendEncode): \nwant: %q \nhave: %q", wantFile, string(haveFile))
+	}
+
+	haveMetaData = testHTMLMetaData{}
+	haveContent, err = HTMLMetaEncoding.DecodeString(string(haveFile), &haveMetaData)
+	if err != nil || wantContent != string(haveContent) || !reflect.DeepEqual(wantMetaData, haveMetaData) {
+		t.Errorf("(round trip): \nwant: %+v %q \nhave: %+v %q %v", wantMetaData, wantContent, haveMetaData, string(haveContent), err)
+	}
+}
+
+func TestHTMLMetaHead(t *testing.T) {
+	const meta = "<meta name=\"author\" content=\"John Doe\">\n"
+	const body = "<body>\n<p>This is an example page.</p>\n</body>\n</html>\n"
+
+	var runner = []struct {
+		Name        string
+		File        string
+		WantContent string
+		WantAuthor  string
+	}{
+		{"attributes", "<!DOCTYPE html>\n<html>\n<head lang=\"en\" class=\"x\">\n" + meta + "</head>\n" + body, "<!DOCTYPE html>\n<html>\n" + body, "John Doe"},
+		{"same line", "<!DOCTYPE html>\n<html lang=\"en\"><head>\n" + meta + "</head>\n" + body, "<!DOCTYPE html>\n<html lang=\"en\">" + body, "John Doe"},
+		{"upper case", "<!DOCTYPE html><HTML><HEAD>\n" + meta + "</HEAD>\n" + body, "<!DOCTYPE html><HTML>" + body, "John Doe"},
+		{"comment", "<!-- a page -->\n<html>\n<head>\n" + meta + "</head>\n" + body, "<!-- a page -->\n<html>\n" + body, "John Doe"},
+		{"header", "<!DOCTYPE html>\n<html>\n<header>\n" + meta + "</head>\n" + body, "<!DOCTYPE html>\n<html>\n<header>\n" + meta + "</head>\n" + body, ""},
+		{"text before", "<!DOCTYPE html>\n<p>x</p><head>\n" + meta + "</head>\n" + body, "<!DOCTYPE html>\n<p>x</p><head>\n" + meta + "</head>\n" + body, ""},
+	}
+
+	for _, r := range runner {
+		have := testHTMLMetaData{}
+		haveContent, err := HTMLMetaEncoding.DecodeString(r.File, &have)
+		if err != nil {
+			t.Errorf(r.Name+"(DecodeString): err: %s", err)
+		}
+
+		if r.WantContent != string(haveContent) {
+			t.Errorf(r.Name+"(DecodeString): \nwant: %q \nhave: %q", r.WantContent, string(haveContent))
+		}
+
+		if r.WantAuthor != have.Author {
+			t.Errorf(r.Name+"(DecodeString): \nwant: %q \nhave: %q", r.WantAuthor, have.Author)
+		}
+
+		haveContent, err = HTMLMetaEncoding.StripFrontmatter([]byte(r.File))
+		if err != nil {
+			t.Errorf(r.Name+"(StripFrontmatter): err: %s", err)
+		}
+
+		if r.WantContent != string(haveContent) {
+			t.Errorf(r.Name+"(StripFrontmatter): \nwant: %q \nhave: %q", r.WantContent, string(haveContent))
+		}
+	}
+}
@@ -0,0 +1,170 @@
+// Copyright 2016 Nika Jones. All rights reserved.
+// Use of this source code is governed by the MIT license.
+// license that can be found in the LICENSE file.
+
+package particle
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// DefaultIncludeKey is the metadata key that names the files to include when
+// an include resolver is set with WithIncludeResolver.
+const DefaultIncludeKey = "include"
+
+// ErrIncludeCycle is returned (wrapped with the chain of paths) when an
+// included file includes itself, directly or through other files.
+var ErrIncludeCycle = errors.New("particle: include cycle")
+
+// WithIncludeResolver loads the files named by the include key (see
+// WithIncludeKey) of the frontmatter metadata with fn when decoding. The
+// value of the key is a path, or a list of paths. Each file holds bare
+// metadata in the format of the encoding (i.e. the YAML of a _defaults.yml
+// file, without delimiters), and may include other files. The metadata of the
+// files is merged under the metadata that includes them, so the keys of the
+// including metadata win, and the include key is dropped.
+func WithIncludeResolver(fn func(path string) ([]byte, error)) EncodingOptionFunc {
+	return func(e *Encoding) error {
+		e.includeFunc = fn
+		return nil
+	}
+}
+
+// WithIncludeKey sets the metadata key that names the files to include,
+// DefaultIncludeKey is used if it isn't set. It has no effect without
+// WithIncludeResolver.
+func WithIncludeKey(key string) EncodingOptionFunc {
+	return func(e *Encoding) error {
+		e.includeKey = key
+		return nil
+	}
+}
+
+// includedMatter is the frontmatter metadata that was last resolved by
+// resolveIncludes, with the result.
+type includedMatter struct {
+	f, resolved []byte
+	err         error
+}
+
+// resolveOnce returns a copy of e that keeps the last frontmatter metadata it
+// resolved, so a block that is probed by fence validation or lenient
+// fallback before it is unmarshaled has its includes resolved once. The copy
+// is for a single decode. e is returned when it doesn't probe or include.
+func (e *Encoding) resolveOnce() *Encoding {
+	if e.includeFunc == nil || e.included != nil || !(e.fenceValidation || e.lenientFallback) {
+		return e
+	}
+	c, _ := e.withOptions([]DecodeOption{func(c *Encoding) error {
+		c.included = new(includedMatter)
+		return nil
+	}}) // the option never fails
+	return c
+}
+
+// resolveIncludes returns the frontmatter metadata f with the metadata of the
+// files it includes merged into it. f is returned as is if it doesn't have
+// the include key.
+func (e *Encoding) resolveIncludes(f []byte) ([]byte, error) {
+	if in := e.included; in != nil && in.f != nil && bytes.Equal(in.f, f) {
+		return in.resolved, in.err
+	}
+
+	resolved, err := e.resolve(f)
+	if in := e.included; in != nil {
+		in.f, in.resolved, in.err = append([]byte(nil), f...), resolved, err
+	}
+	return resolved, err
+}
+
+// resolve does the work of resolveIncludes.
+func (e *Encoding) resolve(f []byte) ([]byte, error) {
+	m := make(map[string]interface{})
+	if err := e.unmarshalFunc(f, &m); err != nil {
+		return nil, err
+	}
+
+	if _, ok := m[e.includeKeyName()]; !ok {
+		return f, nil
+	}
+
+	m, err := e.include(m, nil)
+	if err != nil {
+		return nil, err
+	}
+	return e.marshalValue(m)
+}
+
+// include merges m over the metadata of the files that it includes, which
+// are resolved in order, so a later file wins over an earlier one. chain is
+// the list of paths that included m, to find cycles.
+func (e *Encoding) include(m map[string]interface{}, chain []string) (map[string]interface{}, error) {
+	key := e.includeKeyName()
+	paths, err := includePaths(m[key])
+	if err != nil {
+		return nil, err
+	}
+	delete(m, key)
+
+	base := make(map[string]interface{})
+	for _, path := range paths {
+		for _, p := range chain {
+			if p == path {
+				return nil, fmt.Errorf("%w: %s -> %s", ErrIncludeCycle, strings.Join(chain, " -> "), path)
+			}
+		}
+
+		b, err := e.includeFunc(path)
+		if err != nil {
+			return nil, fmt.Errorf("particle: include %q: %w", path, err)
+		}
+
+		if e.expandFunc != nil {
+			b = expandVars(b, e.expandFunc)
+		}
+
+		im := make(map[string]interface{})
+		if err := e.unmarshalFunc(b, &im); err != nil {
+			return nil, fmt.Errorf("particle: include %q: %w", path, err)
+		}
+
+		if im, err = e.include(im, append(chain[:len(chain):len(chain)], path)); err != nil {
+			return nil, err
+		}
+		base = mergeMaps(base, im)
+	}
+	return mergeMaps(base, m), nil
+}
+
+// includeKeyName returns the include key of e.
+func (e *Encoding) includeKeyName() string {
+	if e.includeKey == "" {
+		return DefaultIncludeKey
+	}
+	return e.includeKey
+}
+
+// includePaths returns the paths of the include key value v, which is a
+// string or a list of strings.
+func includePaths(v interface{}) ([]string, error) {
+	switch v := v.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		return []string{v}, nil
+	case []interface{}:
+		paths := make([]string, 0, len(v))
+		for _, p := range v {
+			s, ok := p.(string)
+			if !ok {
+				return nil, fmt.Errorf("particle: include path is a %T, not a string", p)
+			}
+			paths = append(paths, s)
+		}
+		return paths, nil
+	}
+	return nil, fmt.Errorf("particle: include path is a %T, not a string", v)
+}
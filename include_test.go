@@ -0,0 +1,90 @@
+package particle
+
+import (
+	"errors"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func testIncludeResolver(files map[string]string) func(string) ([]byte, error) {
+	return func(path string) ([]byte, error) {
+		f, ok := files[path]
+		if !ok {
+			return nil, os.ErrNotExist
+		}
+		return []byte(f), nil
+	}
+}
+
+func TestIncludeResolver(t *testing.T) {
+	files := map[string]string{
+		"_defaults.yml":  "include: _base.yml\ndate: 10-10-2016\ntitle: Defaults\n",
+		"_base.yml":      "name: Jane Doe\ntitle: Base\n",
+		"_cycle.yml":     "include: _loop.yml\n",
+		"_loop.yml":      "include: [_base.yml, _cycle.yml]\n",
+		"_defaults.toml": "include = \"_base.toml\"\ndate = \"10-10-2016\"\n",
+		"_base.toml":     "name = \"Jane Doe\"\ntitle = \"Base\"\n",
+		"_price.yml":     "title: $5 ${name}\n",
+	}
+
+	var runner = []struct {
+		Name         string
+		Encoding     *Encoding
+		File         string
+		WantMetaData testMetaData
+	}{
+		{"Chain", YAMLEncoding, "---\ninclude: _defaults.yml\nname: John Doe\n---\n\n" + wantContent, testMetaData{Name: "John Doe", Date: "10-10-2016", Title: "Defaults"}},
+		{"List", YAMLEncoding, "---\ninclude: [_defaults.yml, _base.yml]\n---\n\n" + wantContent, testMetaData{Name: "Jane Doe", Date: "10-10-2016", Title: "Base"}},
+		{"NoInclude", YAMLEncoding, "---\nname: John Doe\n---\n\n" + wantContent, testMetaData{Name: "John Doe"}},
+		{"Key", YAMLEncoding.Clone(WithIncludeKey("defaults")), "---\ndefaults: _base.yml\ntitle: example\n---\n\n" + wantContent, testMetaData{Name: "Jane Doe", Title: "example"}},
+		{"Expand", YAMLEncoding.Clone(WithExpander(strings.ToUpper)), "---\ninclude: _price.yml\n---\n\n" + wantContent, testMetaData{Title: "$5 NAME"}},
+		{"TOML", TOMLEncoding, "+++\ninclude = \"_defaults.toml\"\nname = \"John Doe\"\n+++\n\n" + wantContent, testMetaData{Name: "John Doe", Date: "10-10-2016", Title: "Base"}},
+	}
+
+	for _, r := range runner {
+		e := r.Encoding.Clone(WithIncludeResolver(testIncludeResolver(files)))
+
+		haveMetaData := testMetaData{}
+		haveContent, err := e.DecodeString(r.File, &haveMetaData)
+		if err != nil {
+			t.Errorf(r.Name+": err: %s", err)
+		}
+
+		if wantContent != string(haveContent) {
+			t.Errorf(r.Name+": \nwant: %q \nhave: %q", wantContent, string(haveContent))
+		}
+
+		if !reflect.DeepEqual(r.WantMetaData, haveMetaData) {
+			t.Errorf(r.Name+": \nwant: %+v \nhave: %+v", r.WantMetaData, haveMetaData)
+		}
+	}
+
+	e := YAMLEncoding.Clone(WithIncludeResolver(testIncludeResolver(files)))
+	if _, err := e.DecodeString("---\ninclude: _cycle.yml\n---\n\n"+wantContent, &testMetaData{}); !errors.Is(err, ErrIncludeCycle) {
+		t.Errorf("Cycle: want: %v have: %v", ErrIncludeCycle, err)
+	}
+
+	if _, err := e.DecodeString("---\ninclude: _missing.yml\n---\n\n"+wantContent, &testMetaData{}); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Missing: want: %v have: %v", os.ErrNotExist, err)
+	}
+
+	// the block is probed by fence validation and lenient fallback before
+	// it is unmarshaled, the include is still only loaded once
+	var loads int
+	e = YAMLEncoding.Clone(WithFenceValidation(), WithLenientFallback(), WithIncludeResolver(func(path string) ([]byte, error) {
+		loads++
+		return testIncludeResolver(files)(path)
+	}))
+
+	file := "---\ninclude: _base.yml\n---\n\n" + wantContent
+	if _, err := e.DecodeString(file, &testMetaData{}); err != nil || loads != 1 {
+		t.Errorf("Once(DecodeString): want: 1 load have: %d %v", loads, err)
+	}
+
+	loads = 0
+	if _, err := e.DecodeReaderAt(strings.NewReader(file), 8, &testMetaData{}); err != nil || loads != 1 {
+		t.Errorf("Once(DecodeReaderAt): want: 1 load have: %d %v", loads, err)
+	}
+}
@@ -0,0 +1,139 @@
+// Copyright 2016 Nika Jones. All rights reserved.
+// Use of this source code is governed by the MIT license.
+// license that can be found in the LICENSE file.
+
+package particle
+
+import (
+	"bytes"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// yamlBlockHeader matches a line that ends with the header of a literal or
+// folded block scalar, with its optional indentation indicator.
+var yamlBlockHeader = regexp.MustCompile(`(^|: |- )[|>]([1-9]?)[-+]?$`)
+
+// yamlIndent re-indents the YAML document b, written with the two space
+// indent of yaml.v2, to an indent of n spaces. Each two columns of nesting
+// (spaces, or a "- " sequence entry) become n columns. The text of block
+// scalars is kept as is, past the indent of the block.
+func yamlIndent(b []byte, n int) []byte {
+	var (
+		out     = new(bytes.Buffer)
+		inBlock bool
+		base    int // the indent of the text in a block scalar, -1 if not known yet
+	)
+
+	for i, line := range strings.Split(string(b), "\n") {
+		if i > 0 {
+			out.WriteByte('\n')
+		}
+
+		if inBlock {
+			lead := len(line) - len(strings.TrimLeft(line, " "))
+			switch {
+			case strings.TrimSpace(line) == "":
+				continue // a blank line in the block
+			case base < 0 || lead >= base:
+				if base < 0 {
+					base = lead
+				}
+				out.WriteString(strings.Repeat(" ", base/2*n) + line[base:])
+				continue
+			}
+			inBlock = false
+		}
+
+		j := 0
+		for ; j+2 <= len(line); j += 2 {
+			if line[j:j+2] == "  " {
+				out.WriteString(strings.Repeat(" ", n))
+			} else if line[j:j+2] == "- " {
+				out.WriteString("-" + strings.Repeat(" ", n-1))
+			} else {
+				break
+			}
+		}
+		rest := line[j:]
+
+		if m := yamlBlockHeader.FindStringSubmatchIndex(rest); m != nil {
+			inBlock, base = true, -1
+			if m[4] < m[5] {
+				d, _ := strconv.Atoi(rest[m[4]:m[5]])
+				spaces := len(line) - len(strings.TrimLeft(line, " "))
+				base = spaces + d
+				rest = rest[:m[4]] + strconv.Itoa(d/2*n) + rest[m[5]:]
+			}
+		}
+		out.WriteString(rest)
+	}
+	return out.Bytes()
+}
+
+// expandIndentTabs turns the tabs in the indentation of each line of b into
+// spaces, up to the next tab stop of width columns. In the text of a block
+// scalar only the indent of the block is turned into spaces, the tabs past
+// it are part of the text. b is returned as is when it has no tabs.
+func expandIndentTabs(b []byte, width int) []byte {
+	if bytes.IndexByte(b, '\t') < 0 {
+		return b
+	}
+
+	var (
+		out     = new(bytes.Buffer)
+		inBlock bool
+		parent  int // the indent of the line that starts a block scalar
+		base    int // the indent of the text in a block scalar, -1 if not known yet
+	)
+
+	for i, line := range strings.Split(string(b), "\n") {
+		if i > 0 {
+			out.WriteByte('\n')
+		}
+
+		indent, j := indentColumns(line, width, -1)
+		if inBlock {
+			switch {
+			case strings.TrimSpace(line) == "":
+				out.WriteString(line) // a blank line in the block
+				continue
+			case indent > parent:
+				if base < 0 {
+					base = indent
+				}
+				// only the indent of the block, the rest is text
+				col, k := indentColumns(line, width, base)
+				out.WriteString(strings.Repeat(" ", col) + line[k:])
+				continue
+			}
+			inBlock = false
+		}
+
+		rest := line[j:]
+		out.WriteString(strings.Repeat(" ", indent) + rest)
+
+		if yamlBlockHeader.MatchString(rest) {
+			inBlock, parent, base = true, indent, -1
+		}
+	}
+	return out.Bytes()
+}
+
+// indentColumns returns the number of columns of the leading spaces and tabs
+// of line, with tab stops of width columns, and the number of bytes they
+// take. When limit isn't negative, it stops once limit columns are reached.
+func indentColumns(line string, width, limit int) (col, n int) {
+	for ; n < len(line) && (line[n] == ' ' || line[n] == '\t'); n++ {
+		if limit >= 0 && col >= limit {
+			break
+		}
+		if line[n] == ' ' {
+			col++
+		} else {
+			col += width - col%width
+		}
+	}
+	return col, n
+}
@@ -0,0 +1,96 @@
+package particle
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"gopkg.in/yaml.v2"
+)
+
+func TestMarshalIndent(t *testing.T) {
+	v := map[string]interface{}{
+		"author": map[string]interface{}{
+			"name":  "John Doe",
+			"links": map[string]interface{}{"site": "example.com"},
+		},
+		"tags":  []interface{}{map[string]interface{}{"name": "a", "ids": []interface{}{1, 2}}, "b"},
+		"body":  "line one\n  indented\nline three\n",
+		"quote": "  starts with spaces\nend",
+	}
+
+	var runner = []struct {
+		Name   string
+		Indent int
+		Want   string
+	}{
+		{"Two", 2, "---\nauthor:\n  links:\n    site: example.com\n  name: John Doe\nbody: |\n  line one\n    indented\n  line three\nquote: |2-\n    starts with spaces\n  end\ntags:\n- ids:\n  - 1\n  - 2\n  name: a\n- b\n---\n\n"},
+		{"Four", 4, "---\nauthor:\n    links:\n        site: example.com\n    name: John Doe\nbody: |\n    line one\n      indented\n    line three\nquote: |4-\n      starts with spaces\n    end\ntags:\n-   ids:\n    -   1\n    -   2\n    name: a\n-   b\n---\n\n"},
+	}
+
+	for _, r := range runner {
+		haveEnc := YAMLEncoding.Clone(WithMarshalIndent(r.Indent))
+		have, err := haveEnc.AppendEncode(nil, nil, v)
+		if err != nil {
+			t.Errorf(r.Name+": err: %s", err)
+		}
+
+		if r.Want != string(have) {
+			t.Errorf(r.Name+": \nwant: %q \nhave: %q", r.Want, string(have))
+		}
+
+		// the metadata is the same after the indent is changed
+		haveMap := make(map[string]interface{})
+		if _, err := haveEnc.DecodeString(string(have), &haveMap); err != nil {
+			t.Errorf(r.Name+": err: %s", err)
+		}
+
+		want, _ := yaml.Marshal(v)
+		if have, _ := yaml.Marshal(haveMap); !reflect.DeepEqual(string(want), string(have)) {
+			t.Errorf(r.Name+": \nwant: %s \nhave: %s", want, have)
+		}
+	}
+
+	defer func() {
+		if want, have := `particle: WithMarshalIndent is only for YAML encodings, not "json"`, fmt.Sprint(recover()); want != have {
+			t.Errorf("JSON: \nwant: %s \nhave: %s", want, have)
+		}
+	}()
+	JSONEncoding.Clone(WithMarshalIndent(4))
+}
+
+func TestTabToSpaceConversion(t *testing.T) {
+	src := "---\ntitle:\tA\ttitle\nauthor:\n\tname: John Doe\n\tlinks:\n\t\tsite: example.com\n\tbio: |\n\t\tfirst\n\t\t\tsecond\ntags:\n  \t- a\nbody: |\n  first\n  \tsecond\n---\n\ncontent\twith tabs\n"
+
+	want := map[string]interface{}{
+		"title":  "A\ttitle",
+		"author": map[interface{}]interface{}{"name": "John Doe", "links": map[interface{}]interface{}{"site": "example.com"}, "bio": "first\n\tsecond\n"},
+		"tags":   []interface{}{"a"},
+		"body":   "first\n\tsecond",
+	}
+
+	if _, err := YAMLEncoding.DecodeString(src, &map[string]interface{}{}); err == nil {
+		t.Errorf("want: an error for tab indentation without the option")
+	}
+
+	have := make(map[string]interface{})
+	content, err := YAMLEncoding.Clone(WithTabToSpaceConversion(4)).DecodeString(src, &have)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if !reflect.DeepEqual(want, have) {
+		t.Errorf("\nwant: %#v \nhave: %#v", want, have)
+	}
+
+	if want := "content\twith tabs\n"; want != string(content) {
+		t.Errorf("\nwant: %q \nhave: %q", want, string(content))
+	}
+
+	defer func() {
+		if want, have := `particle: WithTabToSpaceConversion is only for YAML encodings, not "toml"`, fmt.Sprint(recover()); want != have {
+			t.Errorf("TOML: \nwant: %s \nhave: %s", want, have)
+		}
+	}()
+	TOMLEncoding.Clone(WithTabToSpaceConversion(4))
+}
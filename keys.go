@@ -0,0 +1,186 @@
+// Copyright 2016 Nika Jones. All rights reserved.
+// Use of this source code is governed by the MIT license.
+// license that can be found in the LICENSE file.
+
+package particle
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// foldKeys renames the top level keys of the frontmatter metadata f to the
+// keys of the struct fields of v that they match without regard to case, and
+// returns the metadata marshaled again. If v is not a pointer to a struct, f
+// is returned as is.
+func (e *Encoding) foldKeys(f []byte, v interface{}) ([]byte, error) {
+	keys := structKeys(v, e.tag())
+	if keys == nil {
+		return f, nil
+	}
+
+	m := make(map[string]interface{})
+	if err := e.unmarshalFunc(f, &m); err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(m))
+	for k := range m {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	folded := make(map[string]interface{}, len(m))
+	exact := make(map[string]bool)
+	for _, k := range names {
+		key, ok := keys[strings.ToLower(k)]
+		if !ok {
+			folded[k] = m[k] // keep keys that don't match a field
+			continue
+		}
+
+		if _, seen := folded[key]; (!seen || k == key) && !exact[key] {
+			folded[key], exact[key] = m[k], k == key
+		}
+	}
+
+	return e.marshalValue(folded)
+}
+
+// Fields returns the top level metadata keys that encoding v with e would
+// write, in sorted order. The keys are found by marshaling v and reading the
+// metadata back, so they follow the tags for the format, the key transform
+// of e and any omitempty options. The keys of nested maps and structs are not
+// included.
+func (e *Encoding) Fields(v interface{}) ([]string, error) {
+	f, err := e.marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	m := make(map[string]interface{})
+	if err := e.unmarshalFunc(f, &m); err != nil {
+		return nil, &FrontmatterError{Op: "decode", Format: e.name, Err: err}
+	}
+
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// structKeys returns the metadata keys of the fields of the struct that v
+// points to, keyed by their lower case. The key of a field is the name in its
+// tag, or else its lower cased name. It returns nil if v doesn't point to a
+// struct.
+func structKeys(v interface{}, tag string) map[string]string {
+	t := reflect.TypeOf(v)
+	if t == nil || t.Kind() != reflect.Ptr || t.Elem().Kind() != reflect.Struct {
+		return nil
+	}
+	t = t.Elem()
+
+	keys := make(map[string]string)
+	for i := 0; i < t.NumField(); i++ {
+		if key, ok := fieldKey(t.Field(i), tag); ok {
+			keys[strings.ToLower(key)] = key
+		}
+	}
+	return keys
+}
+
+// unmarshalKeys unmarshals the frontmatter metadata f to the map m with fn,
+// without renaming any keys. If fn leaves nested maps with keys that aren't
+// strings (as yaml.v2 does), f is read again with rawKeyValue, so the keys of
+// those maps are the text that was written.
+func (e *Encoding) unmarshalKeys(f []byte, m *map[string]interface{}, fn UnmarshalFunc) error {
+	if err := fn(f, m); err != nil {
+		return err
+	}
+
+	if !hasInterfaceKeys(*m) {
+		return nil
+	}
+
+	raw := make(map[string]*rawKeyValue)
+	if err := yaml.Unmarshal(f, &raw); err != nil {
+		return nil // not YAML, keep the maps fn made
+	}
+
+	for k, v := range raw {
+		(*m)[k] = v.value()
+	}
+	return nil
+}
+
+// hasInterfaceKeys reports whether v is, or holds, a map[interface{}]interface{}.
+func hasInterfaceKeys(v interface{}) bool {
+	switch v := v.(type) {
+	case map[interface{}]interface{}:
+		return true
+	case map[string]interface{}:
+		for _, v := range v {
+			if hasInterfaceKeys(v) {
+				return true
+			}
+		}
+	case []interface{}:
+		for _, v := range v {
+			if hasInterfaceKeys(v) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// rawKeyValue is a YAML value that decodes maps with string keys. yaml.v2
+// sets a string to the text of a scalar as it is written, even when the
+// scalar resolves to another type, so the keys are kept as written.
+type rawKeyValue struct {
+	v interface{}
+}
+
+func (r *rawKeyValue) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var m map[string]*rawKeyValue
+	if err := unmarshal(&m); err == nil && m != nil {
+		r.v = m
+		return nil
+	}
+
+	var s []*rawKeyValue
+	if err := unmarshal(&s); err == nil && s != nil {
+		r.v = s
+		return nil
+	}
+	return unmarshal(&r.v)
+}
+
+// value returns the value of r, with its maps and lists copied to
+// map[string]interface{} and []interface{} values.
+func (r *rawKeyValue) value() interface{} {
+	if r == nil {
+		return nil
+	}
+
+	switch v := r.v.(type) {
+	case map[string]*rawKeyValue:
+		m := make(map[string]interface{}, len(v))
+		for k, v := range v {
+			m[k] = v.value()
+		}
+		return m
+	case []*rawKeyValue:
+		s := make([]interface{}, len(v))
+		for i, v := range v {
+			s[i] = v.value()
+		}
+		return s
+	}
+	return r.v
+}
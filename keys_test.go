@@ -0,0 +1,114 @@
+package particle
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCaseInsensitiveKeys(t *testing.T) {
+	type metaData struct {
+		Title  string
+		Author string `yaml:"by" toml:"by" json:"by"`
+	}
+
+	var runner = []struct {
+		Name     string
+		Encoding *Encoding
+		File     string
+		Want     metaData
+	}{
+		{"YAML Title", YAMLEncoding, "---\nTitle: example\nBY: John Doe\n---\n\nbody", metaData{"example", "John Doe"}},
+		{"YAML title", YAMLEncoding, "---\ntitle: example\nBy: John Doe\n---\n\nbody", metaData{"example", "John Doe"}},
+		{"YAML TITLE", YAMLEncoding, "---\nTITLE: example\nby: John Doe\n---\n\nbody", metaData{"example", "John Doe"}},
+		{"YAML collision", YAMLEncoding, "---\nTITLE: upper\ntitle: exact\nTitle: mixed\n---\n\nbody", metaData{Title: "exact"}},
+		{"YAML collision no exact", YAMLEncoding, "---\nTitLe: mixed\nTITLE: upper\n---\n\nbody", metaData{Title: "upper"}},
+		{"TOML", TOMLEncoding, "+++\nTITLE = \"example\"\nBy = \"John Doe\"\n+++\n\nbody", metaData{"example", "John Doe"}},
+		{"JSON", JSONEncoding, "{\n\"TITLE\": \"example\",\n\"BY\": \"John Doe\"\n}\n\nbody", metaData{"example", "John Doe"}},
+	}
+
+	for _, r := range runner {
+		have := metaData{}
+		haveContent, err := r.Encoding.Clone(WithCaseInsensitiveKeys()).DecodeString(r.File, &have)
+		if err != nil {
+			t.Errorf(r.Name+": err: %s", err)
+		}
+
+		if string(haveContent) != "body" {
+			t.Errorf(r.Name+": want: %q have: %q", "body", string(haveContent))
+		}
+
+		if !reflect.DeepEqual(r.Want, have) {
+			t.Errorf(r.Name+": \nwant: %+v \nhave: %+v", r.Want, have)
+		}
+	}
+
+	// without the option YAML is case sensitive
+	have := metaData{}
+	YAMLEncoding.DecodeString("---\nTITLE: example\n---\n\nbody", &have)
+	if have.Title != "" {
+		t.Errorf("want: %q have: %q", "", have.Title)
+	}
+}
+
+func TestPreserveKeyCase(t *testing.T) {
+	var runner = []struct {
+		Name     string
+		Encoding *Encoding
+		File     string
+		Want     map[string]interface{}
+	}{
+		{"YAML", YAMLEncoding, "---\nTitle: upper\ntitle: lower\n---\n\nbody", map[string]interface{}{"Title": "upper", "title": "lower"}},
+		{"YAML nested", YAMLEncoding, "---\nTitle: upper\nparams:\n  On: true\n  yes: no\n  1: one\n  Title: upper\n  title: lower\nlist:\n- On: x\n---\n\nbody",
+			map[string]interface{}{"Title": "upper", "params": map[string]interface{}{"On": true, "yes": false, "1": "one", "Title": "upper", "title": "lower"}, "list": []interface{}{map[string]interface{}{"On": "x"}}}},
+		{"YAML transform", YAMLEncoding.Clone(WithKeyTransform(nil, strings.ToLower)), "---\nTitle: upper\ntitle: lower\n---\n\nbody", map[string]interface{}{"Title": "upper", "title": "lower"}},
+		{"TOML", TOMLEncoding, "+++\nTitle = \"upper\"\ntitle = \"lower\"\n[Params]\nOn = \"x\"\non = \"y\"\n+++\n\nbody", map[string]interface{}{"Title": "upper", "title": "lower", "Params": map[string]interface{}{"On": "x", "on": "y"}}},
+		{"JSON", JSONEncoding, "{\n\"Title\": \"upper\",\n\"title\": \"lower\"\n}\n\nbody", map[string]interface{}{"Title": "upper", "title": "lower"}},
+	}
+
+	for _, r := range runner {
+		have := make(map[string]interface{})
+		if _, err := r.Encoding.Clone(WithPreserveKeyCase()).DecodeString(r.File, &have); err != nil {
+			t.Errorf(r.Name+": err: %s", err)
+		}
+
+		if !reflect.DeepEqual(r.Want, have) {
+			t.Errorf(r.Name+": \nwant: %#v \nhave: %#v", r.Want, have)
+		}
+	}
+}
+
+func TestFields(t *testing.T) {
+	type metaData struct {
+		Title  string
+		Author string `yaml:"by" toml:"by" json:"by"`
+		Draft  bool   `yaml:",omitempty" toml:",omitempty" json:",omitempty"`
+		Params struct{ Layout string }
+		skip   string
+	}
+
+	var runner = []struct {
+		Name     string
+		Encoding *Encoding
+		Value    interface{}
+		Want     []string
+	}{
+		{"YAML", YAMLEncoding, metaData{}, []string{"by", "params", "title"}},
+		{"YAML draft", YAMLEncoding, metaData{Draft: true}, []string{"by", "draft", "params", "title"}},
+		{"TOML", TOMLEncoding, metaData{}, []string{"Params", "Title", "by"}},
+		{"JSON", JSONEncoding, metaData{}, []string{"Params", "Title", "by"}},
+		{"Map", YAMLEncoding, map[string]interface{}{"b": 1, "a": map[string]int{"c": 2}}, []string{"a", "b"}},
+		{"Transform", YAMLEncoding.Clone(WithKeyTransform(strings.ToUpper, nil)), metaData{}, []string{"PARAMS", "TITLE", "by"}},
+	}
+
+	for _, r := range runner {
+		have, err := r.Encoding.Fields(r.Value)
+		if err != nil {
+			t.Errorf(r.Name+": err: %s", err)
+		}
+
+		if !reflect.DeepEqual(r.Want, have) {
+			t.Errorf(r.Name+": \nwant: %q \nhave: %q", r.Want, have)
+		}
+	}
+}
@@ -0,0 +1,105 @@
+// Copyright 2016 Nika Jones. All rights reserved.
+// Use of this source code is governed by the MIT license.
+// license that can be found in the LICENSE file.
+
+package particle
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// Merge decodes the frontmatter metadata of src, merges the metadata from v
+// into it, and returns the frontmatter encoding of the merged metadata before
+// the content of src. The metadata of v takes precedence: nested maps are
+// merged key by key, while any other value (scalars, lists, or a map that
+// replaces a non-map value) overwrites the existing value as a whole. If src
+// has no frontmatter, the result has just the metadata of v.
+func (e *Encoding) Merge(src []byte, v interface{}) ([]byte, error) {
+	dst := make(map[string]interface{})
+	content, err := e.DecodeReader(bytes.NewReader(src), &dst)
+	if err != nil {
+		return nil, err
+	}
+
+	m, err := e.toMap(v)
+	if err != nil {
+		return nil, err
+	}
+
+	return e.AppendEncode(nil, content, mergeMaps(dst, m))
+}
+
+// toMap converts v to a generic map, by marshaling and unmarshaling it with
+// e, so that the keys are the same as they would be in frontmatter.
+func (e *Encoding) toMap(v interface{}) (map[string]interface{}, error) {
+	f, err := e.marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	m := make(map[string]interface{})
+	if err := e.unmarshal(f, &m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// mergeMaps merges src into dst, recursively for values that are maps in
+// both, and returns dst.
+func mergeMaps(dst, src map[string]interface{}) map[string]interface{} {
+	for k, sv := range src {
+		if sm, ok := stringMap(sv); ok {
+			if dm, ok := stringMap(dst[k]); ok {
+				dst[k] = mergeMaps(dm, sm)
+				continue
+			}
+		}
+		dst[k] = sv
+	}
+	return dst
+}
+
+// stringMap returns v as a map[string]interface{} if it is a map. YAML
+// decodes nested maps as map[interface{}]interface{}, so those keys are
+// converted to strings.
+func stringMap(v interface{}) (map[string]interface{}, bool) {
+	switch m := v.(type) {
+	case map[string]interface{}:
+		return m, true
+	case map[interface{}]interface{}:
+		sm := make(map[string]interface{}, len(m))
+		for k, v := range m {
+			sm[fmt.Sprint(k)] = v
+		}
+		return sm, true
+	}
+	return nil, false
+}
+
+// matchKeyCase returns src with each key that differs from a key of dst only
+// in case renamed to the key of dst, recursively for values that are maps in
+// both. The TOML and JSON unmarshal funcs match struct fields without regard
+// to case, so both keys would set the same field.
+func matchKeyCase(src, dst map[string]interface{}) map[string]interface{} {
+	out := make(map[string]interface{}, len(src))
+	for k, sv := range src {
+		if _, ok := dst[k]; !ok {
+			for dk := range dst {
+				if strings.EqualFold(k, dk) {
+					k = dk
+					break
+				}
+			}
+		}
+
+		if sm, ok := stringMap(sv); ok {
+			if dm, ok := stringMap(dst[k]); ok {
+				sv = matchKeyCase(sm, dm)
+			}
+		}
+		out[k] = sv
+	}
+	return out
+}
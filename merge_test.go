@@ -0,0 +1,60 @@
+package particle
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMerge(t *testing.T) {
+	var runner = []struct {
+		Name     string
+		Encoding *Encoding
+		File     string
+	}{
+		{"YAML", YAMLEncoding, "---\ntitle: example\ntags: [a, b]\nauthor:\n  name: John Doe\n  email: john@example.com\n---\n\n" + wantContent},
+		{"TOML", TOMLEncoding, "+++\ntitle = \"example\"\ntags = [\"a\", \"b\"]\n[author]\nname = \"John Doe\"\nemail = \"john@example.com\"\n+++\n\n" + wantContent},
+		{"JSON", JSONEncoding, "{\n\"title\": \"example\",\n\"tags\": [\"a\", \"b\"],\n\"author\": {\"name\": \"John Doe\", \"email\": \"john@example.com\"}\n}\n\n" + wantContent},
+		{"None", YAMLEncoding, wantContent},
+	}
+
+	v := map[string]interface{}{
+		"title":  "merged",
+		"tags":   []string{"c"},
+		"author": map[string]interface{}{"name": "Jane Doe"},
+	}
+
+	for _, r := range runner {
+		have, err := r.Encoding.Merge([]byte(r.File), v)
+		if err != nil {
+			t.Errorf(r.Name+": err: %s", err)
+			continue
+		}
+
+		haveMap, haveContent, err := r.Encoding.DecodeStringMap(string(have))
+		if err != nil {
+			t.Errorf(r.Name+": err: %s", err)
+		}
+
+		if wantContent != string(haveContent) {
+			t.Errorf(r.Name+": \nwant: %q \nhave: %q", wantContent, string(haveContent))
+		}
+
+		if haveMap["title"] != "merged" {
+			t.Errorf(r.Name+": want: %q have: %q", "merged", haveMap["title"])
+		}
+
+		if tags, _ := haveMap["tags"].([]interface{}); len(tags) != 1 || tags[0] != "c" {
+			t.Errorf(r.Name+": lists should be replaced: %v", haveMap["tags"])
+		}
+
+		wantAuthor := map[string]interface{}{"name": "Jane Doe", "email": "john@example.com"}
+		if r.Name == "None" {
+			delete(wantAuthor, "email")
+		}
+
+		haveAuthor, _ := stringMap(haveMap["author"])
+		if !reflect.DeepEqual(wantAuthor, haveAuthor) {
+			t.Errorf(r.Name+": nested maps should be merged \nwant: %v \nhave: %v", wantAuthor, haveAuthor)
+		}
+	}
+}
@@ -0,0 +1,40 @@
+// Copyright 2016 Nika Jones. All rights reserved.
+// Use of this source code is governed by the MIT license.
+// license that can be found in the LICENSE file.
+
+package particle
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// msgpackMarshal marshals v to MessagePack with vmihailenco/msgpack. Map keys
+// are written in sorted order, so the same value always has the same bytes,
+// and ints are written in the smallest format that holds them.
+func msgpackMarshal(v interface{}) ([]byte, error) {
+	buf := new(bytes.Buffer)
+	enc := msgpack.NewEncoder(buf)
+	enc.SetSortMapKeys(true)
+	enc.UseCompactInts(true)
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// msgpackUnmarshal unmarshals the MessagePack data to v with
+// vmihailenco/msgpack. It returns an error when there is data after the
+// value.
+func msgpackUnmarshal(data []byte, v interface{}) error {
+	r := bytes.NewReader(data)
+	if err := msgpack.NewDecoder(r).Decode(v); err != nil {
+		return err
+	}
+	if r.Len() > 0 {
+		return fmt.Errorf("msgpack: %d bytes after the value", r.Len())
+	}
+	return nil
+}
@@ -0,0 +1,154 @@
+package particle
+
+import (
+	"bytes"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type msgpackMetaData struct {
+	Name   string            `msgpack:"name"`
+	Count  int64             `msgpack:"count"`
+	Small  int               `msgpack:"small"`
+	Big    uint64            `msgpack:"big"`
+	Ratio  float64           `msgpack:"ratio"`
+	Draft  bool              `msgpack:"draft"`
+	Tags   []string          `msgpack:"tags"`
+	Params map[string]string `msgpack:"params"`
+	Blob   []byte            `msgpack:"blob"`
+	Date   time.Time         `msgpack:"date"`
+	Next   *msgpackMetaData  `msgpack:"next"`
+}
+
+func TestMsgpack(t *testing.T) {
+	var runner = []struct {
+		Name string
+		Have interface{}
+		Want []byte
+	}{
+		{"Map", map[string]interface{}{"b": true, "a": 1}, []byte{0x82, 0xa1, 'a', 0x01, 0xa1, 'b', 0xc3}},
+		{"Nil", nil, []byte{0xc0}},
+		{"Int16", 300, []byte{0xcd, 0x01, 0x2c}},
+		{"Bin", []byte{0xff}, []byte{0xc4, 0x01, 0xff}},
+	}
+
+	for _, r := range runner {
+		have, err := msgpackMarshal(r.Have)
+		if err != nil {
+			t.Errorf(r.Name+": err: %s", err)
+		}
+
+		if !bytes.Equal(r.Want, have) {
+			t.Errorf(r.Name+": \nwant: % x \nhave: % x", r.Want, have)
+		}
+	}
+
+	// the values that don't have a JSON form unmarshal to what was marshaled
+	var roundTrips = []struct {
+		Name string
+		Have interface{}
+	}{
+		{"Bin", map[string][]byte{"blob": {0x00, 0xff}}},
+		{"Time", map[string]time.Time{"date": time.Date(2016, 10, 10, 8, 0, 0, 5, time.Local)}},
+		{"IntKeys", map[int]string{1: "a", -2: "b"}},
+		{"Inf", map[string]float64{"inf": math.Inf(1), "ninf": math.Inf(-1)}},
+	}
+
+	for _, r := range roundTrips {
+		b, err := msgpackMarshal(r.Have)
+		if err != nil {
+			t.Errorf(r.Name+": err: %s", err)
+		}
+
+		have := reflect.New(reflect.TypeOf(r.Have))
+		if err := msgpackUnmarshal(b, have.Interface()); err != nil {
+			t.Errorf(r.Name+": err: %s", err)
+		}
+
+		if !reflect.DeepEqual(r.Have, have.Elem().Interface()) {
+			t.Errorf(r.Name+": \nwant: %v \nhave: %v", r.Have, have.Elem().Interface())
+		}
+	}
+
+	var nan float64
+	if b, err := msgpackMarshal(math.NaN()); err != nil || msgpackUnmarshal(b, &nan) != nil || !math.IsNaN(nan) {
+		t.Errorf("NaN: want NaN have: %v %v", nan, err)
+	}
+
+	if err := msgpackUnmarshal([]byte{0x82, 0xa1, 'a'}, &map[string]interface{}{}); err == nil {
+		t.Error("Short: want an error")
+	}
+
+	if err := msgpackUnmarshal([]byte{0xc0, 0xc0}, &map[string]interface{}{}); err == nil {
+		t.Error("Trailing: want an error")
+	}
+}
+
+func TestMsgpackEncoding(t *testing.T) {
+	want := msgpackMetaData{
+		Name:   "John Doe",
+		Count:  -1 << 40,
+		Small:  7,
+		Big:    math.MaxUint64,
+		Ratio:  0.25,
+		Draft:  true,
+		Tags:   []string{"a", strings.Repeat("b", 300)},
+		Params: map[string]string{"layout": "post", "---": "\n---\n"},
+		Blob:   []byte(MsgpackDelimiter + "\x00\x00\x00\x01\xff"),
+		Date:   time.Date(2016, 10, 10, 8, 0, 0, 0, time.Local),
+		Next:   &msgpackMetaData{Name: "Jane Doe"},
+	}
+
+	// the content holds the delimiter, and bytes that aren't text
+	content := []byte(MsgpackDelimiter + "\x00\x00\x00\x02\n---\n\xff\x00" + wantContent)
+
+	haveFile, err := MsgpackEncoding.AppendEncode(nil, content, want)
+	if err != nil {
+		t.Fatalf("(AppendEncode): err: %s", err)
+	}
+
+	if !bytes.HasPrefix(haveFile, []byte(MsgpackDelimiter)) || !bytes.HasSuffix(haveFile, content) {
+		t.Errorf("(AppendEncode): want the framed metadata before the content have: %q", haveFile)
+	}
+
+	for _, rd := range []struct {
+		Name   string
+		Decode func(v interface{}) ([]byte, error)
+	}{
+		{"DecodeString", func(v interface{}) ([]byte, error) { return MsgpackEncoding.DecodeString(string(haveFile), v) }},
+		{"DecodeReader", func(v interface{}) ([]byte, error) {
+			return MsgpackEncoding.DecodeReader(&splitReader{b: haveFile, i: len(MsgpackDelimiter) + 2}, v)
+		}},
+	} {
+		have := msgpackMetaData{}
+		haveContent, err := rd.Decode(&have)
+		if err != nil {
+			t.Errorf(rd.Name+": err: %s", err)
+		}
+
+		if !bytes.Equal(content, haveContent) {
+			t.Errorf(rd.Name+": \nwant: %q \nhave: %q", content, haveContent)
+		}
+
+		if !reflect.DeepEqual(want, have) {
+			t.Errorf(rd.Name+": \nwant: %+v \nhave: %+v", want, have)
+		}
+
+		again, err := MsgpackEncoding.AppendEncode(nil, haveContent, have)
+		if err != nil || !bytes.Equal(haveFile, again) {
+			t.Errorf(rd.Name+"(AppendEncode): want the same bytes \nwant: %q \nhave: %q %v", haveFile, again, err)
+		}
+	}
+
+	haveContent, err := MsgpackEncoding.DecodeString(wantContent, &msgpackMetaData{})
+	if err != nil || wantContent != string(haveContent) {
+		t.Errorf("NoFrontmatter: want: %q have: %q %v", wantContent, string(haveContent), err)
+	}
+
+	if _, err := MsgpackEncoding.DecodeString(string(haveFile[:len(MsgpackDelimiter)+10]), &msgpackMetaData{}); err == nil {
+		t.Error("Truncated: want an error")
+	}
+}
@@ -9,13 +9,18 @@ package particle
 import (
 	"bufio"
 	"bytes"
+	"compress/gzip"
 	"crypto/md5"
+	"errors"
 	"fmt"
+	"hash"
 	"io"
 	"io/ioutil"
+	"os"
+	"reflect"
 	"strings"
 	"sync"
-	"unicode"
+	"unicode/utf8"
 
 	"encoding/json"
 	"github.com/BurntSushi/toml"
@@ -26,34 +31,192 @@ const (
 	YAMLDelimiter     = "---"
 	TOMLDelimiter     = "+++"
 	JSONDelimiterPair = "{ }"
+
+	// JSONFenceDelimiterPair is the open and close delimiter of a Markdown
+	// code fence around JSON frontmatter, as used by JSONFencedEncoding.
+	JSONFenceDelimiterPair = "```json ```"
+
+	// MsgpackDelimiter is the start of a MessagePack frontmatter block, as
+	// used by MsgpackEncoding. 0xc1 is never used in MessagePack, and isn't
+	// valid UTF-8, so it doesn't start a text file either.
+	MsgpackDelimiter = "\xc1MSGPACK"
+
+	// HTMLHeadDelimiterPair is the open and close delimiter of the <head>
+	// of an HTML document, as used by HTMLMetaEncoding.
+	HTMLHeadDelimiterPair = "<head> </head>"
+
+	// ExcerptSeparator is the default separator between the excerpt and the
+	// rest of the content used by DecodeWithExcerpt.
+	ExcerptSeparator = "---"
+)
+
+var (
+	// ErrMarshalPanic is returned (wrapped with the recovered value) when a
+	// MarshalFunc panics while encoding frontmatter metadata.
+	ErrMarshalPanic = errors.New("particle: marshal func panic")
+
+	// ErrUnmarshalPanic is returned (wrapped with the recovered value) when
+	// an UnmarshalFunc panics while decoding frontmatter metadata.
+	ErrUnmarshalPanic = errors.New("particle: unmarshal func panic")
+
+	// ErrMaxSize is returned when decoding an input that is larger than the
+	// size set with WithMaxSize.
+	ErrMaxSize = errors.New("particle: input is larger than the maximum size")
+
+	// ErrDestinationNotPointer is returned (wrapped with the type) when the
+	// value to decode the frontmatter metadata to isn't a non-nil pointer or
+	// a non-nil map.
+	ErrDestinationNotPointer = errors.New("particle: decode destination is not a non-nil pointer")
+
+	// ErrNotSeparated is returned (wrapped with the reason) when an input
+	// starts with the opening delimiter, but the frontmatter block isn't
+	// cleanly separated from the content, and WithStrictSeparation is set.
+	ErrNotSeparated = errors.New("particle: frontmatter is not separated from the content")
+
+	// ErrInvalidUTF8 is returned by DecodeStringContent when the content
+	// isn't valid UTF-8 and WithValidUTF8 is set.
+	ErrInvalidUTF8 = errors.New("particle: content is not valid UTF-8")
+
+	// ErrNoDiscriminator is returned (wrapped with the field name) by
+	// DecodeDiscriminated when the metadata doesn't have the field.
+	ErrNoDiscriminator = errors.New("particle: missing discriminator field")
+
+	// ErrUnknownDiscriminator is returned (wrapped with the field value) by
+	// DecodeDiscriminated when no registered type matches the field.
+	ErrUnknownDiscriminator = errors.New("particle: unknown discriminator")
 )
 
+// FrontmatterError records an error from marshaling or unmarshaling
+// frontmatter metadata, along with the operation and format that caused it.
+type FrontmatterError struct {
+	Op     string // "encode" or "decode"
+	Format string // the name of the encoding, if it has one
+	Err    error  // the error from the marshal or unmarshal func
+}
+
+func (e *FrontmatterError) Error() string {
+	if e.Format == "" {
+		return "particle: " + e.Op + " frontmatter: " + e.Err.Error()
+	}
+	return "particle: " + e.Op + " " + e.Format + " frontmatter: " + e.Err.Error()
+}
+
+// Unwrap returns the underlying marshal or unmarshal error.
+func (e *FrontmatterError) Unwrap() error { return e.Err }
+
+// utf8BOM is the UTF-8 byte order mark.
+var utf8BOM = []byte("\xef\xbb\xbf")
+
+// gzipMagic is the first two bytes of a gzip stream.
+var gzipMagic = []byte("\x1f\x8b")
+
 // YAMLEncoding is the encoding for standard frontmatter files that use YAML
-// as the metadata format.
-var YAMLEncoding = NewEncoding(
+// as the metadata format. YAML anchors and aliases are expanded when the
+// metadata is unmarshaled, so re-encoding the metadata writes out each alias
+// in full. To keep them, clone the encoding using WithUnmarshalFunc and
+// WithMarshalFunc with a YAML library that has a document node type (i.e.
+// yaml.v3 and *yaml.Node), the value passed to the decode and encode
+// functions is handed to those funcs as is.
+var YAMLEncoding = MustNewEncoding(
+	WithName("yaml"),
 	WithDelimiter(YAMLDelimiter),
 	WithMarshalFunc(yaml.Marshal),
 	WithUnmarshalFunc(yaml.Unmarshal),
+	WithStrictUnmarshalFunc(yaml.UnmarshalStrict),
 )
 
 // TOMLEncoding is the encoding for frontmatter files that use TOML as the
-// metadata format.
-var TOMLEncoding = NewEncoding(
+// metadata format. Map keys are emitted in sorted order, so encoding the same
+// map always produces the same frontmatter.
+var TOMLEncoding = MustNewEncoding(
+	WithName("toml"),
 	WithDelimiter(TOMLDelimiter),
 	WithMarshalFunc(tomlMarshal),
 	WithUnmarshalFunc(toml.Unmarshal),
+	WithStrictUnmarshalFunc(tomlUnmarshalStrict),
 )
 
 // JSONEncoding is the encoding for frontmatter files that use JSON as the
 // metadata format, note there is no delimiter, just use a single open and
 // close curly bracket on a line to designate the JSON frontmatter metadata
-// block.
-var JSONEncoding = NewEncoding(
+// block. Blank lines and lines starting with a "#" or "//" comment may come
+// before the opening curly bracket.
+var JSONEncoding = MustNewEncoding(
+	WithName("json"),
 	WithDelimiter(JSONDelimiterPair),
 	WithMarshalFunc(jsonMarshal),
 	WithUnmarshalFunc(json.Unmarshal),
+	WithStrictUnmarshalFunc(jsonUnmarshalStrict),
 	WithSplitFunc(SpaceSeparatedTokenDelimiters),
 	WithIncludeDelimiter(),
+	WithPreamble(jsonPreamble),
+)
+
+// JSONFencedEncoding is the encoding for frontmatter files that use JSON as
+// the metadata format inside of a Markdown code fence, a line with "```json"
+// opens the block and a line with "```" closes it. The fence lines are not
+// part of the metadata, the JSON object between them is unmarshaled as it is
+// for JSONEncoding. Files with a bare curly bracket block are decoded with
+// JSONEncoding.
+var JSONFencedEncoding = MustNewEncoding(
+	WithName("jsonfenced"),
+	withTagName("json"),
+	WithDelimiter(JSONFenceDelimiterPair),
+	WithMarshalFunc(jsonFencedMarshal),
+	WithUnmarshalFunc(json.Unmarshal),
+	WithStrictUnmarshalFunc(jsonUnmarshalStrict),
+	WithSplitFunc(SpaceSeparatedTokenDelimiters),
+)
+
+// MsgpackEncoding is the encoding for frontmatter files that use MessagePack
+// as the metadata format, for binary content pipelines. The block is framed
+// by LengthPrefixedDelimiter rather than by lines: the MsgpackDelimiter
+// bytes, then the length of the metadata as a 4 byte big-endian unsigned
+// int, then the metadata, and the content right after it, without a
+// separator. The values are marshaled with vmihailenco/msgpack, keyed by
+// their msgpack tags, and map keys are written in sorted order.
+var MsgpackEncoding = MustNewEncoding(
+	WithName("msgpack"),
+	WithDelimiter(MsgpackDelimiter),
+	WithSplitFunc(LengthPrefixedDelimiter),
+	WithMarshalFunc(msgpackMarshal),
+	WithUnmarshalFunc(msgpackUnmarshal),
+)
+
+// HTMLMetaEncoding is the encoding for HTML documents that keep their
+// metadata in <meta name="..." content="..."> tags, for importing existing
+// pages. The <head> tag (which may have attributes) opens the block and the
+// </head> tag closes it, each at the end of a line, with nothing but the
+// doctype, <html> and comment tags before the <head> tag. Those preamble
+// lines are kept in the content, in front of what follows the </head> line
+// (i.e. the <body>), and Encode writes them before the block again. Only
+// simple name and content meta pairs are supported: the other tags in the
+// <head> (i.e. <title> or <meta charset>) and the attributes of the <head>
+// tag are dropped when decoding, and aren't written when encoding. Struct
+// fields are named by their meta tag (i.e. `meta:"og:title"`), or else their
+// lower cased name, and must be strings to be decoded.
+var HTMLMetaEncoding = MustNewEncoding(
+	WithName("htmlmeta"),
+	WithDelimiter(HTMLHeadDelimiterPair),
+	WithSplitFunc(SpaceSeparatedTokenDelimiters),
+	WithPreamble(htmlPreamble),
+	withDelimiterFunc(htmlDelimiter),
+	withKeepPreamble(),
+	WithMarshalFunc(htmlMetaMarshal),
+	WithUnmarshalFunc(htmlMetaUnmarshal),
+)
+
+// HTMLCommentEncoding is the encoding for frontmatter files that use YAML as
+// the metadata format inside of an HTML comment, a line with "<!--" opens the
+// block and a line with "-->" closes it. Markdown renderers that don't know
+// about frontmatter hide the comment, rather than showing the metadata.
+var HTMLCommentEncoding = MustNewEncoding(
+	WithName("htmlcomment"),
+	withTagName("yaml"),
+	WithDelimiterPair("<!--", "-->"),
+	WithMarshalFunc(yaml.Marshal),
+	WithUnmarshalFunc(yaml.Unmarshal),
+	WithStrictUnmarshalFunc(yaml.UnmarshalStrict),
 )
 
 // Splitter holds the start and end delimiter used for splitting out
@@ -63,6 +226,12 @@ var JSONEncoding = NewEncoding(
 type Splitter struct {
 	Start, End string
 	SplitFunc  bufio.SplitFunc
+
+	// Frame, when it isn't nil, returns the frontmatter block to write for
+	// the marshaled metadata when encoding, in place of the Start and End
+	// lines around it and the blank line after it. It is for binary
+	// metadata, that can't be framed by lines.
+	Frame func(metadata []byte) []byte
 }
 
 // The SplitFunc type returns the open and close delimiters, along
@@ -78,22 +247,122 @@ type MarshalFunc func(interface{}) ([]byte, error)
 // frontmatter encoded metadata to a struct or map.
 type UnmarshalFunc func([]byte, interface{}) error
 
+// The Position type is where the frontmatter block is placed in a file.
+type Position int
+
+const (
+	// HeaderPosition places the frontmatter block at the start of a file,
+	// this is the default.
+	HeaderPosition Position = iota
+
+	// FooterPosition places the frontmatter block at the end of a file.
+	FooterPosition
+)
+
+// Location is where the frontmatter metadata was found in a decoded source.
+// Start and End are byte offsets, so that src[Start:End] are the metadata
+// bytes, and LineStart and LineEnd are the (1 based) first and last lines of
+// the metadata. When the encoding includes the
+// delimiters in the metadata, they are part of the location as well, so that
+// line numbers reported by an unmarshaler can be mapped back to the source by
+// adding LineStart-1.
+type Location struct {
+	Start, End         int
+	LineStart, LineEnd int
+}
+
 // The EncodingOptionFunc type the function signature for adding encoding
 // options to the formatter.
 type EncodingOptionFunc func(*Encoding) error
 
+// The DecodeOption type is an encoding option passed to a single decode or
+// encode call. It is applied to a copy of the Encoding, so the Encoding
+// itself is never changed. An option that fails is returned as the error of
+// the call, the calls without an error (i.e. Encode) panic with it.
+type DecodeOption = EncodingOptionFunc
+
 // The encoder type is a writer that will add the frontmatter encoded metadata
 // before the source data stream is written to the underlying writer type
 // encoder struct{ w io.Writer }
-type encoder struct{ w io.Writer }
+type encoder struct {
+	w               io.Writer
+	trailer, footer []byte
+	closed          bool
+}
 
 func (l *encoder) Write(p []byte) (n int, err error) {
 	n, err = l.w.Write(p)
 	return
 }
 
+// Close writes the trailer and footer frontmatter (if any) to the underlying
+// writer and flushes it if it has a Flush method. The underlying writer is
+// not closed. Calling Close more than once has no effect.
+func (l *encoder) Close() error {
+	if l.closed {
+		return nil
+	}
+	l.closed = true
+
+	for _, b := range [][]byte{l.trailer, l.footer} {
+		if len(b) > 0 {
+			if _, err := l.w.Write(b); err != nil {
+				return err
+			}
+		}
+	}
+
+	if f, ok := l.w.(interface{ Flush() error }); ok {
+		return f.Flush()
+	}
+	return nil
+}
+
+// WithName adds the name of the metadata format (i.e. "yaml"), which is used
+// in error messages and to look up encodings by name
+func WithName(name string) EncodingOptionFunc {
+	return func(e *Encoding) error {
+		e.name = name
+		return nil
+	}
+}
+
+// withTagName sets the name of the struct tags that key the fields of the
+// metadata, for an encoding that is named differently from its metadata
+// format (i.e. "json" for JSONFencedEncoding).
+func withTagName(tag string) EncodingOptionFunc {
+	return func(e *Encoding) error {
+		e.tagName = tag
+		return nil
+	}
+}
+
+// withDelimiterFunc reads the delimiter lines with fn, which returns the
+// delimiter that a line stands for (i.e. "<head>" for a <head> tag with
+// attributes) and the preamble before it on the same line (i.e. "<html>" of
+// "<html><head>"), for a format that doesn't write its delimiter lines one
+// way. A line that isn't a delimiter is returned as it is.
+func withDelimiterFunc(fn func(line string) (pre, delim string)) EncodingOptionFunc {
+	return func(e *Encoding) error {
+		e.delimiterFunc = fn
+		return nil
+	}
+}
+
+// withKeepPreamble keeps the preamble lines before the opening delimiter in
+// the content when decoding, rather than dropping them, and writes the
+// leading preamble lines of the content before the block with Encode and
+// AppendEncode, so a whole document (i.e. an HTML page) is kept.
+func withKeepPreamble() EncodingOptionFunc {
+	return func(e *Encoding) error {
+		e.keepPreamble = true
+		return nil
+	}
+}
+
 // WithDelimiter adds the string delimiter to designate frontmatter encoded
-// metadata section to *Encoding
+// metadata section to *Encoding. The delimiter is matched against a whole
+// line, so NewEncoding returns an error if s is empty or has a line break.
 func WithDelimiter(s string) EncodingOptionFunc {
 	return func(e *Encoding) error {
 		e.delimiter = s
@@ -101,6 +370,31 @@ func WithDelimiter(s string) EncodingOptionFunc {
 	}
 }
 
+// WithDelimiterPair sets different open and close delimiters to designate the
+// frontmatter encoded metadata section. It is the same as using
+// WithDelimiter(start+" "+end) with the SpaceSeparatedTokenDelimiters split
+// func, so neither delimiter can contain a space.
+func WithDelimiterPair(start, end string) EncodingOptionFunc {
+	return func(e *Encoding) error {
+		if start == "" || end == "" || strings.ContainsAny(start+end, " \r\n") {
+			return fmt.Errorf("particle: invalid delimiter pair %q %q", start, end)
+		}
+		e.delimiter, e.inSplitFunc, e.splitSet = start+" "+end, SpaceSeparatedTokenDelimiters, true
+		return nil
+	}
+}
+
+// checkDelimiter returns an error if the delimiter s can't match a line.
+func checkDelimiter(s string) error {
+	switch {
+	case s == "":
+		return errors.New("particle: invalid delimiter: it is empty")
+	case strings.ContainsAny(s, "\r\n"):
+		return fmt.Errorf("particle: invalid delimiter %q: it has a line break", s)
+	}
+	return nil
+}
+
 // WithMarshalFunc adds the MarshalFunc function that will marshal a struct or
 // map to frontmatter encoded metadata string *Encoding
 func WithMarshalFunc(fn MarshalFunc) EncodingOptionFunc {
@@ -110,11 +404,195 @@ func WithMarshalFunc(fn MarshalFunc) EncodingOptionFunc {
 	}
 }
 
+// WithMarshalFallback adds a MarshalFunc that marshals the frontmatter
+// metadata when the MarshalFunc returns an error (or panics), so an encode
+// can degrade gracefully, i.e. by skipping the values the format can't hold,
+// or writing them as strings. The MarshalFunc is always tried first, and its
+// error is dropped when the fallback succeeds. The fallback is given the same
+// value, after any key and text marshaler changes, and its output is framed
+// with the delimiters, the same as the MarshalFunc output.
+func WithMarshalFallback(fn MarshalFunc) EncodingOptionFunc {
+	return func(e *Encoding) error {
+		e.marshalFallbackFunc = fn
+		return nil
+	}
+}
+
 // WithUnmarshalFunc adds the UnmarshalFunc function that will unmarshal the
-// frontmatter encoded metadata to a struct or map to *Encoding
+// frontmatter encoded metadata to a struct or map to *Encoding. Any strict
+// UnmarshalFunc previously set is removed, because it would no longer match.
 func WithUnmarshalFunc(fn UnmarshalFunc) EncodingOptionFunc {
 	return func(e *Encoding) error {
 		e.unmarshalFunc = fn
+		e.strictUnmarshalFunc = nil
+		return nil
+	}
+}
+
+// WithStrictUnmarshalFunc adds the UnmarshalFunc function that is used in
+// place of the regular UnmarshalFunc when strict unmarshaling is turned on.
+// It should return an error for metadata keys that do not map to the
+// destination.
+func WithStrictUnmarshalFunc(fn UnmarshalFunc) EncodingOptionFunc {
+	return func(e *Encoding) error {
+		e.strictUnmarshalFunc = fn
+		return nil
+	}
+}
+
+// WithJSONNumber unmarshals JSON numbers as json.Number values, rather than
+// float64 values, when decoding to an interface{}, so large integers keep
+// their exact value. It replaces the unmarshal funcs, so it is only for JSON
+// encodings.
+func WithJSONNumber() EncodingOptionFunc {
+	return func(e *Encoding) error {
+		if err := e.onlyJSON("WithJSONNumber"); err != nil {
+			return err
+		}
+		e.unmarshalFunc = jsonUnmarshalNumber
+		e.strictUnmarshalFunc = jsonUnmarshalStrictNumber
+		return nil
+	}
+}
+
+// WithSortedKeys marshals the metadata with all of its object keys in sorted
+// order, struct fields as well as map keys, so the same metadata always
+// encodes the same way, whatever its type. The metadata is turned into JSON
+// values before the marshal func of the encoding is called, so it is only for
+// JSON encodings.
+func WithSortedKeys() EncodingOptionFunc {
+	return func(e *Encoding) error {
+		e.sortedKeys = true
+		return nil
+	}
+}
+
+// WithoutStrictUnmarshal turns off strict unmarshaling. This is mostly useful
+// as a per call DecodeOption.
+func WithoutStrictUnmarshal() EncodingOptionFunc {
+	return func(e *Encoding) error {
+		e.strictUnmarshal = false
+		return nil
+	}
+}
+
+// WithMaxSize sets the maximum size in bytes of an input that will be
+// decoded. Decoding a larger input returns ErrMaxSize. A size of zero or less
+// means there is no maximum.
+func WithMaxSize(n int64) EncodingOptionFunc {
+	return func(e *Encoding) error {
+		e.maxSize = n
+		return nil
+	}
+}
+
+// WithScannerBufferSize sets the maximum size in bytes of a single token read
+// while splitting the frontmatter from the content. Raise it when a custom
+// split func returns tokens larger than the default of 64KB (i.e. whole lines
+// of a metadata block with very long lines).
+func WithScannerBufferSize(n int) EncodingOptionFunc {
+	return func(e *Encoding) error {
+		e.scannerBufferSize = n
+		return nil
+	}
+}
+
+// WithStripBOM removes a leading UTF-8 byte order mark from an input before
+// it is decoded.
+func WithStripBOM() EncodingOptionFunc {
+	return func(e *Encoding) error {
+		e.stripBOM = true
+		return nil
+	}
+}
+
+// WithWholeDocument treats the whole input as frontmatter metadata, without
+// any delimiters. This is for metadata files (i.e. sidecar files) that have
+// no content. Decoding always returns empty content, and encoding writes the
+// metadata without any delimiters, followed by the content as is, so the
+// content should be empty to decode the same metadata.
+func WithWholeDocument() EncodingOptionFunc {
+	return func(e *Encoding) error {
+		e.wholeDocument = true
+		return nil
+	}
+}
+
+// WithPreserveKeyCase keeps the metadata keys exactly as they are written in
+// the frontmatter when decoding to a *map[string]interface{} (or a
+// map[string]interface{}). The key transform of WithKeyTransform isn't
+// applied to those maps. With the built-in encodings the top level keys are
+// always kept as written, so "Title" and "title" are two keys, and so are the
+// keys of nested JSON and TOML tables. YAML decodes nested maps as
+// map[interface{}]interface{}, with keys such as "On", "yes" or "1" resolved
+// to a bool or a number; with this option those maps are read again from the
+// metadata as a map[string]interface{} that has the keys as written.
+func WithPreserveKeyCase() EncodingOptionFunc {
+	return func(e *Encoding) error {
+		e.preserveKeyCase = true
+		return nil
+	}
+}
+
+// WithCaseInsensitiveKeys matches the top level metadata keys to the fields
+// of a destination struct without regard to case, so "Title", "title" and
+// "TITLE" all decode to the same field. A field matches the key in its tag
+// for the format (the tag named after the encoding, i.e. `yaml`), or else its
+// lower cased name. When more than one key matches the same field, a key with
+// the exact case wins, otherwise the first key in sorted (byte) order wins.
+// Destinations that are not structs are not changed.
+func WithCaseInsensitiveKeys() EncodingOptionFunc {
+	return func(e *Encoding) error {
+		e.caseInsensitiveKeys = true
+		return nil
+	}
+}
+
+// WithTimeLayouts parses the string metadata values of time.Time (and
+// *time.Time) struct fields with layouts when decoding, so a date written as
+// a string (i.e. "date: 10-10-2016" in YAML with the layout "01-02-2006")
+// decodes the same for every format. The layouts are tried in order, a value
+// that no layout parses, or that isn't a string (a TOML datetime), is left to
+// the unmarshal func. Only struct fields (and the fields of nested structs)
+// are parsed.
+func WithTimeLayouts(layouts ...string) EncodingOptionFunc {
+	return func(e *Encoding) error {
+		e.timeLayouts = append([]string{}, layouts...)
+		return nil
+	}
+}
+
+// WithTextMarshalers marshals the values that implement
+// encoding.TextMarshaler as text, and unmarshals text to the struct fields
+// that implement encoding.TextUnmarshaler, for marshal and unmarshal funcs
+// that don't do it themselves. The YAML, TOML and JSON encodings already do,
+// so it is meant for custom encodings. Structs, maps and slices that hold a
+// TextMarshaler are passed to the marshal func as maps and slices, and only
+// struct fields (not slice elements or map values) are unmarshaled from text.
+func WithTextMarshalers() EncodingOptionFunc {
+	return func(e *Encoding) error {
+		e.textMarshalers = true
+		return nil
+	}
+}
+
+// WithTrimSpace trims the leading and trailing whitespace from the decoded
+// content. The frontmatter metadata is never trimmed.
+func WithTrimSpace() EncodingOptionFunc {
+	return func(e *Encoding) error {
+		e.trimSpace = true
+		return nil
+	}
+}
+
+// WithStrictUnmarshal turns on strict unmarshaling, so that unknown metadata
+// keys are returned as errors instead of being silently ignored. The built-in
+// encodings all support strict unmarshaling, a custom encoding needs a
+// WithStrictUnmarshalFunc option, otherwise the regular UnmarshalFunc is
+// used.
+func WithStrictUnmarshal() EncodingOptionFunc {
+	return func(e *Encoding) error {
+		e.strictUnmarshal = true
 		return nil
 	}
 }
@@ -122,7 +600,7 @@ func WithUnmarshalFunc(fn UnmarshalFunc) EncodingOptionFunc {
 // WithSplitFunc adds the SplitFunc function to *Encoding
 func WithSplitFunc(fn SplitFunc) EncodingOptionFunc {
 	return func(e *Encoding) error {
-		e.inSplitFunc = fn
+		e.inSplitFunc, e.splitSet = fn, true
 		return nil
 	}
 }
@@ -136,191 +614,2990 @@ func WithIncludeDelimiter() EncodingOptionFunc {
 	}
 }
 
-// NewDecoder constructs a new frontmatter stream decoder, adding the
-// marshaled frontmatter metadata to interface v.
-func NewDecoder(e *Encoding, r io.Reader, v interface{}) (io.Reader, error) {
-	m, o := e.readFrom(r)
-	if err := e.readUnmarshal(m, v); err != nil {
-		return nil, err
+// WithIncludeRawDelimiter keeps the delimiter lines around the frontmatter
+// metadata returned by DecodeRaw, so the block can be copied unchanged into
+// another file. The lines are kept as they are in the input, with their line
+// endings (i.e. "\r\n") and any trailing whitespace. It doesn't change the
+// metadata that is unmarshaled, that is what WithIncludeDelimiter does: it
+// hands the delimiters to the marshal and unmarshal funcs as part of the
+// metadata (i.e. the curly brackets of JSON), but without the line endings
+// next to them.
+func WithIncludeRawDelimiter() EncodingOptionFunc {
+	return func(e *Encoding) error {
+		e.rawDelimiters = true
+		return nil
 	}
+}
 
-	return o, nil
+// WithExcerptSeparator sets the line that separates an excerpt from the rest
+// of the content when decoding with DecodeWithExcerpt
+func WithExcerptSeparator(s string) EncodingOptionFunc {
+	return func(e *Encoding) error {
+		e.excerptSeparator = s
+		return nil
+	}
 }
 
-// NewEncoder returns a new frontmatter stream encoder. Data written to the
-// returned writer will be prefixed with the encoded frontmatter metadata
-// using e and then written to w.
-func NewEncoder(e *Encoding, w io.Writer, v interface{}) (io.Writer, error) {
-	o := &encoder{w: w}
+// WithTrailer adds a string that is written after the content when the writer
+// returned from NewEncoder is closed
+func WithTrailer(s string) EncodingOptionFunc {
+	return func(e *Encoding) error {
+		e.trailer = s
+		return nil
+	}
+}
 
-	f, err := e.encodeFrontmatter(v)
-	if err != nil {
-		return nil, err
+// WithPosition sets where the frontmatter block is placed in a file. With
+// FooterPosition the whole input is buffered in memory while decoding,
+// because the block can't be found until the end of the stream has been read.
+func WithPosition(p Position) EncodingOptionFunc {
+	return func(e *Encoding) error {
+		e.position = p
+		return nil
 	}
-	o.Write(f) // write frontmatter first to the encoder
+}
+
+// WithFenceValidation only treats a leading delimited block as frontmatter
+// when the block parses as a metadata mapping. Otherwise the block is left as
+// part of the content, which keeps a document that starts with a
+// delimiter-like line (i.e. a markdown horizontal rule) intact. The whole
+// input is buffered in memory while decoding with this option.
+func WithFenceValidation() EncodingOptionFunc {
+	return func(e *Encoding) error {
+		e.fenceValidation = true
+		return nil
+	}
+}
+
+// WithLenientFallback treats a leading delimited block that fails to
+// unmarshal as part of the content, so decoding returns the whole input as
+// content, leaves the metadata destination untouched and doesn't return an
+// error. It is the opposite of WithStrictUnmarshal. The whole input is
+// buffered in memory, and the metadata is unmarshaled twice, while decoding
+// with this option.
+func WithLenientFallback() EncodingOptionFunc {
+	return func(e *Encoding) error {
+		e.lenientFallback = true
+		return nil
+	}
+}
+
+// WithMarshalIndent indents nested YAML with n spaces, rather than the two
+// spaces that yaml.v2 uses. It wraps the marshal func that is set when the
+// option is applied, so it is only for YAML encodings, and the encoding must
+// be named "yaml" by then. The indent must be from 2 to 9 spaces. The line
+// width can't be changed.
+func WithMarshalIndent(n int) EncodingOptionFunc {
+	return func(e *Encoding) error {
+		if err := e.onlyYAML("WithMarshalIndent"); err != nil {
+			return err
+		}
+		if n < 2 || n > 9 {
+			return fmt.Errorf("particle: invalid indent %d", n)
+		}
+
+		marshal := e.marshalFunc
+		e.marshalFunc = func(v interface{}) ([]byte, error) {
+			b, err := marshal(v)
+			if err != nil {
+				return nil, err
+			}
+			return yamlIndent(b, n), nil
+		}
+		return nil
+	}
+}
+
+// WithTabToSpaceConversion turns the tabs in the indentation of each line of
+// the frontmatter metadata into spaces before it is unmarshaled, so YAML
+// indented with tabs, which YAML doesn't allow, still decodes. A tab moves to
+// the next tab stop of width columns. Tabs after the first character on a
+// line that isn't a space or a tab, i.e. in a string value, are kept, and so
+// are the tabs in the text of a block scalar, past the indent of the block.
+// It is only for YAML encodings, so the encoding must be named "yaml" when
+// the option is applied, and the width must be at least 1.
+func WithTabToSpaceConversion(width int) EncodingOptionFunc {
+	return func(e *Encoding) error {
+		if err := e.onlyYAML("WithTabToSpaceConversion"); err != nil {
+			return err
+		}
+		if width < 1 {
+			return fmt.Errorf("particle: invalid tab width %d", width)
+		}
+		e.tabWidth = width
+		return nil
+	}
+}
+
+// WithStrictFence only closes the frontmatter block at a closing delimiter
+// line that is followed by a blank line or the end of the input. A delimiter
+// line inside the metadata (i.e. a YAML document separator) doesn't close the
+// block early then. The delimiter lines are the Start and End of the split
+// func, each on a line of its own. Note that YAML block scalars are indented,
+// so a delimiter inside one is never mistaken for the closing delimiter, with
+// or without this option.
+func WithStrictFence() EncodingOptionFunc {
+	return func(e *Encoding) error {
+		e.strictFence = true
+		return nil
+	}
+}
+
+// WithStrictSeparation returns an error wrapping ErrNotSeparated when an
+// input starts with the opening delimiter of the encoding, but it isn't a
+// cleanly delimited frontmatter block: the opening delimiter isn't on a line
+// of its own (i.e. a JSON object that starts with `{"title": ...`), or there
+// is no closing delimiter on a line of its own (i.e. a JSON object that ends
+// with `}This is the content`). Without it, such an input is decoded as all
+// content, with no metadata. With WithStrictFence, a closing delimiter line
+// must be followed by a blank line as well. It is only for the
+// HeaderPosition.
+func WithStrictSeparation() EncodingOptionFunc {
+	return func(e *Encoding) error {
+		e.strictSeparation = true
+		return nil
+	}
+}
+
+// WithTrimDelimiterWhitespace ignores spaces and tabs at the end of the
+// opening and closing delimiter lines when decoding, so a hand edited "--- "
+// fence still opens or closes the frontmatter block. A line that has anything
+// else after the delimiter (i.e. "--- x") is not a delimiter line. Only the
+// lines up to the closing delimiter are looked at, the content is never
+// changed. A delimiter line that ends with "\r\n" is only read when
+// WithCRLFDelimiters is set as well, then the whitespace before the "\r\n" is
+// ignored the same way.
+func WithTrimDelimiterWhitespace() EncodingOptionFunc {
+	return func(e *Encoding) error {
+		e.trimDelimiterSpace = true
+		return nil
+	}
+}
+
+// WithBufferPool draws the scratch buffers used while encoding and decoding
+// from the pool p, and puts them back when the call is done, so a busy
+// program allocates less. The pool holds *bytes.Buffer values, a New func is
+// not needed. The buffers are reused as soon as the call that took them
+// returns, so an UnmarshalFunc must not retain the frontmatter bytes it is
+// given (the built-in formats copy them).
+func WithBufferPool(p *sync.Pool) EncodingOptionFunc {
+	return func(e *Encoding) error {
+		e.bufPool = p
+		return nil
+	}
+}
+
+// WithEnvExpand replaces ${var} in the frontmatter metadata with the value of
+// the environment variable before it is unmarshaled. An unset variable is
+// replaced by an empty string.
+func WithEnvExpand() EncodingOptionFunc {
+	return WithExpander(os.Getenv)
+}
+
+// WithExpander replaces ${var} in the frontmatter metadata with the value
+// that fn returns for var before it is unmarshaled. Only the braced form is
+// replaced, and only when var is a name of letters, digits and underscores,
+// so a "$" in a value (i.e. "price: $5" or "$HOME") is kept as it is, unlike
+// os.Expand.
+func WithExpander(fn func(key string) string) EncodingOptionFunc {
+	return func(e *Encoding) error {
+		e.expandFunc = fn
+		return nil
+	}
+}
+
+// WithRawMatterHook calls fn with the raw frontmatter metadata, the bytes as
+// they are in the file between the delimiters (without the line break before
+// the closing delimiter), before they are unmarshaled when decoding (i.e. to
+// hash them for a cache). When fn returns an error the decode stops and
+// returns it. fn isn't called when there is no frontmatter, and must not keep
+// raw after it returns.
+func WithRawMatterHook(fn func(raw []byte) error) EncodingOptionFunc {
+	return func(e *Encoding) error {
+		e.rawMatterFunc = fn
+		return nil
+	}
+}
+
+// WithHeaderComment writes the comment s, as it is, on the lines before the
+// opening delimiter of the frontmatter block when encoding, so s should use
+// the comment syntax of the file (i.e. "# Generated, do not edit"). When
+// decoding, the lines of s are dropped as preamble lines before a frontmatter
+// block, but kept as content if no block follows them. It is only for the
+// HeaderPosition.
+func WithHeaderComment(s string) EncodingOptionFunc {
+	return func(e *Encoding) error {
+		if s != "" && !strings.HasSuffix(s, "\n") {
+			s += "\n"
+		}
+		e.headerComment = s
+		return nil
+	}
+}
+
+// WithKeyTransform renames the metadata keys. When encoding, the struct field
+// names and map keys are renamed with encode (i.e. to kebab-case), and when
+// decoding the keys are renamed back with decode, so they match the struct
+// field names (or become the map keys). A struct field with a name in its tag
+// for the format keeps that name, tags win over the transform. Either func
+// may be nil to leave the keys as they are.
+func WithKeyTransform(encode, decode func(string) string) EncodingOptionFunc {
+	return func(e *Encoding) error {
+		e.keyEncodeFunc, e.keyDecodeFunc = encode, decode
+		return nil
+	}
+}
+
+// WithValidUTF8 makes DecodeStringContent return ErrInvalidUTF8 along with
+// the content, when the content isn't valid UTF-8.
+func WithValidUTF8() EncodingOptionFunc {
+	return func(e *Encoding) error {
+		e.validUTF8 = true
+		return nil
+	}
+}
+
+// WithContentSeparator sets the text between the line of the closing
+// delimiter and the content, in place of a blank line. An empty sep writes
+// the content right after the closing delimiter line, i.e. for a JSON API
+// payload. When decoding, sep is dropped from the start of the content if it
+// is there. For a footer, sep comes between the content and the opening
+// delimiter line. Note that WithStrictFence still needs a blank line after
+// the closing delimiter.
+func WithContentSeparator(sep string) EncodingOptionFunc {
+	return func(e *Encoding) error {
+		e.contentSeparator = append([]byte{}, sep...)
+		return nil
+	}
+}
+
+// WithFenceNewlines sets the text written after the opening delimiter and
+// before the closing delimiter when encoding, apart from the content
+// separator (see WithContentSeparator). By default the opening delimiter is
+// followed by a single line ending, and the closing delimiter comes right
+// after the marshaled metadata, which ends with one. When beforeClose is set,
+// it replaces any line endings at the end of the marshaled metadata. Both
+// should end with a line ending, the delimiters are matched on lines of their
+// own when decoding. They aren't used when the delimiters are part of the
+// metadata, as with WithIncludeDelimiter.
+func WithFenceNewlines(afterOpen, beforeClose string) EncodingOptionFunc {
+	return func(e *Encoding) error {
+		e.fenceOpen, e.fenceClose = append([]byte{}, afterOpen...), append([]byte{}, beforeClose...)
+		return nil
+	}
+}
+
+// WithNoTrailingSeparatorOnEmptyContent drops the content separator (the
+// blank line after the closing delimiter line, or before the opening one of a
+// footer) when there is no content to separate, so a file that is just
+// metadata ends right after the closing delimiter line. It doesn't apply to
+// NewEncoder, which writes the frontmatter before it sees any content.
+func WithNoTrailingSeparatorOnEmptyContent() EncodingOptionFunc {
+	return func(e *Encoding) error {
+		e.noEmptySeparator = true
+		return nil
+	}
+}
+
+// WithOmitEmptyFrontmatter writes just the content, without any delimiters or
+// separator, when the frontmatter metadata is empty. The metadata is empty
+// when it is nil, an empty map or slice, a struct (or a pointer to one) with
+// all zero fields, or when it marshals to nothing but whitespace, "{}" or
+// "null". Decoding the content gives the zero metadata, as there is no block
+// to unmarshal.
+func WithOmitEmptyFrontmatter() EncodingOptionFunc {
+	return func(e *Encoding) error {
+		e.omitEmptyMatter = true
+		return nil
+	}
+}
+
+// WithPreamble adds a function that reports if a line is part of a preamble
+// that may come before the opening delimiter. The preamble lines (i.e. blank
+// or comment lines) are dropped when there is frontmatter after them,
+// otherwise they are kept as content. The line is passed to fn without its
+// line ending.
+func WithPreamble(fn func(line string) bool) EncodingOptionFunc {
+	return func(e *Encoding) error {
+		e.preambleFunc = fn
+		return nil
+	}
+}
+
+// NewDecoder constructs a new frontmatter stream decoder, adding the
+// marshaled frontmatter metadata to interface v. When r is already held in
+// memory, it has a Len method (i.e. a *bytes.Reader, *bytes.Buffer or
+// *strings.Reader), the content is split out in memory and the returned
+// reader has a Len method as well, returning the length of the unread
+// content.
+func NewDecoder(e *Encoding, r io.Reader, v interface{}, opts ...DecodeOption) (io.Reader, error) {
+	e, err := e.withOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, ok := r.(interface{ Len() int }); ok {
+		b, err := e.DecodeReader(r, v)
+		if err != nil {
+			return nil, err
+		}
+		return bytes.NewReader(b), nil
+	}
+
+	o, err := e.decode(r, v)
+	if err != nil {
+		closeReader(o, err) // let the split goroutine finish
+		return nil, err
+	}
+	return o, nil
+}
+
+// Decoder is a frontmatter stream decoder. It reads the content that
+// follows the frontmatter, and holds on to the raw frontmatter metadata, so
+// it can be unmarshaled once the type to unmarshal it to is known (i.e.
+// after peeking at a field with a map).
+type Decoder struct {
+	e    *Encoding
+	r    io.Reader
+	done chan struct{}
+	raw  []byte
+	err  error
+}
+
+// NewStreamDecoder returns a new Decoder that splits the frontmatter from the
+// content of r with e. The content can be read as soon as the decoder is
+// returned, the frontmatter is read in the background.
+func (e *Encoding) NewStreamDecoder(r io.Reader) *Decoder {
+	e, r = e.fenceReader(r)
+	d := &Decoder{e: e, done: make(chan struct{})}
+
+	m, o, err := e.split(r)
+	if err != nil {
+		d.r, d.err = errReader{err: err}, err
+		close(d.done)
+		return d
+	}
+
+	if e.trimSpace {
+		o = &trimSpaceReader{r: o}
+	}
+	d.r = o
+
+	if m == nil {
+		close(d.done) // there is no frontmatter
+		return d
+	}
+
+	// the metadata is buffered in the background, so the content reader
+	// isn't waiting for it
+	go func() {
+		if d.raw, d.err = ioutil.ReadAll(m); d.err == nil {
+			d.err = e.rawMatter(d.raw)
+		}
+		close(d.done)
+	}()
+	return d
+}
+
+// Read reads the content that follows the frontmatter.
+func (d *Decoder) Read(p []byte) (int, error) {
+	return d.r.Read(p)
+}
+
+// Decode unmarshals the frontmatter metadata to interface v. It waits until
+// the frontmatter has been read from the underlying reader. When there is no
+// frontmatter v is left untouched. Decode may be called more than once.
+func (d *Decoder) Decode(v interface{}) error {
+	<-d.done
+	if d.err != nil || d.raw == nil {
+		return d.err
+	}
+	return d.e.unmarshal(d.raw, v)
+}
+
+// Raw returns the frontmatter metadata as it is handed to the unmarshal func,
+// it waits until the frontmatter has been read from the underlying reader.
+// It is nil when there is no frontmatter, or it couldn't be read.
+func (d *Decoder) Raw() []byte {
+	<-d.done
+	return d.raw
+}
+
+// LazyDecoder is a frontmatter stream decoder that defers unmarshaling the
+// frontmatter metadata until it is asked for. The content can be read as
+// soon as the decoder is returned.
+type LazyDecoder struct {
+	d *Decoder
+}
+
+// NewLazyDecoder constructs a new frontmatter stream decoder that splits the
+// frontmatter from the content of r, but doesn't unmarshal the frontmatter
+// metadata until Metadata is called.
+func NewLazyDecoder(e *Encoding, r io.Reader, opts ...DecodeOption) *LazyDecoder {
+	e, err := e.withOptions(opts)
+	if err != nil {
+		d := &Decoder{r: errReader{err: err}, err: err, done: make(chan struct{})}
+		close(d.done)
+		return &LazyDecoder{d: d}
+	}
+	return &LazyDecoder{d: e.NewStreamDecoder(r)}
+}
+
+// Read reads the content that follows the frontmatter.
+func (d *LazyDecoder) Read(p []byte) (int, error) {
+	return d.d.Read(p)
+}
+
+// Metadata unmarshals the frontmatter metadata to interface v. It waits
+// until the frontmatter has been read from the underlying reader. When there
+// is no frontmatter v is left untouched. Metadata may be called more than
+// once.
+func (d *LazyDecoder) Metadata(v interface{}) error {
+	return d.d.Decode(v)
+}
+
+// NewEncoder returns a new frontmatter stream encoder. Data written to the
+// returned writer will be prefixed with the encoded frontmatter metadata
+// using e and then written to w. Closing the returned writer writes the
+// trailer of e (if any) and flushes w, but does not close w.
+func NewEncoder(e *Encoding, w io.Writer, v interface{}, opts ...DecodeOption) (io.WriteCloser, error) {
+	e, err := e.withOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	o := &encoder{w: w, trailer: []byte(e.trailer)}
+
+	f, err := e.encodeFrontmatter(v)
+	if err != nil {
+		return nil, err
+	}
+
+	if e.position == FooterPosition {
+		o.footer = f // write frontmatter last, when the encoder is closed
+		return o, nil
+	}
+	o.Write(f) // write frontmatter first to the encoder
+
+	return o, nil
+}
+
+// EncodeStream writes the frontmatter encoding of v and the content read from
+// src to dst, returning the number of bytes written. The content is copied
+// in chunks, so src is never held in memory as a whole. Like NewEncoder, the
+// trailer of e (if any) is written and dst is flushed at the end, but dst
+// isn't closed.
+func (e *Encoding) EncodeStream(dst io.Writer, src io.Reader, v interface{}, opts ...DecodeOption) (int64, error) {
+	e, err := e.withOptions(opts)
+	if err != nil {
+		return 0, err
+	}
+
+	f, err := e.encodeFrontmatter(v)
+	if err != nil {
+		return 0, err
+	}
+
+	if e.noEmptySeparator {
+		// peek at the first byte of src, to know if there is any content
+		p := make([]byte, 1)
+		n, err := io.ReadFull(src, p)
+		if err != nil && err != io.EOF {
+			return 0, err
+		}
+		src = io.MultiReader(bytes.NewReader(p[:n]), src)
+		f = e.separated(f, n == 0)
+	}
+
+	cw := &countWriter{w: dst}
+	o := &encoder{w: cw, trailer: []byte(e.trailer)}
+
+	if e.position == FooterPosition {
+		o.footer = f
+	} else if _, err := o.Write(f); err != nil {
+		return cw.n, err
+	}
+
+	if _, err := io.Copy(o, src); err != nil {
+		return cw.n, err
+	}
+
+	err = o.Close()
+	return cw.n, err
+}
+
+// countWriter counts the bytes written to w.
+type countWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// Flush flushes w if it has a Flush method.
+func (c *countWriter) Flush() error {
+	if f, ok := c.w.(interface{ Flush() error }); ok {
+		return f.Flush()
+	}
+	return nil
+}
+
+// DecodeString returns a new value of type T holding the frontmatter
+// metadata of src decoded with e, and the bytes of src without the
+// frontmatter. It decodes the same as e.DecodeString.
+func DecodeString[T any](e *Encoding, src string, opts ...DecodeOption) (T, []byte, error) {
+	var v T
+	content, err := e.DecodeString(src, &v, opts...)
+	return v, content, err
+}
+
+// Decode returns the frontmatter metadata of src decoded with e over the
+// value defaults, and the bytes of src without the frontmatter. The defaults
+// and the metadata are merged the same as in e.Merge, so a nested map or
+// struct in src only overrides the keys it has, and a key of src that only
+// differs in case from a key of defaults overrides it. The merged metadata is
+// marshaled and unmarshaled to a new value of type T, so defaults is never
+// changed. When src has no frontmatter metadata, defaults is returned as is.
+func Decode[T any](e *Encoding, src []byte, defaults T, opts ...DecodeOption) (T, []byte, error) {
+	e, err := e.withOptions(opts)
+	if err != nil {
+		return defaults, nil, err
+	}
+
+	m := make(map[string]interface{})
+	content, err := e.DecodeReader(bytes.NewReader(src), &m)
+	if err != nil || len(m) == 0 {
+		return defaults, content, err
+	}
+
+	d, err := e.toMap(defaults)
+	if err != nil {
+		return defaults, content, err
+	}
+
+	f, err := e.marshal(mergeMaps(d, matchKeyCase(m, d)))
+	if err != nil {
+		return defaults, content, err
+	}
+
+	var v T
+	if err := e.unmarshal(f, &v); err != nil {
+		return defaults, content, err
+	}
+	return v, content, nil
+}
+
+// MustDecodeString is like e.DecodeString but panics if src can't be
+// decoded. It simplifies setting up tests and package level variables from
+// known good input, and should not be used on untrusted input.
+func MustDecodeString(e *Encoding, src string, v interface{}, opts ...DecodeOption) []byte {
+	b, err := e.DecodeString(src, v, opts...)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+// MustEncodeToString is like e.EncodeToString but panics if the frontmatter
+// metadata of v can't be marshaled. Like MustDecodeString, it is meant for
+// tests and package level variables, not for production input handling.
+func MustEncodeToString(e *Encoding, src []byte, v interface{}, opts ...DecodeOption) string {
+	b, err := e.AppendEncode(nil, src, v, opts...)
+	if err != nil {
+		panic(err)
+	}
+	return string(b)
+}
+
+// Encoding is the set of options that determine the marshaling and
+// unmarshaling encoding specifications of frontmatter metadata.
+type Encoding struct {
+	name                  string
+	tagName               string
+	output                struct{ start, end string }
+	start, end, delimiter string
+	outputDelimiter       bool
+	excerptSeparator      string
+	headerComment         string
+	trailer               string
+	position              Position
+	strictUnmarshal       bool
+	fenceValidation       bool
+	stripBOM              bool
+	trimSpace             bool
+	wholeDocument         bool
+	caseInsensitiveKeys   bool
+	preserveKeyCase       bool
+	textMarshalers        bool
+	rawDelimiters         bool
+	lenientFallback       bool
+	strictFence           bool
+	strictSeparation      bool
+	trimDelimiterSpace    bool
+	crlfDelimiters        bool
+	allowShebang          bool
+	stripShebang          bool
+	keepPreamble          bool
+	validUTF8             bool
+	maxSize               int64
+	tabWidth              int
+	scannerBufferSize     int
+	contentSeparator      []byte
+	fenceOpen, fenceClose []byte
+	noEmptySeparator      bool
+	omitEmptyMatter       bool
+	sortedKeys            bool
+	timeLayouts           []string
+	bufPool               *sync.Pool
+
+	inSplitFunc         SplitFunc
+	splitSet            bool // the split func was set since the split state was derived
+	ioSplitFunc         bufio.SplitFunc
+	frameFunc           func([]byte) []byte
+	marshalFunc         MarshalFunc
+	sortedMarshalFunc   MarshalFunc // the marshal func with sorted keys, derived from marshalFunc
+	unmarshalFunc       UnmarshalFunc
+	strictUnmarshalFunc UnmarshalFunc
+	marshalFallbackFunc MarshalFunc
+	preambleFunc        func(string) bool
+	delimiterFunc       func(string) (string, string)
+	expandFunc          func(string) string
+	includeFunc         func(string) ([]byte, error)
+	includeKey          string
+	included            *includedMatter
+	rawMatterFunc       func([]byte) error
+	warnFunc            func(Warning)
+	keyEncodeFunc       func(string) string
+	keyDecodeFunc       func(string) string
+	fences              []*Encoding
+
+	fmBufMutex sync.Mutex
+	fmBuf      map[string][]byte
+	fmLen      *encodedLen
+}
+
+// encodedLen is the frontmatter marshaled by EncodeLen, handed over once to
+// the Encode call that follows it.
+type encodedLen struct {
+	h string
+	f []byte
+}
+
+// NewEncoding returns a new Encoding defined by the any passed in options.
+// All options can be changed by passing in the appropriate EncodingOptionFunc
+// option. It returns the error of the first option that fails, or an error
+// if the delimiter isn't valid once all of the options are set (i.e. there
+// was no WithDelimiter).
+func NewEncoding(options ...EncodingOptionFunc) (*Encoding, error) {
+	e := &Encoding{
+		outputDelimiter:  false,
+		excerptSeparator: ExcerptSeparator,
+		inSplitFunc:      SingleTokenDelimiter,
+	}
+	return e.init(options...)
+}
+
+// MustNewEncoding is like NewEncoding but panics if the Encoding can't be
+// made. It simplifies setting up package level variables, such as the
+// built-in encodings.
+func MustNewEncoding(options ...EncodingOptionFunc) *Encoding {
+	e, err := NewEncoding(options...)
+	if err != nil {
+		panic(err)
+	}
+	return e
+}
+
+// Name returns the name of the metadata format of e, the built-in encodings
+// are named "yaml", "toml" and "json". It is empty if no name was set.
+func (e *Encoding) Name() string {
+	return e.name
+}
+
+// tag returns the name of the struct tags that key the fields of the
+// metadata of e, the name of e unless it was set apart.
+func (e *Encoding) tag() string {
+	if e.tagName != "" {
+		return e.tagName
+	}
+	return e.name
+}
+
+// onlyYAML returns an error for the option named option when e isn't a YAML
+// encoding, one whose metadata is keyed by yaml tags.
+func (e *Encoding) onlyYAML(option string) error {
+	if e.tag() != "yaml" {
+		return fmt.Errorf("particle: %s is only for YAML encodings, not %q", option, e.name)
+	}
+	return nil
+}
+
+// onlyJSON returns an error for the option named option when e isn't a JSON
+// encoding, one whose metadata is keyed by json tags.
+func (e *Encoding) onlyJSON(option string) error {
+	if e.tag() != "json" {
+		return fmt.Errorf("particle: %s is only for JSON encodings, not %q", option, e.name)
+	}
+	return nil
+}
+
+// Delimiters returns the open and close delimiters that e looks for around
+// the frontmatter metadata, as derived from its delimiter and Splitter, and
+// whether they are a pair of different delimiters (i.e. "{" and "}") rather
+// than a single delimiter used for both (i.e. "---"). Both are empty for an
+// encoding using WithWholeDocument, which has no delimiters.
+func (e *Encoding) Delimiters() (open, close string, paired bool) {
+	if e.wholeDocument {
+		return "", "", false
+	}
+	return e.start, e.end, e.start != e.end
+}
+
+// Clone returns a new Encoding with the same configuration as e, with any
+// additional options applied on top. The clone does not share the
+// frontmatter cache with e. Like MustNewEncoding, it panics if an option
+// fails or the delimiter isn't valid.
+func (e *Encoding) Clone(options ...EncodingOptionFunc) *Encoding {
+	c := e.copy()
+	if e.fences != nil && len(options) > 0 {
+		c.fences = make([]*Encoding, len(e.fences))
+		for i, f := range e.fences {
+			c.fences[i] = f.Clone(options...)
+		}
+	}
+	c, err := c.init(options...)
+	if err != nil {
+		panic(err)
+	}
+	return c
+}
+
+// copy returns a copy of the configuration of e, without the split state
+// that is derived from it, or the frontmatter cache.
+func (e *Encoding) copy() *Encoding {
+	return &Encoding{
+		name:                e.name,
+		tagName:             e.tagName,
+		delimiter:           e.delimiter,
+		outputDelimiter:     e.outputDelimiter,
+		excerptSeparator:    e.excerptSeparator,
+		headerComment:       e.headerComment,
+		trailer:             e.trailer,
+		position:            e.position,
+		strictUnmarshal:     e.strictUnmarshal,
+		fenceValidation:     e.fenceValidation,
+		stripBOM:            e.stripBOM,
+		trimSpace:           e.trimSpace,
+		wholeDocument:       e.wholeDocument,
+		caseInsensitiveKeys: e.caseInsensitiveKeys,
+		preserveKeyCase:     e.preserveKeyCase,
+		textMarshalers:      e.textMarshalers,
+		rawDelimiters:       e.rawDelimiters,
+		lenientFallback:     e.lenientFallback,
+		strictFence:         e.strictFence,
+		strictSeparation:    e.strictSeparation,
+		trimDelimiterSpace:  e.trimDelimiterSpace,
+		crlfDelimiters:      e.crlfDelimiters,
+		allowShebang:        e.allowShebang,
+		stripShebang:        e.stripShebang,
+		keepPreamble:        e.keepPreamble,
+		validUTF8:           e.validUTF8,
+		maxSize:             e.maxSize,
+		tabWidth:            e.tabWidth,
+		scannerBufferSize:   e.scannerBufferSize,
+		contentSeparator:    e.contentSeparator,
+		fenceOpen:           e.fenceOpen,
+		fenceClose:          e.fenceClose,
+		noEmptySeparator:    e.noEmptySeparator,
+		omitEmptyMatter:     e.omitEmptyMatter,
+		sortedKeys:          e.sortedKeys,
+		timeLayouts:         e.timeLayouts,
+		bufPool:             e.bufPool,
+		inSplitFunc:         e.inSplitFunc,
+		marshalFunc:         e.marshalFunc,
+		unmarshalFunc:       e.unmarshalFunc,
+		strictUnmarshalFunc: e.strictUnmarshalFunc,
+		marshalFallbackFunc: e.marshalFallbackFunc,
+		preambleFunc:        e.preambleFunc,
+		delimiterFunc:       e.delimiterFunc,
+		expandFunc:          e.expandFunc,
+		includeFunc:         e.includeFunc,
+		includeKey:          e.includeKey,
+		rawMatterFunc:       e.rawMatterFunc,
+		warnFunc:            e.warnFunc,
+		keyEncodeFunc:       e.keyEncodeFunc,
+		keyDecodeFunc:       e.keyDecodeFunc,
+		fences:              e.fences,
+	}
+}
+
+// Reset drops the cached frontmatter encodings of e, and restores the split
+// state of e (the start and end delimiters and the split func) to the one
+// derived from its configuration. The configuration itself is kept. Reset
+// holds the cache lock while it runs, the same lock the cache lookups and
+// writes of the encode functions take. The split state is only written when
+// it differs from the configured one, and the encode and decode functions
+// never change it (per call options work on a copy of e), so Reset is safe
+// to call while e is in use.
+func (e *Encoding) Reset() {
+	e.fmBufMutex.Lock()
+	defer e.fmBufMutex.Unlock()
+
+	e.fmBuf = make(map[string][]byte)
+	if split := e.inSplitFunc(e.delimiter); e.start != split.Start || e.end != split.End {
+		e.start, e.end = split.Start, split.End
+		e.ioSplitFunc, e.frameFunc = split.SplitFunc, split.Frame
+	}
+}
+
+// init applies the options to e and derives the split and output settings
+// from the resulting configuration. The delimiter is validated once all of
+// the options are set.
+func (e *Encoding) init(options ...EncodingOptionFunc) (*Encoding, error) {
+	for _, o := range options {
+		if err := o(e); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := e.deriveMarshal(); err != nil {
+		return nil, err
+	}
+	if err := e.deriveSplit(); err != nil {
+		return nil, err
+	}
+
+	e.fmBuf = make(map[string][]byte) // initialize the caching map
+	return e, nil
+}
+
+// deriveMarshal derives the marshal func of e that sorts the object keys of
+// the metadata, when e has sorted keys, which are only for JSON encodings.
+func (e *Encoding) deriveMarshal() error {
+	e.sortedMarshalFunc = nil
+	if !e.sortedKeys {
+		return nil
+	}
+	if err := e.onlyJSON("WithSortedKeys"); err != nil {
+		return err
+	}
+
+	fn := e.marshalFunc
+	e.sortedMarshalFunc = func(v interface{}) ([]byte, error) {
+		b, err := json.Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+
+		var sorted interface{}
+		dec := json.NewDecoder(bytes.NewReader(b))
+		dec.UseNumber() // keep numbers as they were written
+		if err := dec.Decode(&sorted); err != nil {
+			return nil, err
+		}
+		return fn(sorted)
+	}
+	return nil
+}
+
+// deriveSplit derives the split and output settings of e from its delimiter
+// and split func. It returns an error, leaving e as it was, when the
+// delimiter isn't valid.
+func (e *Encoding) deriveSplit() error {
+	split, err := e.splitter()
+	if err != nil {
+		return err
+	}
+
+	e.start, e.end, e.ioSplitFunc = split.Start, split.End, split.SplitFunc
+	e.frameFunc = split.Frame
+	e.output.start, e.output.end = "", ""
+	if e.outputDelimiter {
+		// add to wrap the frontmatter metadata only if explicitly set to
+		e.output.start, e.output.end = e.start, e.end
+	}
+	e.splitSet = false
+	return nil
+}
+
+// splitter returns the Splitter of the split func of e for its delimiter.
+// It returns an error when the delimiter can't match a line, or the split
+// func panics on it (i.e. SpaceSeparatedTokenDelimiters of a delimiter
+// without a space). A whole document doesn't need a delimiter.
+func (e *Encoding) splitter() (split Splitter, err error) {
+	if !e.wholeDocument {
+		if err := checkDelimiter(e.delimiter); err != nil {
+			return split, err
+		}
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("particle: invalid delimiter %q: %v", e.delimiter, r)
+		}
+	}()
+	return e.inSplitFunc(e.delimiter), nil
+}
+
+// Decode decodes src using the encoding e. It writes bytes to dst and returns
+// the number of bytes written. If src contains invalid unmarshaled data, it
+// will return the number of bytes successfully written along with an error.
+//
+// When all of the content is written and it is shorter than dst, the number
+// of bytes written is returned with io.EOF. When the content fills dst
+// exactly, or is longer than dst (the rest of it is dropped), len(dst) is
+// returned with a nil error. Use DecodedLen to size dst.
+func (e *Encoding) Decode(dst, src []byte, v interface{}, opts ...DecodeOption) (int, error) {
+	e, err := e.withOptions(opts)
+	if err != nil {
+		return 0, err
+	}
+	if err := e.checkSize(len(src)); err != nil {
+		return 0, err
+	}
+
+	src = e.trimBOM(src)
+	if !e.hasFrontmatter(src) {
+		return copyFull(dst, e.trimContent(src)) // fast path
+	}
+
+	r, err := e.decode(bytes.NewReader(src), v)
+	if r == nil {
+		return 0, err
+	}
+	defer closeReader(r, io.ErrClosedPipe) // let the split goroutine finish
+
+	n, rerr := io.ReadFull(r, dst)
+	if err != nil {
+		return n, err // the content is written when unmarshaling fails
+	}
+
+	if rerr == io.ErrUnexpectedEOF {
+		rerr = io.EOF // all of the content was written, it was just short
+	}
+	return n, rerr
+}
+
+// DecodeString returns the bytes representing the string data of src without
+// the frontmatter. The interface v will contain the decoded frontmatter
+// metadata. It returns an error if the underlining marshaler returns an
+// error, along with the content that was split from the frontmatter.
+func (e *Encoding) DecodeString(src string, v interface{}, opts ...DecodeOption) ([]byte, error) {
+	e, err := e.withOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+	if err := e.checkSize(len(src)); err != nil {
+		return nil, err
+	}
+
+	b := e.trimBOM([]byte(src))
+	if !e.hasFrontmatter(b) {
+		return e.trimContent(b), nil // fast path
+	}
+
+	return e.DecodeReader(bytes.NewReader(b), v)
+}
+
+// DecodeFrontAndBack decodes the frontmatter block at the start of src to
+// front, and the backmatter block at the end of src (i.e. notes or a
+// bibliography) to back, returning the content between them. Either block
+// may be missing, then its value is left untouched, a lone block at the
+// start of src is always the frontmatter. The blocks use the same
+// format and delimiters, the position of e is not used.
+func (e *Encoding) DecodeFrontAndBack(src []byte, front, back interface{}, opts ...DecodeOption) ([]byte, error) {
+	e, err := e.withOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	h := e.Clone(WithPosition(HeaderPosition))
+	h.trimSpace = false // the backmatter is still at the end of the content
+
+	content, err := h.DecodeReader(bytes.NewReader(src), front)
+	if err != nil {
+		return content, err
+	}
+
+	return e.Clone(WithPosition(FooterPosition)).DecodeReader(bytes.NewReader(content), back)
+}
+
+// DecodePreview decodes the frontmatter metadata of src to interface v the
+// same as DecodeReader, but returns at most n bytes of the content, and
+// reports if the content was cut short. The rest of the content is never
+// copied. If unmarshaling fails the content is returned with the error.
+func (e *Encoding) DecodePreview(src []byte, v interface{}, n int, opts ...DecodeOption) (content []byte, truncated bool, err error) {
+	if e, err = e.withOptions(opts); err != nil {
+		return nil, false, err
+	}
+	if err := e.checkSize(len(src)); err != nil {
+		return nil, false, err
+	}
+
+	if n < 0 {
+		n = 0
+	}
+
+	b := e.trimBOM(src)
+	if !e.hasFrontmatter(b) {
+		b = e.trimContent(b) // fast path
+		if len(b) > n {
+			return b[:n], true, nil
+		}
+		return b, false, nil
+	}
+
+	r, err := e.decode(bytes.NewReader(b), v)
+	if r == nil {
+		return nil, false, err
+	}
+	defer closeReader(r, io.ErrClosedPipe) // let the split goroutine finish
+
+	// the content is never longer than b, so no more than that is
+	// allocated, and one more byte is read to see if there is more
+	limit := n
+	if limit > len(b) {
+		limit = len(b)
+	}
+	p := make([]byte, limit+1)
+	k, rerr := io.ReadFull(r, p)
+	if rerr == io.EOF || rerr == io.ErrUnexpectedEOF {
+		rerr = nil
+	}
+
+	if err == nil {
+		err = rerr
+	}
+	if k > n {
+		return p[:n], true, err
+	}
+	return p[:k], false, err
+}
+
+// DecodeStringContent decodes src the same as DecodeString, returning the
+// content as a string. When src has no frontmatter the content is a part of
+// src, it isn't copied. With WithValidUTF8 the content is checked, and
+// ErrInvalidUTF8 is returned with it if it isn't valid UTF-8.
+func (e *Encoding) DecodeStringContent(src string, v interface{}, opts ...DecodeOption) (string, error) {
+	e, err := e.withOptions(opts)
+	if err != nil {
+		return "", err
+	}
+	if err := e.checkSize(len(src)); err != nil {
+		return "", err
+	}
+
+	var content string
+	if b := e.trimBOM([]byte(src)); !e.hasFrontmatter(b) {
+		content = src[len(src)-len(b):] // fast path
+		if e.trimSpace {
+			content = strings.Trim(content, asciiSpace)
+		}
+	} else {
+		b, err := e.DecodeReader(bytes.NewReader(b), v)
+		if content = string(b); err != nil {
+			return content, err
+		}
+	}
+
+	if e.validUTF8 && !utf8.ValidString(content) {
+		return content, ErrInvalidUTF8
+	}
+	return content, nil
+}
+
+// Metadata decodes the frontmatter metadata of src to interface v, without
+// the content. The content is never split out or copied, so it is the
+// cheapest way to read just the metadata. v is left untouched when src has no
+// frontmatter.
+func (e *Encoding) Metadata(src []byte, v interface{}, opts ...DecodeOption) error {
+	e, err := e.withOptions(opts)
+	if err != nil {
+		return err
+	}
+
+	e = e.fenceFor(src)
+	if err := e.checkSize(len(src)); err != nil {
+		return err
+	}
+
+	src = e.trimBOM(src)
+	if !e.hasFrontmatter(src) {
+		return nil
+	}
+
+	var f []byte
+	if e.position == FooterPosition {
+		f, _ = e.splitFooter(src)
+	} else {
+		if f, _, err = e.scanFrontmatter(bytes.NewReader(src)); err != nil {
+			return err
+		}
+	}
+
+	_, err = e.unmarshalScanned(f, v)
+	return err
+}
+
+// StripFrontmatter returns the content of src without the frontmatter block.
+// The frontmatter is only split from the content, it is never unmarshaled,
+// so with WithLenientFallback a block that isn't valid metadata is removed
+// all the same. The returned slice shares the memory of src.
+func (e *Encoding) StripFrontmatter(src []byte, opts ...DecodeOption) ([]byte, error) {
+	e, err := e.withOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	e = e.fenceFor(src)
+	if err := e.checkSize(len(src)); err != nil {
+		return nil, err
+	}
+
+	b := e.trimBOM(src)
+	switch {
+	case e.wholeDocument:
+		return b[len(b):], nil
+	case e.position == FooterPosition:
+		_, content := e.splitFooter(b)
+		return e.trimContent(content), nil
+	case !e.hasFrontmatter(b):
+		return e.trimContent(b), nil // fast path
+	}
+
+	_, offset, err := e.scanFrontmatter(bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+
+	if n := e.shebangLen(b); n > 0 && e.keepShebang() {
+		return e.trimContent(append(b[:n:n], b[offset:]...)), nil
+	}
+	if n := len(b) - len(e.skipPreamble(b)); n > 0 && offset > 0 && e.keepPreamble {
+		return e.trimContent(append(b[:n:n], b[offset:]...)), nil
+	}
+	return e.trimContent(b[offset:]), nil
+}
+
+// DecodeReader returns the bytes representing the data collected from reader
+// r without frontmatter metadata. The interface v will contain the decoded
+// frontmatter metadata. When the frontmatter is split from the content, but
+// unmarshaling it fails, the content is returned along with the error. A
+// *bufio.Reader r is read in place, the opening delimiter is peeked and the
+// block is split out of its buffer, so the bytes aren't buffered twice.
+func (e *Encoding) DecodeReader(r io.Reader, v interface{}, opts ...DecodeOption) ([]byte, error) {
+	e, err := e.withOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	r, err = e.decode(r, v)
+	if r == nil {
+		return nil, err
+	}
+
+	b, rerr := ioutil.ReadAll(r)
+	if err != nil {
+		return b, err
+	}
+	return b, rerr
+}
+
+// DecodeReaderCompressed is DecodeReader for a reader r that may be gzip
+// compressed (i.e. a .md.gz file). A gzip stream is detected by its magic
+// bytes and decompressed before it is decoded, any other input is decoded
+// as it is.
+func (e *Encoding) DecodeReaderCompressed(r io.Reader, v interface{}, opts ...DecodeOption) ([]byte, error) {
+	br, ok := r.(*bufio.Reader)
+	if !ok {
+		br = bufio.NewReader(r)
+	}
+	if magic, _ := br.Peek(len(gzipMagic)); !bytes.Equal(magic, gzipMagic) {
+		return e.DecodeReader(br, v, opts...)
+	}
+
+	zr, err := gzip.NewReader(br)
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+
+	return e.DecodeReader(zr, v, opts...)
+}
+
+// DecodeRaw splits src into the raw frontmatter metadata and the content,
+// without unmarshaling the metadata. The metadata is nil when src has no
+// frontmatter.
+func (e *Encoding) DecodeRaw(src []byte, opts ...DecodeOption) (matter, content []byte, err error) {
+	if e, err = e.withOptions(opts); err != nil {
+		return nil, nil, err
+	}
+
+	e = e.fenceFor(src)
+	matter, content, err = e.splitAll(bytes.NewReader(src))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if matter != nil && e.rawDelimiters && !e.wholeDocument {
+		inner := strings.TrimSuffix(strings.TrimPrefix(string(matter), e.output.start), e.output.end)
+		switch block, ok := e.rawBlock(src, inner); {
+		case ok:
+			matter = block
+		case inner == "" && e.position == HeaderPosition:
+			matter = nil // the delimiter didn't open a block after all
+		default:
+			matter = []byte(e.start + "\n" + inner + "\n" + e.end + "\n")
+		}
+	}
+	return matter, content, nil
+}
+
+// rawBlock returns the frontmatter block of src, with the metadata inner, as
+// it is in src: the opening delimiter line, the metadata and the closing
+// delimiter line, with their line endings (i.e. "\r\n") kept. It reports
+// false when the block isn't found at the start of src, after any preamble,
+// or isn't at the start at all (i.e. the FooterPosition).
+func (e *Encoding) rawBlock(src []byte, inner string) ([]byte, bool) {
+	if e.position != HeaderPosition {
+		return nil, false
+	}
+
+	b := src
+	if e.stripBOM {
+		b = bytes.TrimPrefix(b, utf8BOM)
+	}
+	b = e.skipPreamble(b)
+
+	n := bytes.IndexByte(b, '\n') + 1
+	if n == 0 || !e.isDelimiterLine(b[:n], e.start) || !bytes.HasPrefix(b[n:], []byte(inner)) {
+		return nil, false
+	}
+	n += len(inner)
+
+	if inner != "" {
+		switch {
+		case bytes.HasPrefix(b[n:], []byte("\r\n")):
+			n += 2
+		case bytes.HasPrefix(b[n:], []byte("\n")):
+			n++
+		default:
+			return nil, false
+		}
+	}
+
+	end := len(b)
+	if i := bytes.IndexByte(b[n:], '\n'); i >= 0 {
+		end = n + i + 1
+	}
+	if !e.isDelimiterLine(b[n:end], e.end) {
+		return nil, false
+	}
+	return b[:end], true
+}
+
+// splitAll reads all of the raw frontmatter metadata and the content of r.
+// The metadata is nil when r has no frontmatter.
+func (e *Encoding) splitAll(r io.Reader) (matter, content []byte, err error) {
+	m, o, err := e.split(r)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if m != nil {
+		if matter, err = ioutil.ReadAll(m); err != nil {
+			closeReader(o, err)
+			return nil, nil, err
+		}
+	}
+
+	if e.trimSpace {
+		o = &trimSpaceReader{r: o}
+	}
+
+	if content, err = ioutil.ReadAll(o); err != nil {
+		return nil, nil, err
+	}
+	return matter, content, nil
+}
+
+// DecodeDiscriminated decodes the frontmatter metadata of src to a value
+// chosen by the metadata itself. The value of the top level key field is
+// looked up in registry, and the metadata is unmarshaled to the value that
+// the matching func returns. It returns the value, and the bytes of src
+// without the frontmatter. It returns an error wrapping ErrNoDiscriminator
+// when there is no field, or ErrUnknownDiscriminator when no func matches.
+func (e *Encoding) DecodeDiscriminated(src []byte, field string, registry map[string]func() interface{}, opts ...DecodeOption) (interface{}, []byte, error) {
+	e, err := e.withOptions(opts)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	e = e.fenceFor(src)
+	matter, content, err := e.splitAll(bytes.NewReader(src))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	m := make(map[string]interface{})
+	if matter != nil {
+		if err := e.rawMatter(matter); err != nil {
+			return nil, nil, err
+		}
+		if err := e.unmarshal(matter, &m); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	kind, ok := m[field]
+	if !ok || kind == nil {
+		return nil, nil, fmt.Errorf("%w: %q", ErrNoDiscriminator, field)
+	}
+
+	fn, ok := registry[fmt.Sprint(kind)]
+	if !ok {
+		return nil, nil, fmt.Errorf("%w: %s %q", ErrUnknownDiscriminator, field, fmt.Sprint(kind))
+	}
+
+	v := fn()
+	if err := e.unmarshal(matter, v); err != nil {
+		return nil, nil, err
+	}
+	return v, content, nil
+}
+
+// DecodeToWriters splits the frontmatter from the content of r in a single
+// pass, copying the raw frontmatter metadata to matterW and the content to
+// contentW, without unmarshaling the metadata. Neither is held in memory. It
+// returns the number of bytes written to each writer.
+func (e *Encoding) DecodeToWriters(r io.Reader, matterW, contentW io.Writer, opts ...DecodeOption) (int64, int64, error) {
+	e, err := e.withOptions(opts)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	m, o, err := e.split(r)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	var nm int64
+	if m != nil {
+		if nm, err = io.Copy(matterW, m); err != nil {
+			closeReader(o, err) // let the split goroutine finish
+			return nm, 0, err
+		}
+	}
+
+	if e.trimSpace {
+		o = &trimSpaceReader{r: o}
+	}
+
+	nc, err := io.Copy(contentW, o)
+	return nm, nc, err
+}
+
+// DecodeTo decodes the frontmatter metadata of r to interface v, and copies
+// the content that follows it to contentW as it is read from r, so the
+// content is never held in memory. It returns once r is exhausted. When
+// unmarshaling the metadata fails, the content is still copied and the
+// unmarshal error is returned.
+func (e *Encoding) DecodeTo(r io.Reader, v interface{}, contentW io.Writer, opts ...DecodeOption) error {
+	e, err := e.withOptions(opts)
+	if err != nil {
+		return err
+	}
+
+	r, err = e.decode(r, v)
+	if r == nil {
+		return err
+	}
+
+	if _, cerr := io.Copy(contentW, r); cerr != nil {
+		closeReader(r, cerr) // let the split goroutine finish
+		if err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// Result holds the outcome of DecodeMatched.
+type Result struct {
+	// Content is the bytes of the input without the frontmatter.
+	Content []byte
+
+	// Matched reports whether the input had a frontmatter block, even an
+	// empty one (i.e. "---\n---\n").
+	Matched bool
+}
+
+// DecodeMatched decodes src the same as DecodeReader, and also reports if
+// src had a frontmatter block. An empty block is matched, and leaves v
+// untouched without an error.
+func (e *Encoding) DecodeMatched(src []byte, v interface{}, opts ...DecodeOption) (Result, error) {
+	e, err := e.withOptions(opts)
+	if err != nil {
+		return Result{}, err
+	}
+
+	content, err := e.DecodeReader(bytes.NewReader(src), v)
+	if err != nil {
+		return Result{Content: content}, err
+	}
+	return Result{Content: content, Matched: e.matched(src, v)}, nil
+}
+
+// matched reports whether src has a frontmatter block that is decoded as
+// frontmatter, rather than left in the content.
+func (e *Encoding) matched(src []byte, v interface{}) bool {
+	e = e.fenceFor(src)
+	src = e.trimBOM(src)
+	if !e.hasFrontmatter(src) {
+		return false
+	}
+
+	var f []byte
+	switch {
+	case e.wholeDocument:
+		return true
+	case e.position == FooterPosition:
+		f, _ = e.splitFooter(src)
+	default:
+		f, _, _ = e.scanFrontmatter(bytes.NewReader(src))
+	}
+
+	if f == nil {
+		return false
+	}
+	e = e.resolveOnce()
+	return !(e.fenceValidation && !e.isMapping(f)) && !(e.lenientFallback && !e.unmarshals(f, v))
+}
+
+// DecodeFile returns the bytes of the named file without the frontmatter.
+// The interface v will contain the decoded frontmatter metadata.
+func (e *Encoding) DecodeFile(name string, v interface{}, opts ...DecodeOption) ([]byte, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return e.DecodeReader(f, v, opts...)
+}
+
+// DecodeSeeker decodes the frontmatter metadata from the current position of
+// rs to interface v, and returns a seekable view of the content. The view is
+// positioned at the start of the content, and offsets within it are relative
+// to the start of the content. Only the frontmatter is read from rs, the
+// content is not copied. Content options such as WithTrimSpace are not
+// applied to the view. With FooterPosition all of rs is read, and the view is
+// over a copy of the content.
+func (e *Encoding) DecodeSeeker(rs io.ReadSeeker, v interface{}, opts ...DecodeOption) (io.ReadSeeker, error) {
+	e, err := e.withOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	if e.position == FooterPosition {
+		b, err := e.DecodeReader(rs, v)
+		if err != nil {
+			return nil, err
+		}
+		return bytes.NewReader(b), nil
+	}
+
+	base, err := rs.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, err
+	}
+
+	if e.fences != nil {
+		p := make([]byte, e.fencePeekLen())
+		n, _ := io.ReadFull(rs, p)
+		if _, err := rs.Seek(base, io.SeekStart); err != nil {
+			return nil, err
+		}
+		e = e.fenceFor(p[:n])
+	}
+
+	if e.stripBOM {
+		p := make([]byte, len(utf8BOM))
+		if n, _ := io.ReadFull(rs, p); bytes.Equal(p[:n], utf8BOM) {
+			base += int64(n)
+		}
+		if _, err := rs.Seek(base, io.SeekStart); err != nil {
+			return nil, err
+		}
+	}
+
+	f, offset, err := e.scanFrontmatter(rs)
+	if err != nil {
+		return nil, err
+	}
+
+	if ok, err := e.unmarshalScanned(f, v); err != nil {
+		return nil, err
+	} else if !ok {
+		offset = 0 // the block is content
+	}
+
+	if _, err := rs.Seek(base+offset, io.SeekStart); err != nil {
+		return nil, err
+	}
+	return &offsetSeeker{rs: rs, base: base + offset}, nil
+}
+
+// scanFrontmatter scans the frontmatter metadata from r, and returns it along
+// with the offset in r where the content starts. The content is never
+// scanned. The metadata is nil if there is no frontmatter.
+func (e *Encoding) scanFrontmatter(r io.Reader) (frontmatter []byte, offset int64, err error) {
+	if e.wholeDocument {
+		frontmatter, err = ioutil.ReadAll(r)
+		return frontmatter, int64(len(frontmatter)), err
+	}
+
+	r, pre, ok := e.peekFrontmatter(r)
+	if !ok {
+		return nil, 0, nil
+	}
+
+	var trimmed *delimiterSpaceReader
+	if e.rewritesDelimiters() {
+		trimmed = &delimiterSpaceReader{r: bufio.NewReader(r), e: e}
+		r = trimmed
+		defer func() { offset += trimmed.n }() // the trimmed bytes come before the content
+	}
+
+	var last int64
+	offset = int64(len(pre))
+	split := e.splitFunc()
+
+	scnr := e.newScanner(r, func(data []byte, atEOF bool) (int, []byte, error) {
+		advance, token, err := split(data, atEOF)
+		last, offset = offset, offset+int64(advance)
+		return advance, token, err
+	})
+
+	if !scnr.Scan() || scnr.Text() != e.delimiter {
+		if err := scnr.Err(); err != nil || !e.strictSeparation {
+			return nil, 0, err
+		}
+		return nil, 0, e.notSeparated(true)
+	}
+
+	frontmatter = []byte(e.output.start)
+	for scnr.Scan() {
+		if scnr.Text() == e.delimiter {
+			frontmatter = append(frontmatter, e.output.end...)
+			if scnr.Scan() {
+				return frontmatter, last, nil
+			}
+			return frontmatter, offset, scnr.Err()
+		}
+		frontmatter = append(frontmatter, scnr.Bytes()...)
+	}
+
+	if err := scnr.Err(); err != nil || !e.strictSeparation {
+		return nil, 0, err // the block was never closed, so it is content
+	}
+	return nil, 0, e.notSeparated(false)
+}
+
+// notSeparated returns the ErrNotSeparated error for a block whose opening
+// delimiter isn't on a line of its own when open is true, or that has no
+// closing delimiter line.
+func (e *Encoding) notSeparated(open bool) error {
+	if open {
+		return fmt.Errorf("%w: the opening delimiter %q is not on a line of its own", ErrNotSeparated, e.start)
+	}
+	return fmt.Errorf("%w: no closing delimiter %q on a line of its own", ErrNotSeparated, e.end)
+}
+
+// unmarshalScanned unmarshals the frontmatter metadata f found by
+// scanFrontmatter to interface v. It reports false when there is no metadata,
+// or the block is left as content by fence validation or lenient fallback.
+func (e *Encoding) unmarshalScanned(f []byte, v interface{}) (bool, error) {
+	e = e.resolveOnce()
+	if f == nil || (e.fenceValidation && !e.isMapping(f)) || (e.lenientFallback && !e.unmarshalsOrWarn(f, v)) {
+		return false, nil
+	}
+	if err := e.rawMatter(f); err != nil {
+		return true, err
+	}
+	return true, e.unmarshal(f, v)
+}
+
+// DecodeReaderAt decodes the frontmatter metadata at the start of ra to
+// interface v, and returns the offset in ra where the content starts, so the
+// content can be read separately (i.e. with an io.SectionReader). Only a
+// prefix of ra is read, starting with probe bytes, and doubling until the
+// whole frontmatter block fits. The offset is zero when there is no
+// frontmatter. It does not support FooterPosition, as the block is at the
+// end of ra.
+func (e *Encoding) DecodeReaderAt(ra io.ReaderAt, probe int, v interface{}, opts ...DecodeOption) (int64, error) {
+	e, err := e.withOptions(opts)
+	if err != nil {
+		return 0, err
+	}
+
+	if e.position == FooterPosition {
+		return 0, errors.New("particle: DecodeReaderAt does not support footer frontmatter")
+	}
+
+	if probe <= 0 {
+		probe = 4096
+	}
+
+	for {
+		p := make([]byte, probe)
+		n, err := ra.ReadAt(p, 0)
+		if err != nil && err != io.EOF {
+			return 0, err
+		}
+		p, eof := p[:n], n < probe || err == io.EOF
+		e := e.fenceFor(p)
+
+		var base int64
+		if e.stripBOM && bytes.HasPrefix(p, utf8BOM) {
+			p, base = p[len(utf8BOM):], int64(len(utf8BOM))
+		}
+
+		f, offset, err := e.scanFrontmatter(bytes.NewReader(p))
+		if err != nil && !(errors.Is(err, ErrNotSeparated) && !eof) {
+			return 0, err
+		}
+
+		// the end of the prefix can look like the end of the input to the
+		// scanner, so the block only counts when there are bytes after it
+		switch {
+		case f != nil && (eof || offset+2 <= int64(len(p))):
+			if ok, err := e.unmarshalScanned(f, v); err != nil || !ok {
+				return 0, err
+			}
+			return base + offset, nil
+		case f == nil && (eof || !e.mayHaveFrontmatter(p)):
+			return 0, nil // there is no frontmatter
+		}
+		probe *= 2
+	}
+}
+
+// mayHaveFrontmatter reports whether the prefix p of an input could still
+// start with a frontmatter block, which is the case until the first line
+// after any preamble has been read, and doesn't start with the delimiter.
+func (e *Encoding) mayHaveFrontmatter(p []byte) bool {
+	rest := e.skipPreamble(p)
+	return e.wholeDocument || e.opens(rest) || bytes.IndexByte(rest, '\n') < 0
+}
+
+// offsetSeeker is a view of rs that starts at base.
+type offsetSeeker struct {
+	rs   io.ReadSeeker
+	base int64
+}
+
+func (o *offsetSeeker) Read(p []byte) (int, error) { return o.rs.Read(p) }
+
+func (o *offsetSeeker) Seek(offset int64, whence int) (int64, error) {
+	if whence == io.SeekStart {
+		offset += o.base
+	}
+
+	n, err := o.rs.Seek(offset, whence)
+	if err != nil {
+		return n - o.base, err
+	}
+
+	if n < o.base {
+		o.rs.Seek(o.base, io.SeekStart)
+		return 0, errors.New("particle: seek to a negative position")
+	}
+	return n - o.base, nil
+}
+
+// DecodeStringMap returns the decoded frontmatter metadata of src as a
+// generic map along with the bytes of the content. The concrete types of the
+// map values depend on the underlying unmarshaler:
+//
+//	YAML: integers are int, floats are float64 and nested maps are
+//	      map[interface{}]interface{}
+//	TOML: integers are int64, floats are float64, datetimes are time.Time
+//	      and nested tables are map[string]interface{}
+//	JSON: all numbers are float64 and nested objects are
+//	      map[string]interface{}
+func (e *Encoding) DecodeStringMap(src string, opts ...DecodeOption) (map[string]interface{}, []byte, error) {
+	m := make(map[string]interface{})
+	b, err := e.DecodeString(src, &m, opts...)
+	if err != nil {
+		return nil, b, err
+	}
+	return m, b, nil
+}
+
+// DecodeLocated decodes src the same as DecodeReader, and also returns the
+// location of the frontmatter metadata in src. The location is the zero
+// Location if there is no frontmatter, or the frontmatter is not placed at
+// the start of src.
+func (e *Encoding) DecodeLocated(src []byte, v interface{}, opts ...DecodeOption) (content []byte, loc Location, err error) {
+	if e, err = e.withOptions(opts); err != nil {
+		return nil, Location{}, err
+	}
+
+	content, err = e.DecodeReader(bytes.NewReader(src), v)
+	if err != nil {
+		return content, Location{}, err
+	}
+	return content, e.locate(src), nil
+}
+
+// locate scans src with the split function of e, tracking the offsets of the
+// scanned tokens to find the location of the frontmatter metadata. Scanning
+// stops after the closing delimiter, so the content is never scanned.
+func (e *Encoding) locate(src []byte) (loc Location) {
+	e = e.fenceFor(src)
+	if e.wholeDocument && len(src) > 0 {
+		loc = Location{Start: 0, End: len(src), LineStart: 1}
+		loc.LineEnd = 1 + bytes.Count(bytes.TrimSuffix(src, []byte("\n")), []byte("\n"))
+		return loc
+	}
+
+	if e.position == FooterPosition || !e.hasFrontmatter(src) {
+		return loc
+	}
+
+	// the offsets start after any preamble lines
+	var offset, last = len(src) - len(e.skipPreamble(src)), 0
+	split := e.splitFunc()
+
+	scnr := e.newScanner(bytes.NewReader(src[offset:]), func(data []byte, atEOF bool) (int, []byte, error) {
+		advance, token, err := split(data, atEOF)
+		last, offset = offset, offset+advance
+		return advance, token, err
+	})
+
+	if !scnr.Scan() || scnr.Text() != e.delimiter {
+		return loc
+	}
+
+	loc.Start = offset
+	if e.outputDelimiter {
+		loc.Start = last
+	}
+
+	for scnr.Scan() {
+		if scnr.Text() != e.delimiter {
+			continue
+		}
+
+		loc.End = last
+		if e.outputDelimiter {
+			loc.End = last + bytes.Index(src[last:], []byte(e.end)) + len(e.end)
+		}
+
+		loc.LineStart = bytes.Count(src[:loc.Start], []byte("\n")) + 1
+		loc.LineEnd = loc.LineStart + bytes.Count(src[loc.Start:loc.End], []byte("\n"))
+		if loc.End > loc.Start && src[loc.End-1] == '\n' {
+			loc.LineEnd--
+		}
+		return loc
+	}
+
+	return Location{} // the frontmatter block was never closed
+}
+
+// DecodeWithExcerpt decodes src the same as DecodeReader, then splits the
+// content on the first line that matches the excerpt separator. The text
+// before the separator is returned as the excerpt and the text after it as
+// the content. If there is no separator the excerpt is empty and the content
+// is returned whole.
+func (e *Encoding) DecodeWithExcerpt(src []byte, v interface{}, opts ...DecodeOption) (excerpt, content []byte, err error) {
+	if e, err = e.withOptions(opts); err != nil {
+		return nil, nil, err
+	}
+
+	b, err := e.DecodeReader(bytes.NewReader(src), v)
+	excerpt, content = e.splitExcerpt(b)
+	return excerpt, content, err
+}
+
+// splitExcerpt splits the content b on the first excerpt separator line.
+func (e *Encoding) splitExcerpt(b []byte) (excerpt, content []byte) {
+	if e.excerptSeparator == "" {
+		return nil, b
+	}
+
+	sep := []byte(e.excerptSeparator)
+	for i := 0; i < len(b); {
+		n := bytes.IndexByte(b[i:], '\n')
+		line, next := b[i:], len(b)
+		if n >= 0 {
+			line, next = b[i:i+n], i+n+1
+		}
+
+		if bytes.Equal(line, sep) {
+			return b[:i], b[next:]
+		}
+		i = next
+	}
+
+	return nil, b
+}
+
+// EncodeToString returns the frontmatter encoding of type e Encoding before
+// the data bytes of src populated with the data of interface v. Like Encode,
+// it panics if an option fails or v can't be marshaled.
+func (e *Encoding) EncodeToString(src []byte, v interface{}, opts ...DecodeOption) string {
+	e, err := e.withOptions(opts)
+	if err != nil {
+		panic(err)
+	}
+
+	b := make([]byte, e.EncodeLen(src, v))
+	e.Encode(b, src, v)
+	return string(b)
+}
+
+// Encode encodes src using the encoding e, writing EncodedLen(len(encoded
+// frontmatter)+len(src)) bytes to dst. It panics if an option fails or v
+// can't be marshaled, use AppendEncode to have the error returned.
+func (e *Encoding) Encode(dst, src []byte, v interface{}, opts ...DecodeOption) {
+	e, err := e.withOptions(opts)
+	if err != nil {
+		panic(err)
+	}
+
+	f, err := e.encodeFrontmatter(v)
+	if err != nil {
+		panic(err)
+	}
+	f = e.separated(f, len(src) == 0)
+
+	b := e.getBuffer()
+	defer e.putBuffer(b)
+
+	if e.position == FooterPosition {
+		b.Write(src)
+		b.Write(f)
+	} else {
+		n := e.contentPreambleLen(src)
+		b.Write(src[:n])
+		b.Write(f)
+		b.Write(src[n:])
+	}
+
+	io.ReadFull(b, dst)
+}
+
+// AppendEncode appends the frontmatter encoding of v and src to dst and
+// returns the extended buffer. Unlike Encode the frontmatter is marshaled
+// only once, and any marshaling error is returned instead of panicking.
+func (e *Encoding) AppendEncode(dst, src []byte, v interface{}, opts ...DecodeOption) ([]byte, error) {
+	e, err := e.withOptions(opts)
+	if err != nil {
+		return dst, err
+	}
+
+	f, err := e.encodeFrontmatter(v)
+	if err != nil {
+		return dst, err
+	}
+	f = e.separated(f, len(src) == 0)
+
+	if e.position == FooterPosition {
+		return append(append(dst, src...), f...), nil
+	}
+	n := e.contentPreambleLen(src)
+	return append(append(append(dst, src[:n]...), f...), src[n:]...), nil
+}
+
+// contentPreambleLen returns the length of the preamble lines at the start
+// of the content src that are written before the block, when e keeps the
+// preamble in the content.
+func (e *Encoding) contentPreambleLen(src []byte) int {
+	if !e.keepPreamble || e.wholeDocument {
+		return 0
+	}
+	return len(src) - len(e.skipPreamble(src))
+}
+
+// EncodedLen returns the length in bytes of the frontmatter encoding of an
+// input buffer and frontmatter metadata of interface i of length n. The
+// marshaled frontmatter is kept for the next Encode of the same metadata, so
+// it isn't marshaled again, even if the cache was Reset in between.
+func (e *Encoding) EncodeLen(src []byte, v interface{}, opts ...DecodeOption) int {
+	e, err := e.withOptions(opts)
+	if err != nil {
+		panic(err)
+	}
+
+	h := e.hashFrontmatter(v)
+	f, err := e.encodeHashed(h, v)
+	if err != nil {
+		panic(err)
+	}
+
+	e.fmBufMutex.Lock()
+	e.fmLen = &encodedLen{h: h, f: f}
+	e.fmBufMutex.Unlock()
+	return len(e.separated(f, len(src) == 0)) + len(src)
+}
+
+// DecodedLen returns the length in bytes of the content that Decode writes
+// for src. The frontmatter is split from the content without unmarshaling
+// the metadata.
+func (e *Encoding) DecodedLen(src []byte) (int, error) {
+	n, err := e.copyContent(ioutil.Discard, src)
+	return int(n), err
+}
+
+// ContentHash writes the content of src, without the frontmatter, to h and
+// returns the sum of h, so files that only differ in their metadata (i.e. an
+// updated date) have the same hash. The content is split from the
+// frontmatter the same as Decode, without unmarshaling the metadata, and
+// with the same whitespace trimming. The content is added to what h already
+// holds, h isn't Reset.
+func (e *Encoding) ContentHash(src []byte, h hash.Hash) ([]byte, error) {
+	if _, err := e.copyContent(h, src); err != nil {
+		return nil, err
+	}
+	return h.Sum(nil), nil
+}
+
+// copyContent writes the content of src that Decode writes to w, splitting
+// the frontmatter from the content without unmarshaling the metadata.
+func (e *Encoding) copyContent(w io.Writer, src []byte) (int64, error) {
+	if err := e.checkSize(len(src)); err != nil {
+		return 0, err
+	}
+
+	src = e.trimBOM(src)
+	if !e.hasFrontmatter(src) {
+		n, err := w.Write(e.trimContent(src)) // fast path
+		return int64(n), err
+	}
+
+	m, o, err := e.split(bytes.NewReader(src))
+	if err != nil {
+		return 0, err
+	}
+
+	if m != nil {
+		io.Copy(ioutil.Discard, m) // the metadata comes before the content
+	}
+
+	if e.trimSpace {
+		o = &trimSpaceReader{r: o}
+	}
+	return io.Copy(w, o)
+}
+
+// hashFrontmatter returns a very simple hash of the interface v with data.
+func (e *Encoding) hashFrontmatter(v interface{}) string {
+	// this hash is pretty slow and weak, but it should be good enough for our
+	// purposes in this function.
+	h := md5.Sum([]byte(fmt.Sprintf("%#v", v)))
+	return string(h[:])
+}
+
+// encodeFrontmatter marshals the data from interface v to frontmatter
+// metadata. The result is cached, therefore it can be called multiple times
+// with little performance hit.
+func (e *Encoding) encodeFrontmatter(v interface{}) ([]byte, error) {
+	return e.encodeHashed(e.hashFrontmatter(v), v)
+}
+
+// encodeHashed does the work of encodeFrontmatter for the metadata of
+// interface v with the hash h.
+func (e *Encoding) encodeHashed(h string, v interface{}) ([]byte, error) {
+	e.fmBufMutex.Lock()
+	if l := e.fmLen; l != nil && l.h == h {
+		e.fmLen = nil // only once
+		e.fmBufMutex.Unlock()
+		return l.f, nil
+	}
+	f, ok := e.fmBuf[h]
+	e.fmBufMutex.Unlock()
+
+	if ok {
+		return f, nil
+	}
+
+	f, err := e.marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	var b []byte
+	if !e.omitEmptyMatter || !isEmptyMatter(v, f) {
+		b = e.frame(f)
+	}
+
+	// the lock here is to make this function concurrency safe.
+	e.fmBufMutex.Lock()
+	e.fmBuf[h] = b
+	e.fmBufMutex.Unlock()
+	return b, nil
+}
+
+// frame returns the frontmatter block of e for the marshaled metadata f. It
+// is the frame func of the split func, if it has one, so a binary format
+// controls its own framing. Otherwise f is written between the delimiter
+// lines, with the separator between the block and the content.
+func (e *Encoding) frame(f []byte) []byte {
+	if e.frameFunc != nil {
+		return e.frameFunc(f)
+	}
+
+	var start, end string
+	if !e.outputDelimiter {
+		start, end = e.start+"\n", e.end
+		if e.fenceOpen != nil {
+			start = e.start + string(e.fenceOpen)
+		}
+		if e.fenceClose != nil {
+			f = append(bytes.TrimRight(f, "\r\n"), e.fenceClose...)
+		}
+	}
+
+	sep := e.separator()
+	end += "\n"
+	if e.position == FooterPosition {
+		start = sep + start
+	} else {
+		end += sep
+	}
+
+	if e.wholeDocument {
+		start, end = "", "" // just the metadata, without any fences
+	} else if e.position == HeaderPosition {
+		start = e.headerComment + start
+	}
+	return append(append([]byte(start), f...), end...)
+}
+
+// isEmptyMatter reports whether the metadata v, which marshals to f, is
+// empty, see WithOmitEmptyFrontmatter.
+func isEmptyMatter(v interface{}, f []byte) bool {
+	switch string(bytes.TrimSpace(f)) {
+	case "", "{}", "null":
+		return true
+	}
+
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Ptr || rv.Kind() == reflect.Interface {
+		if rv.IsNil() {
+			return true
+		}
+		rv = rv.Elem()
+	}
+
+	switch rv.Kind() {
+	case reflect.Invalid:
+		return true
+	case reflect.Map, reflect.Slice:
+		return rv.Len() == 0
+	case reflect.Struct:
+		return rv.IsZero()
+	}
+	return false
+}
+
+// separator returns the text between the frontmatter and the content of e.
+// A header is separated from the content after it by a blank line, and a
+// footer from the content before it, unless another separator is set.
+func (e *Encoding) separator() string {
+	if e.contentSeparator != nil {
+		return string(e.contentSeparator)
+	}
+	return "\n"
+}
+
+// separated returns the encoded frontmatter f to write with the content src,
+// which is f without the separator when src is empty, if e drops it.
+func (e *Encoding) separated(f []byte, empty bool) []byte {
+	if !e.noEmptySeparator || !empty || e.wholeDocument || e.frameFunc != nil {
+		return f
+	}
+
+	if e.position == FooterPosition {
+		return bytes.TrimPrefix(f, []byte(e.separator()))
+	}
+	return bytes.TrimSuffix(f, []byte(e.separator()))
+}
+
+// decode splits r into frontmatter metadata and content, unmarshals the
+// metadata to interface v and returns the content reader. All of the decode
+// functions go through here. If unmarshaling fails the content reader is
+// returned with the error, it must be read to the end or closed with
+// closeReader.
+func (e *Encoding) decode(r io.Reader, v interface{}) (io.Reader, error) {
+	e, r = e.fenceReader(r)
+	o, err := e.decodeSplit(r, v)
+	if o == nil || !e.trimSpace {
+		return o, err
+	}
+	return &trimSpaceReader{r: o}, err
+}
+
+// decodeSplit does the work of decode, returning the content as it was split
+// from the frontmatter.
+func (e *Encoding) decodeSplit(r io.Reader, v interface{}) (io.Reader, error) {
+	e = e.resolveOnce()
+
+	var valid func([]byte) bool
+	if e.lenientFallback {
+		valid = func(f []byte) bool { return e.unmarshalsOrWarn(f, v) }
+	}
+
+	m, o, err := e.splitValid(r, valid)
+	if err != nil {
+		return nil, err
+	}
+
+	if m == nil {
+		return o, nil // fast path, there is no frontmatter
+	}
+
+	if err := e.readUnmarshal(m, v); err != nil {
+		return o, err // the content can still be read
+	}
+	return o, nil
+}
+
+// closeReader closes r with err if it can be, so that a goroutine that is
+// writing to r stops.
+func closeReader(r io.Reader, err error) {
+	if t, ok := r.(*trimSpaceReader); ok {
+		r = t.r
+	}
+	if s, ok := r.(*shebangReader); ok {
+		r = s.r
+	}
+	if c, ok := r.(*io.PipeReader); ok {
+		c.CloseWithError(err)
+	}
+}
+
+// split separates r into a frontmatter metadata reader and a content reader
+// without unmarshaling anything. The metadata reader is nil when r has no
+// frontmatter. The metadata reader must be read before the content reader
+// makes any progress.
+func (e *Encoding) split(r io.Reader) (io.Reader, io.Reader, error) {
+	e, r = e.fenceReader(r)
+	return e.splitValid(r, nil)
+}
+
+// splitValid does the work of split. When valid is not nil, the frontmatter
+// metadata is only split out when valid reports true for it, otherwise all
+// of r is returned as content.
+func (e *Encoding) splitValid(r io.Reader, valid func([]byte) bool) (io.Reader, io.Reader, error) {
+	if e.maxSize > 0 {
+		r = &maxSizeReader{r: r, n: e.maxSize}
+	}
+
+	if e.stripBOM {
+		r = e.trimBOMReader(r)
+	}
+
+	var line []byte
+	if e.keepShebang() {
+		line, r = e.takeShebang(r)
+	}
+
+	r, pre, ok := e.peekFrontmatter(r)
+	if !ok {
+		return nil, keepShebang(line, r), nil
+	}
+
+	if e.rewritesDelimiters() {
+		r = &delimiterSpaceReader{r: bufio.NewReader(r), e: e}
+	}
+
+	if e.fenceValidation || valid != nil {
+		m, o, err := e.splitValidated(pre, r, valid)
+		return m, keepShebang(line, o), err
+	}
+
+	m, o := e.readFromPreamble(pre, r)
+	return m, keepShebang(line, o), nil
+}
+
+// keepShebang returns a reader of the "#!" line before the content o, or o
+// when there is no line.
+func keepShebang(line []byte, o io.Reader) io.Reader {
+	if line == nil || o == nil {
+		return o
+	}
+	return &shebangReader{line: line, r: o}
+}
+
+// splitValidated buffers all of r so that when the leading block doesn't
+// parse as a metadata mapping (with fence validation), or valid reports false
+// for it, the block is treated as content, and all of r is returned
+// untouched, along with the preamble lines pre that were read before r.
+func (e *Encoding) splitValidated(pre []byte, r io.Reader, valid func([]byte) bool) (io.Reader, io.Reader, error) {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	m, o := e.readFromPreamble(pre, bytes.NewReader(b))
+	f, err := ioutil.ReadAll(m)
+	if err != nil {
+		closeReader(o, err)
+		return nil, nil, err
+	}
+
+	if (e.fenceValidation && !e.isMapping(f)) || (valid != nil && !valid(f)) {
+		closeReader(o, io.EOF) // let the split goroutine finish
+		return nil, io.MultiReader(bytes.NewReader(pre), bytes.NewReader(b)), nil
+	}
+	return bytes.NewReader(f), o, nil
+}
+
+// unmarshals reports whether the frontmatter metadata f unmarshals without an
+// error to a new value of the type that interface v points to, so v itself
+// is untouched.
+func (e *Encoding) unmarshals(f []byte, v interface{}) bool {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return false
+	}
+	return e.unmarshalAs(f, reflect.New(rv.Type().Elem()).Interface(), true) == nil
+}
+
+// unmarshalsOrWarn is unmarshals for lenient fallback, reporting a
+// WarnLenientFallback warning when f doesn't unmarshal.
+func (e *Encoding) unmarshalsOrWarn(f []byte, v interface{}) bool {
+	if e.unmarshals(f, v) {
+		return true
+	}
+	e.warn(WarnLenientFallback, "the frontmatter block doesn't unmarshal, so it is left as content")
+	return false
+}
+
+// isMapping reports whether the frontmatter metadata f unmarshals to a
+// mapping of keys to values.
+func (e *Encoding) isMapping(f []byte) bool {
+	probe := make(map[string]interface{})
+	return e.unmarshalAs(f, &probe, true) == nil
+}
+
+// readUnmarshal takes the encoded frontmatter metadata from reader r and
+// unmarshals the data to interface v.
+func (e *Encoding) readUnmarshal(r io.Reader, v interface{}) error {
+
+	// collects all of the frontmatter bytes from the reader, because
+	// marshaling (some encodings don't have a stream encoder) needs to
+	// have all of the bytes.
+	b := e.getBuffer()
+	defer e.putBuffer(b)
+
+	if _, err := b.ReadFrom(r); err != nil {
+		return err
+	}
+
+	if err := e.rawMatter(b.Bytes()); err != nil {
+		return err
+	}
+
+	if err := e.unmarshal(b.Bytes(), v); err != nil {
+		return err
+	}
+	return nil
+}
+
+// rawMatter calls the raw matter hook of e, if there is one, with the raw
+// frontmatter metadata f.
+func (e *Encoding) rawMatter(f []byte) error {
+	if e.rawMatterFunc == nil {
+		return nil
+	}
+	return e.rawMatterFunc(f)
+}
+
+// getBuffer returns an empty buffer from the buffer pool of e, or a new one
+// if there is no pool.
+func (e *Encoding) getBuffer() *bytes.Buffer {
+	if e.bufPool != nil {
+		if b, ok := e.bufPool.Get().(*bytes.Buffer); ok {
+			b.Reset()
+			return b
+		}
+	}
+	return new(bytes.Buffer)
+}
+
+// putBuffer returns b to the buffer pool of e, b must not be used after.
+func (e *Encoding) putBuffer(b *bytes.Buffer) {
+	if e.bufPool != nil {
+		e.bufPool.Put(b)
+	}
+}
+
+// marshal calls the marshalFunc of e, converting any panic into an error.
+// Errors are returned as a *FrontmatterError.
+func (e *Encoding) marshal(v interface{}) (f []byte, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			f, err = nil, fmt.Errorf("%w: %v", ErrMarshalPanic, r)
+		}
+		if err != nil {
+			err = &FrontmatterError{Op: "encode", Format: e.name, Err: err}
+		}
+	}()
+
+	if e.keyEncodeFunc != nil {
+		v = e.encodeKeys(v)
+	}
+
+	if e.textMarshalers {
+		if v, err = e.textMarshal(v); err != nil {
+			return nil, err
+		}
+	}
+
+	if e.marshalFallbackFunc != nil {
+		if f, err = tryMarshal(e.marshalValue, v); err == nil {
+			return f, nil
+		}
+		return e.marshalFallbackFunc(v)
+	}
+	return e.marshalValue(v)
+}
+
+// marshalValue calls the marshal func of e, the one that sorts the object
+// keys of v when e has sorted keys.
+func (e *Encoding) marshalValue(v interface{}) ([]byte, error) {
+	if e.sortedMarshalFunc != nil {
+		return e.sortedMarshalFunc(v)
+	}
+	return e.marshalFunc(v)
+}
+
+// tryMarshal calls fn, converting any panic into an error.
+func tryMarshal(fn MarshalFunc, v interface{}) (f []byte, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			f, err = nil, fmt.Errorf("%w: %v", ErrMarshalPanic, r)
+		}
+	}()
+	return fn(v)
+}
+
+// unmarshal calls the unmarshalFunc of e, or the strictUnmarshalFunc when
+// strict unmarshaling is on, converting any panic into an error. The value v
+// must be a non-nil pointer or map, which is checked before anything is
+// unmarshaled, and the required fields of v are checked after. Errors are
+// returned as a *FrontmatterError.
+func (e *Encoding) unmarshal(f []byte, v interface{}) error {
+	return e.unmarshalAs(f, v, false)
+}
+
+// unmarshalAs is unmarshal. A trial unmarshal, that decides if a block is
+// metadata, doesn't report the metadata keys that v has no field for, nor
+// check the required fields of v; both are done once, by the unmarshal of
+// the block that is decided on.
+func (e *Encoding) unmarshalAs(f []byte, v interface{}, trial bool) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%w: %v", ErrUnmarshalPanic, r)
+		}
+		if err != nil {
+			err = &FrontmatterError{Op: "decode", Format: e.name, Err: err}
+		}
+	}()
+
+	if e.tabWidth > 0 {
+		f = expandIndentTabs(f, e.tabWidth)
+	}
+
+	rv := reflect.ValueOf(v)
+	switch {
+	case rv.Kind() == reflect.Map && !rv.IsNil():
+		// a map is filled in through a pointer to it, as the unmarshal
+		// funcs only take pointers
+		p := reflect.New(rv.Type())
+		p.Elem().Set(rv)
+		if err := e.unmarshalPtr(f, p.Interface(), !trial && e.warnFunc != nil); err != nil {
+			return err
+		}
+
+		for iter := p.Elem().MapRange(); iter.Next(); {
+			rv.SetMapIndex(iter.Key(), iter.Value())
+		}
+		return nil
+	case rv.Kind() != reflect.Ptr || rv.IsNil():
+		return fmt.Errorf("%w: %T", ErrDestinationNotPointer, v)
+	}
+
+	if err := e.unmarshalPtr(f, v, !trial && e.warnFunc != nil); err != nil {
+		return err
+	}
+	if trial {
+		return nil
+	}
+	return e.checkRequired(f, v)
+}
+
+// expandVars returns f with each ${var} replaced by the value that fn returns
+// for var. A "$" that doesn't start a ${var} with a valid name is kept.
+func expandVars(f []byte, fn func(string) string) []byte {
+	var out []byte
+	last, expanded := 0, false
+	for i := 0; i < len(f); i++ {
+		if f[i] != '$' || i+1 >= len(f) || f[i+1] != '{' {
+			continue
+		}
+		end := bytes.IndexByte(f[i+2:], '}')
+		if end <= 0 || !isVarName(f[i+2:i+2+end]) {
+			continue
+		}
+		out = append(out, f[last:i]...)
+		out = append(out, fn(string(f[i+2:i+2+end]))...)
+		last, expanded = i+2+end+1, true
+		i = last - 1
+	}
+	if !expanded {
+		return f
+	}
+	return append(out, f[last:]...)
+}
+
+// isVarName reports whether name is made of letters, digits and underscores.
+func isVarName(name []byte) bool {
+	for _, c := range name {
+		if c != '_' && (c < '0' || c > '9') && (c < 'a' || c > 'z') && (c < 'A' || c > 'Z') {
+			return false
+		}
+	}
+	return true
+}
+
+// unmarshalPtr does the work of unmarshal for the non-nil pointer v.
+func (e *Encoding) unmarshalPtr(f []byte, v interface{}, warn bool) (err error) {
+	if len(f) == 0 || (e.frameFunc == nil && len(bytes.TrimSpace(f)) == 0) {
+		return nil // an empty block leaves v untouched, binary metadata isn't trimmed
+	}
+
+	if e.expandFunc != nil {
+		f = expandVars(f, e.expandFunc)
+	}
+
+	if e.includeFunc != nil {
+		if f, err = e.resolveIncludes(f); err != nil {
+			return err
+		}
+	}
+
+	fn := e.unmarshalFunc
+	if e.strictUnmarshal && e.strictUnmarshalFunc != nil {
+		fn = e.strictUnmarshalFunc
+	}
+
+	if m, ok := v.(*map[string]interface{}); ok && e.preserveKeyCase {
+		return e.unmarshalKeys(f, m, fn)
+	}
+
+	if e.keyDecodeFunc != nil {
+		if f, err = e.decodeKeys(f, v); err != nil {
+			return err
+		}
+	}
+
+	if e.caseInsensitiveKeys {
+		if f, err = e.foldKeys(f, v); err != nil {
+			return err
+		}
+	}
+
+	if len(e.timeLayouts) > 0 {
+		next := fn
+		fn = func(f []byte, v interface{}) error { return e.timeUnmarshal(f, v, next) }
+	}
+
+	if warn {
+		e.warnUnknownKeys(f, v)
+	}
+
+	if e.textMarshalers {
+		return e.textUnmarshal(f, v, fn)
+	}
+	return fn(f, v)
+}
+
+// hasFrontmatter reports whether b could start with a frontmatter block. It
+// is used to skip the splitting machinery when there can't be any frontmatter
+// to split out, so it only checks for the opening delimiter.
+func (e *Encoding) hasFrontmatter(b []byte) bool {
+	e = e.fenceFor(b)
+	if e.position == FooterPosition || e.wholeDocument {
+		return true // the block can't be seen from the start of a file
+	}
+	return e.opens(e.skipPreamble(b))
+}
+
+// opens reports whether b starts with the opening delimiter of e, or with a
+// line that the delimiter func of e reads as the opening delimiter.
+func (e *Encoding) opens(b []byte) bool {
+	if bytes.HasPrefix(b, []byte(e.start)) {
+		return true
+	}
+	if e.delimiterFunc == nil {
+		return false
+	}
+	if i := bytes.IndexByte(b, '\n'); i >= 0 {
+		b = b[:i+1]
+	}
+	return e.isDelimiterLine(b, e.start)
+}
+
+// openingPreambleLen returns the length of the preamble before the opening
+// delimiter on line (i.e. "<html>" of "<html><head>"), as the delimiter func
+// of e reads it, or 0 when there is none.
+func (e *Encoding) openingPreambleLen(line []byte) int {
+	if e.delimiterFunc == nil {
+		return 0
+	}
+	if i := bytes.IndexByte(line, '\n'); i >= 0 {
+		line = line[:i+1]
+	}
+	pre, _ := e.delimiterFunc(strings.TrimRight(string(line), "\r\n"))
+	if pre == "" || !bytes.HasPrefix(line, []byte(pre)) || !e.isDelimiterLine(line[len(pre):], e.start) {
+		return 0
+	}
+	return len(pre)
+}
+
+// hasPreamble reports whether e has preamble lines (or a "#!" line) that
+// may come before the opening delimiter.
+func (e *Encoding) hasPreamble() bool {
+	return e.preambleFunc != nil || e.headerComment != "" || e.allowShebang
+}
+
+// isPreamble reports whether line is a preamble line, a line of the header
+// comment or a line that the preamble func of e accepts.
+func (e *Encoding) isPreamble(line string) bool {
+	if e.headerComment != "" && strings.Contains("\n"+e.headerComment, "\n"+line+"\n") {
+		return true
+	}
+	return e.preambleFunc != nil && e.preambleFunc(line)
+}
+
+// skipPreamble returns b without the leading "#!" line and preamble lines,
+// and the preamble before the opening delimiter on its line.
+func (e *Encoding) skipPreamble(b []byte) []byte {
+	b = b[e.shebangLen(b):]
+	for e.hasPreamble() {
+		i := bytes.IndexByte(b, '\n')
+		if i < 0 || !e.isPreamble(strings.TrimSuffix(string(b[:i]), "\r")) {
+			break
+		}
+		b = b[i+1:]
+	}
+	return b[e.openingPreambleLen(b):]
+}
+
+// splitFunc returns a new split func of e for splitting the frontmatter from
+// the content. A split func holds state, so each input needs a new one.
+func (e *Encoding) splitFunc() bufio.SplitFunc {
+	split := e.inSplitFunc(e.delimiter)
+	if (e.strictFence || e.contentSeparator != nil) && split.End != "" {
+		return fenceSplitter([]byte(split.Start+"\n"), []byte("\n"+split.End+"\n"), []byte(e.delimiter), e.strictFence, e.contentSeparator)
+	}
+	return split.SplitFunc
+}
+
+// newScanner returns a scanner of the tokens of split in r, with the buffer
+// size of e. A *bufio.Reader r is scanned in place, any other r is read
+// through a new one.
+func (e *Encoding) newScanner(r io.Reader, split bufio.SplitFunc) *readerScanner {
+	br, ok := r.(*bufio.Reader)
+	if !ok {
+		br = bufio.NewReader(r)
+	}
+
+	max := bufio.MaxScanTokenSize
+	if e.scannerBufferSize > 0 {
+		max = e.scannerBufferSize
+	}
+	return &readerScanner{br: br, split: split, max: max}
+}
+
+// peekFrontmatter reads just enough of r to check if it could start with a
+// frontmatter block. The returned reader replays the peeked bytes, so it
+// should be used in place of r. Preamble lines are not replayed when there is
+// frontmatter after them, the skipped preamble lines are returned, so they
+// can be put back in the content if no block opens after all.
+func (e *Encoding) peekFrontmatter(r io.Reader) (io.Reader, []byte, bool) {
+	if e.wholeDocument {
+		return r, nil, true
+	}
+
+	if e.hasPreamble() && e.position == HeaderPosition {
+		return e.peekPreamble(r)
+	}
+
+	// a *bufio.Reader is peeked in place, so it isn't wrapped again
+	if br, ok := r.(*bufio.Reader); ok {
+		p, err := br.Peek(len(e.start))
+		if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+			return io.MultiReader(bytes.NewReader(p), errReader{err}), nil, false
+		}
+		return br, nil, e.hasFrontmatter(p)
+	}
+
+	p := make([]byte, len(e.start))
+	n, err := io.ReadFull(r, p)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		// surface the read error after the bytes that were peeked
+		return io.MultiReader(bytes.NewReader(p[:n]), errReader{err}), nil, false
+	}
+
+	p = p[:n]
+	return io.MultiReader(bytes.NewReader(p), r), nil, e.hasFrontmatter(p)
+}
+
+// peekPreamble reads r line by line past the preamble lines, to check if the
+// first line after them is an opening delimiter line.
+func (e *Encoding) peekPreamble(r io.Reader) (io.Reader, []byte, bool) {
+	var pre []byte
+
+	br, ok := r.(*bufio.Reader)
+	if !ok {
+		br = bufio.NewReader(r)
+	}
+	for {
+		line, err := br.ReadBytes('\n')
+		if err == nil && len(pre) == 0 && e.shebangLen(line) > 0 {
+			pre = append(pre, line...)
+			continue
+		}
+		if err == nil && e.isPreamble(strings.TrimRight(string(line), "\r\n")) {
+			pre = append(pre, line...)
+			continue
+		}
+
+		if err != nil && err != io.EOF {
+			return io.MultiReader(bytes.NewReader(append(pre, line...)), errReader{err}), nil, false
+		}
+
+		if n := e.openingPreambleLen(line); n > 0 && err == nil {
+			pre, line = append(pre, line[:n]...), line[n:]
+		}
+
+		if e.isOpeningLine(line, err == nil) {
+			return io.MultiReader(bytes.NewReader(line), br), pre, true
+		}
+		return io.MultiReader(bytes.NewReader(append(pre, line...)), br), nil, false
+	}
+}
+
+// isOpeningLine reports whether line, with its line ending when full is
+// true, is the opening delimiter of e on a line of its own. A "\r\n" line
+// ending is allowed, and so is trailing whitespace when e trims it. A binary
+// frame, or a line with strict separation (which reports the error), only
+// has to start with the delimiter.
+func (e *Encoding) isOpeningLine(line []byte, full bool) bool {
+	if e.frameFunc != nil || e.strictSeparation {
+		return bytes.HasPrefix(line, []byte(e.start))
+	}
+	return full && e.isDelimiterLine(line, e.start)
+}
 
-	return o, nil
+// isDelimiterLine reports whether line, with or without its line ending, is
+// the delimiter delim on a line of its own, as isOpeningLine.
+func (e *Encoding) isDelimiterLine(line []byte, delim string) bool {
+	line = bytes.TrimSuffix(bytes.TrimSuffix(line, []byte("\n")), []byte("\r"))
+	if e.trimDelimiterSpace {
+		line = bytes.TrimRight(line, " \t")
+	}
+	if e.delimiterFunc != nil {
+		pre, s := e.delimiterFunc(string(line))
+		return pre == "" && s == delim
+	}
+	return string(line) == delim
 }
 
-// Encoding is the set of options that determine the marshaling and
-// unmarshaling encoding specifications of frontmatter metadata.
-type Encoding struct {
-	output                struct{ start, end string }
-	start, end, delimiter string
-	outputDelimiter       bool
+// rewritesDelimiters reports whether the delimiter lines of e are read
+// through a delimiterSpaceReader.
+func (e *Encoding) rewritesDelimiters() bool {
+	return e.trimDelimiterSpace || e.crlfDelimiters || e.delimiterFunc != nil
+}
 
-	inSplitFunc   SplitFunc
-	ioSplitFunc   bufio.SplitFunc
-	marshalFunc   MarshalFunc
-	unmarshalFunc UnmarshalFunc
+// withOptions returns e when there are no per call options, otherwise a
+// copy of e with the options applied, so that e is never changed. The split
+// state of e is reused, it is only derived again when an option changes the
+// delimiter or the split func. The error of the first option that fails is
+// returned.
+func (e *Encoding) withOptions(opts []DecodeOption) (*Encoding, error) {
+	if len(opts) == 0 {
+		return e, nil
+	}
 
-	fmBufMutex sync.Mutex
-	fmBuf      map[string][]byte
-}
+	c := e.copy()
+	c.fmBuf = make(map[string][]byte)
+	c.start, c.end, c.output = e.start, e.end, e.output
+	c.ioSplitFunc, c.frameFunc = e.ioSplitFunc, e.frameFunc
+	for _, o := range opts {
+		if err := o(c); err != nil {
+			return nil, err
+		}
+	}
 
-// NewEncoding returns a new Encoding defined by the any passed in options.
-// All options can be changed by passing in the appropriate EncodingOptionFunc
-// option.
-func NewEncoding(options ...EncodingOptionFunc) *Encoding {
-	e := &Encoding{
-		outputDelimiter: false,
-		inSplitFunc:     SingleTokenDelimiter,
+	if err := c.deriveMarshal(); err != nil {
+		return nil, err
 	}
-	for _, o := range options {
-		if err := o(e); err != nil {
-			panic(err)
+	if c.splitSet || c.delimiter != e.delimiter || c.outputDelimiter != e.outputDelimiter {
+		if err := c.deriveSplit(); err != nil {
+			return nil, err
 		}
 	}
 
-	e.fmBuf = make(map[string][]byte) // initialize the caching map
-	split := e.inSplitFunc(e.delimiter)
-	e.start, e.end, e.ioSplitFunc = split.Start, split.End, split.SplitFunc
-	if e.outputDelimiter {
-		// add to wrap the frontmatter metadata only if explicitly set to
-		e.output.start, e.output.end = e.start, e.end
+	if e.fences != nil {
+		c.fences = make([]*Encoding, len(e.fences))
+		for i, f := range e.fences {
+			var err error
+			if c.fences[i], err = f.withOptions(opts); err != nil {
+				return nil, err
+			}
+		}
 	}
-	return e
+	return c, nil
 }
 
-// Decode decodes src using the encoding e. It writes bytes to dst and returns
-// the number of bytes written. If src contains invalid unmarshaled data, it
-// will return the number of bytes successfully written along with an error.
-func (e *Encoding) Decode(dst, src []byte, v interface{}) (int, error) {
-	m, r := e.readFrom(bytes.NewBuffer(src))
-	if err := e.readUnmarshal(m, v); err != nil {
-		return 0, err
+// checkSize returns ErrMaxSize if n is over the maximum size of e.
+func (e *Encoding) checkSize(n int) error {
+	if e.maxSize > 0 && int64(n) > e.maxSize {
+		return ErrMaxSize
 	}
+	return nil
+}
 
-	return io.ReadFull(r, dst)
+// trimBOM returns b without a leading UTF-8 byte order mark when e strips
+// them.
+func (e *Encoding) trimBOM(b []byte) []byte {
+	if e.stripBOM && bytes.HasPrefix(b, utf8BOM) {
+		e.warnBOM()
+		return b[len(utf8BOM):]
+	}
+	return b
 }
 
-// DecodeString returns the bytes representing the string data of src without
-// the frontmatter. The interface v will contain the decoded frontmatter
-// metadata. It returns an error if the underlining marshaler returns an
-// error.
-func (e *Encoding) DecodeString(src string, v interface{}) ([]byte, error) {
-	return e.DecodeReader(bytes.NewBufferString(src), v)
+// warnBOM reports that a byte order mark was stripped.
+func (e *Encoding) warnBOM() {
+	e.warn(WarnBOMStripped, "stripped a leading UTF-8 byte order mark")
 }
 
-// DecodeReader returns the bytes representing the data collected from reader
-// r without frontmatter metadata. The interface v will contain the decoded
-// frontmatter metadata.
-func (e *Encoding) DecodeReader(r io.Reader, v interface{}) ([]byte, error) {
-	m, r := e.readFrom(r)
-	if err := e.readUnmarshal(m, v); err != nil {
-		return nil, err
+// trimBOMReader returns a reader of r without a leading UTF-8 byte order
+// mark.
+func (e *Encoding) trimBOMReader(r io.Reader) io.Reader {
+	if br, ok := r.(*bufio.Reader); ok {
+		if p, _ := br.Peek(len(utf8BOM)); e.stripBOM && bytes.Equal(p, utf8BOM) {
+			br.Discard(len(utf8BOM))
+			e.warnBOM()
+		}
+		return br
 	}
-	return ioutil.ReadAll(r)
+
+	p := make([]byte, len(utf8BOM))
+	n, err := io.ReadFull(r, p)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return io.MultiReader(bytes.NewReader(p[:n]), errReader{err})
+	}
+	return io.MultiReader(bytes.NewReader(e.trimBOM(p[:n])), r)
 }
 
-// EncodeToString returns the frontmatter encoding of type e Encoding before
-// the data bytes of src populated with the data of interface v.
-func (e *Encoding) EncodeToString(src []byte, v interface{}) string {
-	b := make([]byte, e.EncodeLen(src, v))
-	e.Encode(b, src, v)
-	return string(b)
+// asciiSpace are the whitespace characters trimmed from content.
+const asciiSpace = " \t\n\v\f\r"
+
+// trimContent returns the content b without surrounding whitespace when e
+// trims it.
+func (e *Encoding) trimContent(b []byte) []byte {
+	if e.trimSpace {
+		return bytes.Trim(b, asciiSpace)
+	}
+	return b
 }
 
-// Encode encodes src using the encoding e, writing EncodedLen(len(encoded
-// frontmatter)+len(src)) bytes to dst.
-func (e *Encoding) Encode(dst, src []byte, v interface{}) {
-	f, err := e.encodeFrontmatter(v)
-	if err != nil {
-		panic(err)
+// trimSpaceReader reads from r without the leading and trailing whitespace.
+// Whitespace is held back until it's known if more content follows it.
+type trimSpaceReader struct {
+	r                 io.Reader
+	buf, pending, out []byte
+	started           bool
+	err               error
+}
+
+func (t *trimSpaceReader) Read(p []byte) (int, error) {
+	for len(t.out) == 0 {
+		if t.err != nil {
+			return 0, t.err
+		}
+
+		if t.buf == nil {
+			t.buf = make([]byte, 4096)
+		}
+
+		var n int
+		n, t.err = t.r.Read(t.buf)
+		b := t.buf[:n]
+		if !t.started {
+			b = bytes.TrimLeft(b, asciiSpace)
+			t.started = len(b) > 0
+		}
+
+		i := len(bytes.TrimRight(b, asciiSpace))
+		if i > 0 {
+			t.out = append(append(t.out[:0], t.pending...), b[:i]...)
+			t.pending = t.pending[:0]
+		}
+		t.pending = append(t.pending, b[i:]...)
 	}
 
-	b := new(bytes.Buffer)
-	b.Write(f)
-	b.Write(src)
+	n := copy(p, t.out)
+	t.out = t.out[n:]
+	return n, nil
+}
 
-	io.ReadFull(b, dst)
+// delimiterSpaceReader reads from r without the spaces and tabs at the end
+// of the opening and closing delimiter lines of e (or the "\r" of a "\r\n"
+// line ending when e takes CRLF delimiters), and with the lines that the
+// delimiter func of e reads as delimiters written as the delimiters. Once the
+// closing delimiter line (or a line before it that doesn't open a block) is
+// read, the rest of r is passed on as it is. n is the number of bytes that
+// were trimmed.
+type delimiterSpaceReader struct {
+	r      *bufio.Reader
+	e      *Encoding
+	opened bool
+	done   bool
+	out    []byte
+	n      int64
+	err    error
 }
 
-// EncodedLen returns the length in bytes of the frontmatter encoding of an
-// input buffer and frontmatter metadata of interface i of length n.
-func (e *Encoding) EncodeLen(src []byte, v interface{}) int {
-	f, err := e.encodeFrontmatter(v)
-	if err != nil {
-		panic(err)
+func (t *delimiterSpaceReader) Read(p []byte) (int, error) {
+	for len(t.out) == 0 && !t.done {
+		var line []byte
+		line, t.err = t.r.ReadBytes('\n')
+		t.out = t.line(line)
+		t.done = t.done || t.err != nil
 	}
-	return len(f) + len(src)
-}
 
-// hashFrontmatter returns a very simple hash of the interface v with data.
-func (e *Encoding) hashFrontmatter(v interface{}) string {
-	// this hash is pretty slow and weak, but it should be good enough for our
-	// purposes in this function.
-	h := md5.Sum([]byte(fmt.Sprintf("%#v", v)))
-	return string(h[:])
+	if len(t.out) > 0 {
+		n := copy(p, t.out)
+		t.out = t.out[n:]
+		return n, nil
+	}
+
+	if t.err != nil {
+		return 0, t.err
+	}
+	return t.r.Read(p)
 }
 
-// encodeFrontmatter marshals the data from interface v to frontmatter
-// metadata. The result is cached, therefore it can be called multiple times
-// with little performance hit.
-func (e *Encoding) encodeFrontmatter(v interface{}) ([]byte, error) {
-	h := e.hashFrontmatter(v)
-	if f, ok := e.fmBuf[h]; ok {
-		return f, nil
+// line returns line with the trailing whitespace of a delimiter trimmed.
+func (t *delimiterSpaceReader) line(line []byte) []byte {
+	body := bytes.TrimSuffix(line, []byte("\n"))
+	trimmed := body
+	if t.e.crlfDelimiters {
+		trimmed = bytes.TrimSuffix(trimmed, []byte("\r"))
+	}
+	crlf := len(trimmed) < len(body)
+	if t.e.trimDelimiterSpace {
+		trimmed = bytes.TrimRight(trimmed, " \t")
+	}
+	if t.e.delimiterFunc != nil {
+		if pre, delim := t.e.delimiterFunc(string(trimmed)); pre == "" {
+			trimmed = []byte(delim)
+		}
 	}
 
-	f, err := e.marshalFunc(v)
-	if err != nil {
-		return nil, err
+	delim := t.e.end
+	if !t.opened {
+		delim = t.e.start
 	}
 
-	var start, end string
-	if !e.outputDelimiter {
-		start, end = e.start+"\n", e.end
+	switch {
+	case string(trimmed) == delim && !bytes.Equal(trimmed, body):
+		t.n += int64(len(body) - len(trimmed))
+		if crlf {
+			t.e.warn(WarnCRLFNormalized, "read the %q delimiter line as if it ended with \"\\n\"", delim)
+		}
+		line = append(trimmed[:len(trimmed):len(trimmed)], line[len(body):]...)
+	case string(trimmed) == delim:
+	case !t.opened && t.e.hasPreamble() && t.e.isPreamble(string(body)):
+		return line
+	case !t.opened:
+		t.done = true // the block isn't opened, so the rest is content
+		return line
+	default:
+		return line
 	}
 
-	// the lock here is to make this function concurrency safe.
-	e.fmBufMutex.Lock()
-	e.fmBuf[h] = append(append([]byte(start), f...), []byte(end+"\n\n")...)
-	e.fmBufMutex.Unlock()
-	return e.fmBuf[h], nil
+	t.done = t.opened
+	t.opened = true
+	return line
 }
 
-// readUnmarshal takes the encoded frontmatter metadata from reader r and
-// unmarshals the data to interface v.
-func (e *Encoding) readUnmarshal(r io.Reader, v interface{}) error {
+// maxSizeReader reads from r, returning ErrMaxSize once more than n bytes
+// have been read.
+type maxSizeReader struct {
+	r io.Reader
+	n int64
+}
 
-	// collects all of the frontmatter bytes from the reader, because
-	// marshaling (some encodings don't have a stream encoder) needs to
-	// have all of the bytes.
-	f, err := ioutil.ReadAll(r)
-	if err != nil {
-		return err
+func (l *maxSizeReader) Read(p []byte) (int, error) {
+	if int64(len(p)) > l.n {
+		p = p[:l.n+1] // read just enough to know if the limit was crossed
 	}
 
-	if err := e.unmarshalFunc(f, v); err != nil {
-		return err
+	n, err := l.r.Read(p)
+	if l.n -= int64(n); l.n < 0 {
+		return 0, ErrMaxSize
 	}
-	return nil
+	return n, err
+}
+
+// errReader is a reader that always returns err.
+type errReader struct{ err error }
+
+func (r errReader) Read([]byte) (int, error) { return 0, r.err }
+
+// copyFull copies src to dst with the same results as Decode has when
+// reading content into dst, io.EOF when src is shorter than dst.
+func copyFull(dst, src []byte) (int, error) {
+	n := copy(dst, src)
+	if n < len(dst) {
+		return n, io.EOF
+	}
+	return n, nil
 }
 
 // readFrom takes the incoming reader stream r and splits it into a reader
 // stream for encoded frontmatter metadata and a stream for content.
 func (e *Encoding) readFrom(r io.Reader) (frontmatter, content io.Reader) {
+	return e.readFromPreamble(nil, r)
+}
+
+// readFromPreamble is readFrom for r that comes after the preamble lines pre,
+// which were skipped to find the opening delimiter. When no block is found
+// after all, pre is put back at the start of the content.
+func (e *Encoding) readFromPreamble(pre []byte, r io.Reader) (frontmatter, content io.Reader) {
+	if e.wholeDocument {
+		return r, bytes.NewReader(nil)
+	}
+
+	if e.position == FooterPosition {
+		return e.readFooterFrom(r)
+	}
+
 	mr, mw := io.Pipe()
 	cr, cw := io.Pipe()
 
@@ -328,42 +3605,146 @@ func (e *Encoding) readFrom(r io.Reader) (frontmatter, content io.Reader) {
 		defer mw.Close() // if the matter writer is never written to...
 		defer cw.Close() // if data writer is never written to...
 
-		scnr := bufio.NewScanner(r)
-		scnr.Split(e.inSplitFunc(e.delimiter).SplitFunc)
+		scnr := e.newScanner(r, e.splitFunc())
 
-		for scnr.Scan() {
-			txt := scnr.Text()
-
-			// checks if the first scan picks up a delimiter
-			if txt == e.delimiter {
-				io.WriteString(mw, e.output.start)
-				for scnr.Scan() {
-					txt := scnr.Text()
-					if txt == e.delimiter {
-						io.WriteString(mw, e.output.end)
-						break
-					}
-					io.WriteString(mw, txt)
+		// write sends txt to the content reader, it reports false when the
+		// content reader was closed, so there is no need to scan any more
+		write := func(txt []byte) bool {
+			if len(txt) == 0 {
+				return true // an empty write would wait on a read
+			}
+			_, err := cw.Write(txt)
+			return err == nil
+		}
+
+		if !scnr.Scan() {
+			mw.CloseWithError(scnr.Err()) // pass on any read error
+			cw.CloseWithError(scnr.Err())
+			return
+		}
+
+		// checks if the first scan picks up a delimiter, the frontmatter is
+		// held until the closing delimiter is found, so that a block that is
+		// never closed is passed on as content
+		if txt := scnr.Text(); txt == e.delimiter {
+			matter := e.getBuffer()
+			defer e.putBuffer(matter) // the pipe writes are done by then
+
+			matter.WriteString(e.output.start)
+			closed := false
+			for !closed && scnr.Scan() {
+				if closed = scnr.Text() == e.delimiter; !closed {
+					matter.Write(scnr.Bytes())
 				}
+			}
+
+			if err := scnr.Err(); err != nil {
+				mw.CloseWithError(err)
+				cw.CloseWithError(err)
+				return
+			}
+
+			if !closed && e.strictSeparation {
+				err := e.notSeparated(false)
+				mw.CloseWithError(err)
+				cw.CloseWithError(err)
+				return
+			}
+
+			if !closed {
 				mw.Close()
-			} else {
-				mw.Close()
-				io.WriteString(cw, txt)
+				write(pre)
+				write([]byte(e.start + "\n"))
+				write(matter.Bytes()[len(e.output.start):])
+				return
+			}
+
+			matter.WriteString(e.output.end)
+			mw.Write(matter.Bytes())
+			mw.Close()
+
+			if e.keepPreamble && !write(pre) {
+				return
 			}
+		} else if e.strictSeparation {
+			err := e.notSeparated(true)
+			mw.CloseWithError(err)
+			cw.CloseWithError(err)
+			return
+		} else {
+			mw.Close()
+			if !write(pre) || !write(scnr.Bytes()) {
+				return
+			}
+		}
 
-			// the frontmatter (mw) pipe will be closed before this point
-			// so scan the rest to the content reader
-			for scnr.Scan() {
-				txt := scnr.Text()
-				io.WriteString(cw, txt)
+		// the frontmatter (mw) pipe will be closed before this point
+		// so scan the rest to the content reader
+		for scnr.Scan() {
+			if !write(scnr.Bytes()) {
+				return
 			}
-			cw.Close()
 		}
+		cw.CloseWithError(scnr.Err())
 	}()
 
 	return mr, cr
 }
 
+// readFooterFrom reads all of r, then splits the frontmatter block at the end
+// of the stream from the content before it.
+func (e *Encoding) readFooterFrom(r io.Reader) (frontmatter, content io.Reader) {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return errReader{err}, errReader{err}
+	}
+
+	m, c := e.splitFooter(b)
+	return bytes.NewReader(m), bytes.NewReader(c)
+}
+
+// splitFooter splits b into the frontmatter metadata of the block at the end
+// of b and the content before it. The blank line separating the content and
+// the block is dropped. If there is no block all of b is content.
+func (e *Encoding) splitFooter(b []byte) (frontmatter, content []byte) {
+	t := bytes.TrimRight(b, "\r\n")
+	end := len(t) - len(e.end)
+	if !bytes.HasSuffix(t, []byte(e.end)) || (end > 0 && t[end-1] != '\n') {
+		return nil, b
+	}
+
+	// scan back from the end for the start line of the block, the start of
+	// the stream or a line after a newline. A start delimiter line may be
+	// inside the block (i.e. in a multi-line string), so the nearest one
+	// that opens a block that parses is taken, or else the nearest one.
+	start := -1
+	for i := end; ; {
+		at := bytes.LastIndex(t[:i], []byte("\n"+e.start+"\n")) + 1
+		if at == 0 && !bytes.HasPrefix(t[:i], []byte(e.start+"\n")) {
+			break
+		}
+
+		f := append(append([]byte(e.output.start), t[at+len(e.start)+1:end]...), e.output.end...)
+		ok := e.isMapping(f)
+		if start < 0 || ok {
+			start, frontmatter = at, f
+		}
+		if ok || at == 0 {
+			break
+		}
+		i = at
+	}
+	if start < 0 {
+		return nil, b
+	}
+
+	content = t[:start]
+	if bytes.HasSuffix(content, []byte("\n\n")) {
+		content = content[:len(content)-1]
+	}
+	return frontmatter, content
+}
+
 // SingleTokenDelimiter returns the start and end delimiter as delim.
 func SingleTokenDelimiter(delim string) Splitter {
 	return Splitter{
@@ -388,13 +3769,116 @@ func SpaceSeparatedTokenDelimiters(delim string) Splitter {
 	}
 }
 
+// LengthPrefixWidth is the width in bytes of the big-endian length that
+// follows the delimiter of a LengthPrefixedDelimiter block.
+const LengthPrefixWidth = 4
+
+// LengthPrefixedDelimiter returns delim as the start delimiter of a block that
+// is framed by the length of the metadata, for binary metadata formats
+// (i.e. MessagePack, protobuf or gob) that can't be split on lines. A block
+// is the delim bytes, the length of the metadata as a LengthPrefixWidth byte
+// big-endian unsigned int, and then the metadata. The content starts right
+// after the metadata, without a separator. There is no end delimiter, and
+// since the metadata is never scanned for one, the metadata and the content
+// may hold any bytes. When encoding, the length is written in front of the
+// marshaled metadata. It doesn't support the FooterPosition.
+func LengthPrefixedDelimiter(delim string) Splitter {
+	retDelimiter := []byte(delim)
+	header := len(delim) + LengthPrefixWidth
+
+	var (
+		firstTime = true
+		inBlock   bool
+		remaining uint64
+	)
+
+	return Splitter{
+		Start: delim,
+		End:   "",
+		SplitFunc: func(data []byte, atEOF bool) (advance int, token []byte, err error) {
+			if inBlock && remaining == 0 {
+				inBlock = false
+				return 0, retDelimiter, nil // the block is closed
+			}
+
+			if atEOF && len(data) == 0 {
+				if inBlock {
+					return 0, nil, fmt.Errorf("particle: frontmatter block is %d bytes short", remaining)
+				}
+				return 0, nil, nil
+			}
+
+			if firstTime {
+				if !atEOF && len(data) < header && (bytes.HasPrefix(data, retDelimiter) || bytes.HasPrefix(retDelimiter, data)) {
+					return 0, nil, nil // could still be a block
+				}
+				firstTime = false
+				if len(data) >= header && bytes.HasPrefix(data, retDelimiter) {
+					inBlock, remaining = true, beUint(data[len(delim):header])
+					return header, retDelimiter, nil
+				}
+			}
+
+			n := len(data)
+			if inBlock && uint64(n) > remaining {
+				n = int(remaining)
+			}
+			if n > 1 && string(data[:n]) == delim {
+				n-- // so the chunk isn't mistaken for the delimiter
+			}
+			if inBlock {
+				remaining -= uint64(n)
+			}
+			return n, data[:n], nil
+		},
+		Frame: func(metadata []byte) []byte {
+			b := make([]byte, 0, header+len(metadata))
+			b = append(b, delim...)
+			for i := LengthPrefixWidth - 1; i >= 0; i-- {
+				b = append(b, byte(len(metadata)>>(8*uint(i))))
+			}
+			return append(b, metadata...)
+		},
+	}
+}
+
+// beUint returns the big-endian unsigned int in b.
+func beUint(b []byte) (u uint64) {
+	for _, c := range b {
+		u = u<<8 | uint64(c)
+	}
+	return u
+}
+
+// BlankLineDelimiter returns delim as the start delimiter, and an empty line
+// as the end delimiter. It is for formats where the frontmatter metadata ends
+// at the first blank line, rather than at a closing delimiter.
+func BlankLineDelimiter(delim string) Splitter {
+	return Splitter{
+		Start:     delim,
+		End:       "",
+		SplitFunc: baseSplitter([]byte(delim+"\n"), []byte("\n\n"), []byte(delim)),
+	}
+}
+
 // baseSplitter reads the characters of a steam and split returns a token when
-// a frontmatter delimiter has been determined.
+// a frontmatter delimiter has been determined. Between the delimiters the
+// data is returned in chunks that are as large as possible, while holding
+// back just enough bytes to detect a delimiter that spans two reads.
 func baseSplitter(topDelimiter, botDelimiter, retDelimiter []byte) bufio.SplitFunc {
+	return fenceSplitter(topDelimiter, botDelimiter, retDelimiter, false, nil)
+}
+
+// fenceSplitter is baseSplitter, but when strict is set the closing delimiter
+// only counts when it is followed by a blank line or the end of the stream.
+// The separator is dropped from the start of the content, when it is nil a
+// single line ending is.
+func fenceSplitter(topDelimiter, botDelimiter, retDelimiter []byte, strict bool, separator []byte) bufio.SplitFunc {
 	var (
-		firstTime                         bool = true
-		checkForBotDelimiter              bool
-		skipFirstWhitespaceAfterDelimiter bool
+		firstTime                   bool = true
+		checkForBotDelimiter        bool
+		checkForEmptyBlock          bool
+		skipSeparatorAfterDelimiter bool
 	)
 
 	// this function does a lookahead to see if the next x bytes contain the delimiter
@@ -405,6 +3889,34 @@ func baseSplitter(topDelimiter, botDelimiter, retDelimiter []byte) bufio.SplitFu
 		return false
 	}
 
+	// this function checks if data is too short to hold the delimiter, but
+	// could still be the start of it once more data has been read
+	needMoreBytes := func(delim, data []byte, atEOF bool) bool {
+		return !atEOF && len(data) < len(delim) && string(delim[:len(data)]) == string(data)
+	}
+
+	// this function returns a chunk of data as a token, a chunk that looks
+	// the same as the returned delimiter is made one byte shorter so that it
+	// can't be mistaken for a delimiter by the caller
+	chunk := func(data []byte) (int, []byte, error) {
+		if len(data) > 1 && string(data) == string(retDelimiter) {
+			data = data[:len(data)-1]
+		}
+		return len(data), data, nil
+	}
+
+	// this function checks if the data after a closing delimiter is a blank
+	// line or the end of the stream, when the fence is strict
+	fenceEnds := func(rest []byte, atEOF bool) (ends, more bool) {
+		switch {
+		case !strict:
+			return true, false
+		case len(rest) == 0 || (len(rest) == 1 && rest[0] == '\r'):
+			return atEOF, !atEOF
+		}
+		return rest[0] == '\n' || bytes.HasPrefix(rest, []byte("\r\n")), false
+	}
+
 	return func(data []byte, atEOF bool) (advance int, token []byte, err error) {
 		if atEOF && len(data) == 0 {
 			return 0, nil, nil
@@ -413,30 +3925,117 @@ func baseSplitter(topDelimiter, botDelimiter, retDelimiter []byte) bufio.SplitFu
 		// firstTime will check the first character to see if we should be
 		// splitting out frontmatter metadata
 		if firstTime {
+			if needMoreBytes(topDelimiter, data, atEOF) {
+				return 0, nil, nil
+			}
 			firstTime = false
 			if checkDelimiterBytes(topDelimiter, data) {
 				checkForBotDelimiter = true
+				checkForEmptyBlock = len(botDelimiter) > 1 && botDelimiter[0] == '\n'
 				return len(topDelimiter), retDelimiter, nil
 			}
 		}
 
+		// the closing delimiter of an empty block comes right after the
+		// opening delimiter, so its leading line ending was already read
+		if checkForEmptyBlock {
+			short := botDelimiter[1:]
+			if needMoreBytes(short, data, atEOF) {
+				return 0, nil, nil
+			}
+			checkForEmptyBlock = false
+			if checkDelimiterBytes(short, data) {
+				if ends, more := fenceEnds(data[len(short):], atEOF); more {
+					checkForEmptyBlock = true
+					return 0, nil, nil
+				} else if !ends {
+					return chunk(data[:len(short)-1])
+				}
+				checkForBotDelimiter = false
+				skipSeparatorAfterDelimiter = true
+				return len(short), retDelimiter, nil
+			}
+			if atEOF && bytes.HasSuffix(short, []byte("\n")) && string(data) == string(short[:len(short)-1]) {
+				checkForBotDelimiter = false
+				return len(data), retDelimiter, nil
+			}
+		}
+
 		if checkForBotDelimiter {
+			if needMoreBytes(botDelimiter, data, atEOF) {
+				return 0, nil, nil
+			}
 			if checkDelimiterBytes(botDelimiter, data) {
+				if ends, more := fenceEnds(data[len(botDelimiter):], atEOF); more {
+					return 0, nil, nil
+				} else if !ends {
+					return chunk(data[:len(botDelimiter)-1])
+				}
 				checkForBotDelimiter = false
-				skipFirstWhitespaceAfterDelimiter = true
+				skipSeparatorAfterDelimiter = true
 				return len(botDelimiter), retDelimiter, nil
 			}
+
+			// the closing delimiter can end the stream without a line ending
+			if atEOF && bytes.HasSuffix(botDelimiter, []byte("\n")) && string(data) == string(botDelimiter[:len(botDelimiter)-1]) {
+				checkForBotDelimiter = false
+				return len(data), retDelimiter, nil
+			}
+
+			// return everything up to the next delimiter, or if there
+			// isn't one, everything that can't be the start of one
+			if i := bytes.Index(data, botDelimiter); i > 0 {
+				return chunk(data[:i])
+			}
+			if n := len(data) - len(botDelimiter) + 1; !atEOF {
+				if n <= 0 {
+					return 0, nil, nil
+				}
+				return chunk(data[:n])
+			}
+			if tail := botDelimiter[:len(botDelimiter)-1]; bytes.HasSuffix(botDelimiter, []byte("\n")) && len(data) > len(tail) && bytes.HasSuffix(data, tail) {
+				return chunk(data[:len(data)-len(tail)]) // up to a closing delimiter at the end
+			}
+			return chunk(data)
 		}
 
-		// Consume the first whitespace after the metadata if necessary
-		if skipFirstWhitespaceAfterDelimiter {
-			if unicode.IsSpace(rune(data[0])) {
-				return 1, nil, nil
+		// Consume the line ending that separates the metadata from the
+		// content, any other leading whitespace belongs to the content
+		if skipSeparatorAfterDelimiter {
+			sep := separator
+			if sep == nil {
+				sep = []byte("\r\n")
+			}
+			if needMoreBytes(sep, data, atEOF) {
+				return 0, nil, nil
+			}
+			skipSeparatorAfterDelimiter = false
+
+			skip := 0
+			switch {
+			case separator != nil:
+				if len(separator) > 0 && bytes.HasPrefix(data, separator) {
+					skip = len(separator)
+				}
+			case bytes.HasPrefix(data, []byte("\r\n")):
+				skip = 2
+			case data[0] == '\n':
+				skip = 1
+			}
+
+			// the scanner stops at the first empty token once the reader
+			// is done, which can be with the last of the data (i.e. a
+			// gzip reader), so the content is returned with the skip
+			if skip > 0 {
+				if !atEOF || len(data) == skip {
+					return skip, nil, nil
+				}
+				n, token, err := chunk(data[skip:])
+				return skip + n, token, err
 			}
-			skipFirstWhitespaceAfterDelimiter = false
 		}
 
-		return 1, data[:1], nil
+		return chunk(data)
 	}
 }
 
@@ -453,7 +4052,81 @@ func jsonMarshal(data interface{}) ([]byte, error) {
 	return buf.Bytes(), nil
 }
 
-// tomlMarshal wraps the TOML encoder to a valid marshal function
+// jsonFencedMarshal is jsonMarshal with a trailing newline, so the closing
+// code fence is on a line of its own.
+func jsonFencedMarshal(data interface{}) ([]byte, error) {
+	b, err := jsonMarshal(data)
+	if err != nil {
+		return nil, err
+	}
+	return append(b, '\n'), nil
+}
+
+// jsonPreamble reports if line is a blank or comment line that may come
+// before JSON frontmatter.
+func jsonPreamble(line string) bool {
+	line = strings.TrimSpace(line)
+	return line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, "//")
+}
+
+// jsonUnmarshalStrict unmarshals JSON data returning an error for any object
+// keys that do not match a field in the destination.
+func jsonUnmarshalStrict(data []byte, v interface{}) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	return jsonDecodeAll(dec, v)
+}
+
+// jsonUnmarshalNumber unmarshals JSON data with numbers as json.Number values.
+func jsonUnmarshalNumber(data []byte, v interface{}) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	return jsonDecodeAll(dec, v)
+}
+
+// jsonUnmarshalStrictNumber is jsonUnmarshalStrict with numbers as
+// json.Number values.
+func jsonUnmarshalStrictNumber(data []byte, v interface{}) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	dec.DisallowUnknownFields()
+	return jsonDecodeAll(dec, v)
+}
+
+// jsonDecodeAll decodes the single JSON value read by dec to v, returning an
+// error when there is more data after it, the same as json.Unmarshal.
+func jsonDecodeAll(dec *json.Decoder, v interface{}) error {
+	if err := dec.Decode(v); err != nil {
+		return err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return errors.New("json: invalid data after top-level value")
+	}
+	return nil
+}
+
+// tomlUnmarshalStrict unmarshals TOML data returning an error for any keys
+// that were not decoded into the destination.
+func tomlUnmarshalStrict(data []byte, v interface{}) error {
+	md, err := toml.Decode(string(data), v)
+	if err != nil {
+		return err
+	}
+
+	if undecoded := md.Undecoded(); len(undecoded) > 0 {
+		keys := make([]string, len(undecoded))
+		for i, k := range undecoded {
+			keys[i] = k.String()
+		}
+		return fmt.Errorf("toml: unknown keys: %s", strings.Join(keys, ", "))
+	}
+	return nil
+}
+
+// tomlMarshal wraps the TOML encoder to a valid marshal function. The TOML
+// encoder sorts map keys alphabetically (at every level of nesting), while
+// struct fields keep their declaration order, so the output is deterministic
+// for both maps and structs.
 func tomlMarshal(data interface{}) ([]byte, error) {
 	buf := new(bytes.Buffer)
 	if err := toml.NewEncoder(buf).Encode(data); err != nil {
@@ -1,10 +1,30 @@
 package particle
 
 import (
+	"bufio"
 	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"math/rand"
 	"reflect"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"testing/iotest"
+
+	"github.com/BurntSushi/toml"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/structpb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+	"gopkg.in/yaml.v2"
 )
 
 var testCaseData = map[string]map[string]string{
@@ -68,7 +88,7 @@ func TestCustomEncoding(t *testing.T) {
 		return nil
 	}
 
-	haveEnc := NewEncoding(
+	haveEnc := MustNewEncoding(
 		WithDelimiter(wantDelimiter),
 		WithMarshalFunc(wantMarshalFunc),
 		WithUnmarshalFunc(wantUnmarshalFunc),
@@ -195,7 +215,7 @@ func TestDecoding(t *testing.T) {
 		}
 
 		if wantInt != haveInt3 {
-			t.Errorf(r.Name+"(Decode): \nwant: %+v \nhave: %+v", wantInt, string(haveInt3))
+			t.Errorf(r.Name+"(Decode): \nwant: %+v \nhave: %+v", wantInt, haveInt3)
 		}
 
 		if wantContent != string(haveContent3) {
@@ -207,3 +227,3586 @@ func TestDecoding(t *testing.T) {
 		}
 	}
 }
+
+func TestTOMLDeterministicMapEncoding(t *testing.T) {
+	v := map[string]interface{}{
+		"title": "example TOML",
+		"name":  "John Doe",
+		"date":  "10-10-2016",
+		"tags":  []string{"a", "b"},
+		"extra": map[string]interface{}{"zeta": 1, "alpha": 2, "mid": 3},
+	}
+
+	wantFile := TOMLEncoding.EncodeToString([]byte(wantContent), v)
+	for i := 0; i < 10; i++ {
+		// a fresh encoding each time so that the cache is not hit
+		enc := MustNewEncoding(
+			WithDelimiter(TOMLDelimiter),
+			WithMarshalFunc(tomlMarshal),
+			WithUnmarshalFunc(toml.Unmarshal),
+		)
+		haveFile := enc.EncodeToString([]byte(wantContent), v)
+		if wantFile != haveFile {
+			t.Fatalf("\nwant: %+v \nhave: %+v", wantFile, haveFile)
+		}
+	}
+}
+
+func TestName(t *testing.T) {
+	var runner = []struct {
+		WantName string
+		Encoding *Encoding
+	}{
+		{"yaml", YAMLEncoding},
+		{"toml", TOMLEncoding},
+		{"json", JSONEncoding},
+		{"jsonfenced", JSONFencedEncoding},
+		{"htmlcomment", HTMLCommentEncoding},
+		{"yaml", YAMLEncoding.Clone()},
+		{"custom", YAMLEncoding.Clone(WithName("custom"))},
+		{"", MustNewEncoding(WithDelimiter("~~~"))},
+	}
+
+	for _, r := range runner {
+		if r.WantName != r.Encoding.Name() {
+			t.Errorf("want: %q have: %q", r.WantName, r.Encoding.Name())
+		}
+	}
+}
+
+func TestDelimiters(t *testing.T) {
+	var runner = []struct {
+		Name       string
+		Encoding   *Encoding
+		WantOpen   string
+		WantClose  string
+		WantPaired bool
+	}{
+		{"yaml", YAMLEncoding, "---", "---", false},
+		{"toml", TOMLEncoding, "+++", "+++", false},
+		{"json", JSONEncoding, "{", "}", true},
+		{"pair", MustNewEncoding(WithDelimiterPair("<!--", "-->")), "<!--", "-->", true},
+		{"whole", YAMLEncoding.Clone(WithWholeDocument()), "", "", false},
+	}
+
+	for _, r := range runner {
+		open, close, paired := r.Encoding.Delimiters()
+		if r.WantOpen != open || r.WantClose != close || r.WantPaired != paired {
+			t.Errorf(r.Name+": \nwant: %q %q %t \nhave: %q %q %t", r.WantOpen, r.WantClose, r.WantPaired, open, close, paired)
+		}
+	}
+}
+
+func TestReset(t *testing.T) {
+	haveEnc := YAMLEncoding.Clone()
+	haveEnc.encodeFrontmatter(wantMetaData)
+	if len(haveEnc.fmBuf) != 1 {
+		t.Errorf("want: %d have: %d", 1, len(haveEnc.fmBuf))
+	}
+
+	haveEnc.Reset()
+	if len(haveEnc.fmBuf) != 0 {
+		t.Errorf("the cache should be empty after Reset: %d", len(haveEnc.fmBuf))
+	}
+
+	if haveEnc.start != YAMLDelimiter || haveEnc.end != YAMLDelimiter {
+		t.Errorf("want: %s %s have: %s %s", YAMLDelimiter, YAMLDelimiter, haveEnc.start, haveEnc.end)
+	}
+
+	// a split state that was changed is restored from the configuration
+	haveEnc.start, haveEnc.end, haveEnc.ioSplitFunc = "+++", "+++", SpaceSeparatedTokenDelimiters("+++ +++").SplitFunc
+	haveEnc.Reset()
+	if haveEnc.start != YAMLDelimiter || haveEnc.end != YAMLDelimiter {
+		t.Errorf("want: %s %s have: %s %s", YAMLDelimiter, YAMLDelimiter, haveEnc.start, haveEnc.end)
+	}
+
+	var haveMeta testMetaData
+	if _, err := haveEnc.DecodeString(testCaseData["YAML"]["file"], &haveMeta); err != nil || haveMeta.Name != "John Doe" {
+		t.Errorf("want: %q have: %q %v", "John Doe", haveMeta.Name, err)
+	}
+
+	wantMetaData.Title = "example YAML"
+	if want, have := testCaseData["YAML"]["file"], haveEnc.EncodeToString([]byte(wantContent), wantMetaData); want != have {
+		t.Errorf("\nwant: %q \nhave: %q", want, have)
+	}
+}
+
+func TestEncodeConcurrent(t *testing.T) {
+	haveEnc := YAMLEncoding.Clone()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				v := testMetaData{Name: "John Doe", Title: fmt.Sprint(i*j + j)}
+				want := fmt.Sprintf("---\nname: John Doe\ndate: \"\"\ntitle: \"%d\"\n---\n\n", i*j+j) + wantContent
+				if have := haveEnc.EncodeToString([]byte(wantContent), v); want != have {
+					t.Errorf("(%d): \nwant: %q \nhave: %q", i, want, have)
+					return
+				}
+
+				// decoding alongside a Reset
+				var haveMeta testMetaData
+				if _, err := haveEnc.DecodeString(want, &haveMeta); err != nil || v != haveMeta {
+					t.Errorf("(%d): \nwant: %+v \nhave: %+v %v", i, v, haveMeta, err)
+					return
+				}
+
+				if i == 0 && j%10 == 0 {
+					haveEnc.Reset()
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+}
+
+func TestEncodeLen(t *testing.T) {
+	var haveMarshals int
+	haveEnc := YAMLEncoding.Clone(WithMarshalFunc(func(v interface{}) ([]byte, error) {
+		haveMarshals++
+		return yaml.Marshal(v)
+	}))
+
+	wantMetaData.Title = "example YAML"
+	want := testCaseData["YAML"]["file"]
+
+	b := make([]byte, haveEnc.EncodeLen([]byte(wantContent), wantMetaData))
+	haveEnc.Reset() // a cache miss for Encode
+	haveEnc.Encode(b, []byte(wantContent), wantMetaData)
+
+	if want != string(b) {
+		t.Errorf("\nwant: %q \nhave: %q", want, string(b))
+	}
+
+	if haveMarshals != 1 {
+		t.Errorf("want: %d marshal have: %d", 1, haveMarshals)
+	}
+}
+
+func TestDecodedLen(t *testing.T) {
+	var runner = []struct {
+		Name     string
+		Encoding *Encoding
+		File     string
+		Want     int
+	}{
+		{"YAML", YAMLEncoding, testCaseData["YAML"]["file"], len(wantContent)},
+		{"TOML", TOMLEncoding, testCaseData["TOML"]["file"], len(wantContent)},
+		{"JSON", JSONEncoding, testCaseData["JSON"]["file"], len(wantContent)},
+		{"NoFrontmatter", YAMLEncoding, wantContent, len(wantContent)},
+		{"TrimSpace", YAMLEncoding.Clone(WithTrimSpace()), testCaseData["YAML"]["file"], len(wantContent) - 1},
+		{"Invalid", YAMLEncoding, "---\nname: [John, Doe\n---\n\n" + wantContent, len(wantContent)},
+	}
+
+	for _, r := range runner {
+		have, err := r.Encoding.DecodedLen([]byte(r.File))
+		if err != nil {
+			t.Errorf(r.Name+": err: %s", err)
+		}
+
+		if r.Want != have {
+			t.Errorf(r.Name+": want: %d have: %d", r.Want, have)
+		}
+	}
+}
+
+func TestContentHash(t *testing.T) {
+	want := sha256.Sum256([]byte(wantContent))
+
+	var runner = []struct {
+		Name     string
+		Encoding *Encoding
+		File     string
+	}{
+		{"YAML", YAMLEncoding, "---\nname: John Doe\ndate: 2016-10-10\n---\n\n" + wantContent},
+		{"YAMLUpdated", YAMLEncoding, "---\nname: John Doe\ndate: 2016-10-11\n---\n\n" + wantContent},
+		{"TOML", TOMLEncoding, testCaseData["TOML"]["file"]},
+		{"NoFrontmatter", YAMLEncoding, wantContent},
+		{"Invalid", YAMLEncoding, "---\nname: [John, Doe\n---\n\n" + wantContent},
+	}
+
+	for _, r := range runner {
+		have, err := r.Encoding.ContentHash([]byte(r.File), sha256.New())
+		if err != nil {
+			t.Errorf(r.Name+": err: %s", err)
+		}
+
+		if !bytes.Equal(want[:], have) {
+			t.Errorf(r.Name+": want: %x have: %x", want, have)
+		}
+	}
+
+	changed, _ := YAMLEncoding.ContentHash([]byte("---\nname: John Doe\n---\n\nThis is another file.\n"), sha256.New())
+	if bytes.Equal(want[:], changed) {
+		t.Errorf("(changed): want a different hash have: %x", changed)
+	}
+}
+
+func TestClone(t *testing.T) {
+	haveEnc := YAMLEncoding.Clone(WithIncludeDelimiter())
+
+	if YAMLEncoding.outputDelimiter {
+		t.Errorf("the original encoding should not be changed")
+	}
+
+	if !haveEnc.outputDelimiter {
+		t.Errorf("want: %+v have: %+v", true, haveEnc.outputDelimiter)
+	}
+
+	if YAMLEncoding.delimiter != haveEnc.delimiter {
+		t.Errorf("want: %+v have: %+v", YAMLEncoding.delimiter, haveEnc.delimiter)
+	}
+
+	if wantStart := YAMLDelimiter; wantStart != haveEnc.output.start {
+		t.Errorf("want: %+v have: %+v", wantStart, haveEnc.output.start)
+	}
+
+	v := testMetaData{Title: "example Clone"}
+	haveEnc.encodeFrontmatter(v)
+	if _, ok := YAMLEncoding.fmBuf[haveEnc.hashFrontmatter(v)]; ok {
+		t.Errorf("the clone should not share the frontmatter cache")
+	}
+
+	haveMetaData := testMetaData{}
+	haveContent, err := haveEnc.DecodeString(testCaseData["YAML"]["file"], &haveMetaData)
+	if err != nil {
+		t.Errorf("err: %s", err)
+	}
+
+	if wantContent != string(haveContent) {
+		t.Errorf("\nwant: %+v \nhave: %+v", wantContent, string(haveContent))
+	}
+}
+
+func TestDecodeWithExcerpt(t *testing.T) {
+	var runner = []struct {
+		Name        string
+		Encoding    *Encoding
+		File        string
+		WantExcerpt string
+		WantContent string
+	}{
+		{
+			Name:        "default separator",
+			Encoding:    YAMLEncoding,
+			File:        "---\ntitle: example\n---\n\nThe excerpt.\n---\nThe body.\n",
+			WantExcerpt: "The excerpt.\n",
+			WantContent: "The body.\n",
+		},
+		{
+			Name:        "custom separator",
+			Encoding:    TOMLEncoding.Clone(WithExcerptSeparator("<!-- more -->")),
+			File:        "+++\ntitle = \"example\"\n+++\n\nThe excerpt.\n<!-- more -->\nThe body.\n",
+			WantExcerpt: "The excerpt.\n",
+			WantContent: "The body.\n",
+		},
+		{
+			Name:        "no separator",
+			Encoding:    YAMLEncoding,
+			File:        "---\ntitle: example\n---\n\nThe body only.\n",
+			WantExcerpt: "",
+			WantContent: "The body only.\n",
+		},
+		{
+			Name:        "separator must be the whole line",
+			Encoding:    YAMLEncoding,
+			File:        "---\ntitle: example\n---\n\nThe --- body only.\n",
+			WantExcerpt: "",
+			WantContent: "The --- body only.\n",
+		},
+	}
+
+	for _, r := range runner {
+		v := struct{ Title string }{}
+		haveExcerpt, haveContent, err := r.Encoding.DecodeWithExcerpt([]byte(r.File), &v)
+		if err != nil {
+			t.Errorf(r.Name+": err: %s", err)
+		}
+
+		if v.Title != "example" {
+			t.Errorf(r.Name+": want: %+v have: %+v", "example", v.Title)
+		}
+
+		if r.WantExcerpt != string(haveExcerpt) {
+			t.Errorf(r.Name+": \nwant: %q \nhave: %q", r.WantExcerpt, string(haveExcerpt))
+		}
+
+		if r.WantContent != string(haveContent) {
+			t.Errorf(r.Name+": \nwant: %q \nhave: %q", r.WantContent, string(haveContent))
+		}
+	}
+}
+
+func TestDecodeStringMap(t *testing.T) {
+	var runner = []struct {
+		Name     string
+		Encoding *Encoding
+		File     string
+		WantMap  map[string]interface{}
+	}{
+		{"YAML", YAMLEncoding, "---\ntitle: example\ncount: 3\n---\n\n" + wantContent,
+			map[string]interface{}{"title": "example", "count": 3}},
+		{"TOML", TOMLEncoding, "+++\ntitle = \"example\"\ncount = 3\n+++\n\n" + wantContent,
+			map[string]interface{}{"title": "example", "count": int64(3)}},
+		{"JSON", JSONEncoding, "{\n\"title\": \"example\",\n\"count\": 3\n}\n\n" + wantContent,
+			map[string]interface{}{"title": "example", "count": float64(3)}},
+	}
+
+	for _, r := range runner {
+		haveMap, haveContent, err := r.Encoding.DecodeStringMap(r.File)
+		if err != nil {
+			t.Errorf(r.Name+": err: %s", err)
+		}
+
+		if !reflect.DeepEqual(r.WantMap, haveMap) {
+			t.Errorf(r.Name+": \nwant: %#v \nhave: %#v", r.WantMap, haveMap)
+		}
+
+		if wantContent != string(haveContent) {
+			t.Errorf(r.Name+": \nwant: %+v \nhave: %+v", wantContent, string(haveContent))
+		}
+	}
+}
+
+func TestMarshalFuncPanics(t *testing.T) {
+	haveEnc := YAMLEncoding.Clone(
+		WithMarshalFunc(func(interface{}) ([]byte, error) { panic("marshal boom") }),
+		WithUnmarshalFunc(func([]byte, interface{}) error { panic("unmarshal boom") }),
+	)
+
+	_, err := haveEnc.DecodeString(testCaseData["YAML"]["file"], &testMetaData{})
+	if !errors.Is(err, ErrUnmarshalPanic) {
+		t.Errorf("want: %+v have: %+v", ErrUnmarshalPanic, err)
+	}
+
+	if err != nil && !strings.Contains(err.Error(), "unmarshal boom") {
+		t.Errorf("the recovered value is missing from the error: %s", err)
+	}
+
+	_, err = NewEncoder(haveEnc, new(bytes.Buffer), wantMetaData)
+	if !errors.Is(err, ErrMarshalPanic) {
+		t.Errorf("want: %+v have: %+v", ErrMarshalPanic, err)
+	}
+}
+
+func TestMarshalFallback(t *testing.T) {
+	// jsonStrings marshals to TOML with the arrays that TOML can't hold
+	// (mixed types) written as JSON strings.
+	jsonStrings := func(v interface{}) ([]byte, error) {
+		m := make(map[string]interface{})
+		for k, val := range v.(map[string]interface{}) {
+			if _, err := tomlMarshal(map[string]interface{}{k: val}); err != nil {
+				b, err := json.Marshal(val)
+				if err != nil {
+					return nil, err
+				}
+				val = string(b)
+			}
+			m[k] = val
+		}
+		return tomlMarshal(m)
+	}
+
+	metaData := map[string]interface{}{"title": "example", "mixed": []interface{}{1, "a"}}
+	if _, err := TOMLEncoding.AppendEncode(nil, []byte(wantContent), metaData); err == nil {
+		t.Error("(without): want an encode error")
+	}
+
+	var runner = []struct {
+		Name     string
+		Encoding *Encoding
+		Want     string
+	}{
+		{"Fallback", TOMLEncoding.Clone(WithMarshalFallback(jsonStrings)), "+++\nmixed = \"[1,\\\"a\\\"]\"\ntitle = \"example\"\n+++\n\n" + wantContent},
+		{"Panic", TOMLEncoding.Clone(
+			WithMarshalFunc(func(interface{}) ([]byte, error) { panic("marshal boom") }),
+			WithMarshalFallback(jsonStrings),
+		), "+++\nmixed = \"[1,\\\"a\\\"]\"\ntitle = \"example\"\n+++\n\n" + wantContent},
+	}
+
+	for _, r := range runner {
+		have, err := r.Encoding.AppendEncode(nil, []byte(wantContent), metaData)
+		if err != nil {
+			t.Errorf(r.Name+"(AppendEncode): err: %s", err)
+		}
+
+		if r.Want != string(have) {
+			t.Errorf(r.Name+"(AppendEncode): \nwant: %q \nhave: %q", r.Want, string(have))
+		}
+	}
+
+	failing := TOMLEncoding.Clone(WithMarshalFallback(func(interface{}) ([]byte, error) { return nil, errors.New("fallback boom") }))
+	if _, err := failing.AppendEncode(nil, []byte(wantContent), metaData); err == nil || !strings.Contains(err.Error(), "fallback boom") {
+		t.Errorf("want: the fallback error have: %v", err)
+	}
+}
+
+func TestStrictUnmarshal(t *testing.T) {
+	var runner = []struct {
+		Name     string
+		Encoding *Encoding
+		File     string
+	}{
+		{"YAML", YAMLEncoding, "---\ntitle: example\ntitel: typo\n---\n\n" + wantContent},
+		{"TOML", TOMLEncoding, "+++\ntitle = \"example\"\ntitel = \"typo\"\n+++\n\n" + wantContent},
+		{"JSON", JSONEncoding, "{\n\"title\": \"example\",\n\"titel\": \"typo\"\n}\n\n" + wantContent},
+	}
+
+	for _, r := range runner {
+		v := struct {
+			Title string `yaml:"title" toml:"title" json:"title"`
+		}{}
+
+		if _, err := r.Encoding.DecodeString(r.File, &v); err != nil {
+			t.Errorf(r.Name+"(lenient): err: %s", err)
+		}
+
+		if v.Title != "example" {
+			t.Errorf(r.Name+"(lenient): want: %+v have: %+v", "example", v.Title)
+		}
+
+		if _, err := r.Encoding.Clone(WithStrictUnmarshal()).DecodeString(r.File, &v); err == nil {
+			t.Errorf(r.Name + "(strict): expected an error for an unknown key")
+		}
+	}
+}
+
+func TestEncoderClose(t *testing.T) {
+	wantMetaData.Title = "example YAML"
+	wantFile := testCaseData["YAML"]["file"]
+
+	haveContent := new(bytes.Buffer)
+	out, err := NewEncoder(YAMLEncoding.Clone(WithTrailer("<!-- end -->\n")), haveContent, wantMetaData)
+	if err != nil {
+		t.Errorf("err: %s", err)
+	}
+	out.Write([]byte(wantContent))
+
+	if wantFile != haveContent.String() {
+		t.Errorf("before close: \nwant: %+v \nhave: %+v", wantFile, haveContent.String())
+	}
+
+	if err := out.Close(); err != nil {
+		t.Errorf("err: %s", err)
+	}
+	out.Close() // a second close should not write the trailer again
+
+	if want := wantFile + "<!-- end -->\n"; want != haveContent.String() {
+		t.Errorf("after close: \nwant: %+v \nhave: %+v", want, haveContent.String())
+	}
+
+	haveContent.Reset()
+	out, _ = NewEncoder(YAMLEncoding, haveContent, wantMetaData)
+	out.Write([]byte(wantContent))
+	out.Close()
+
+	if wantFile != haveContent.String() {
+		t.Errorf("no trailer: \nwant: %+v \nhave: %+v", wantFile, haveContent.String())
+	}
+}
+
+func TestDecodeNoFrontmatter(t *testing.T) {
+	wantFile := "This is an example file.\n---\nwith a rule.\n"
+
+	for _, enc := range []*Encoding{YAMLEncoding, TOMLEncoding, JSONEncoding} {
+		haveMetaData := testMetaData{Name: "untouched"}
+		haveContent, err := enc.DecodeString(wantFile, &haveMetaData)
+		if err != nil {
+			t.Errorf("(DecodeString): err: %s", err)
+		}
+
+		if wantFile != string(haveContent) {
+			t.Errorf("(DecodeString): \nwant: %+v \nhave: %+v", wantFile, string(haveContent))
+		}
+
+		if haveMetaData.Name != "untouched" {
+			t.Errorf("(DecodeString): the metadata should be untouched: %+v", haveMetaData)
+		}
+
+		out, err := NewDecoder(enc, strings.NewReader(wantFile), &haveMetaData)
+		if err != nil {
+			t.Errorf("(NewDecoder): err: %s", err)
+		}
+
+		haveContentBuf := new(bytes.Buffer)
+		haveContentBuf.ReadFrom(out)
+		if wantFile != haveContentBuf.String() {
+			t.Errorf("(NewDecoder): \nwant: %+v \nhave: %+v", wantFile, haveContentBuf.String())
+		}
+
+		haveContent = make([]byte, len(wantFile))
+		n, err := enc.Decode(haveContent, []byte(wantFile), &haveMetaData)
+		if err != nil {
+			t.Errorf("(Decode): err: %s", err)
+		}
+
+		if wantFile != string(haveContent[:n]) {
+			t.Errorf("(Decode): \nwant: %+v \nhave: %+v", wantFile, string(haveContent[:n]))
+		}
+	}
+}
+
+// noFrontmatterFile is a 100KB file without any frontmatter.
+var noFrontmatterFile = bytes.Repeat([]byte("This is an example file without any frontmatter.\n"), 100*1024/50)
+
+func BenchmarkDecodeNoFrontmatter(b *testing.B) {
+	dst := make([]byte, len(noFrontmatterFile))
+	v := testMetaData{}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		YAMLEncoding.Decode(dst, noFrontmatterFile, &v)
+	}
+}
+
+func BenchmarkDecodeNoFrontmatterSplit(b *testing.B) {
+	dst := make([]byte, len(noFrontmatterFile))
+	v := testMetaData{}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		// the full split machinery that is skipped by the fast path
+		m, r := YAMLEncoding.readFrom(bytes.NewReader(noFrontmatterFile))
+		YAMLEncoding.readUnmarshal(m, &v)
+		io.ReadFull(r, dst)
+	}
+}
+
+func TestFooterPosition(t *testing.T) {
+	var runner = []struct {
+		Name     string
+		Encoding *Encoding
+		File     string
+	}{
+		{"YAML", YAMLEncoding.Clone(WithPosition(FooterPosition)), `This is an example file.
+
+---
+name: John Doe
+date: 10-10-2016
+title: example YAML
+---
+`},
+		{"JSON", JSONEncoding.Clone(WithPosition(FooterPosition)), `This is an example file.
+
+{
+	"Name": "John Doe",
+	"Date": "10-10-2016",
+	"Title": "example JSON"
+}
+`},
+	}
+
+	for _, r := range runner {
+		wantMetaData.Title = "example " + r.Name
+
+		haveMetaData := testMetaData{}
+		haveContent, err := r.Encoding.DecodeString(r.File, &haveMetaData)
+		if err != nil {
+			t.Errorf(r.Name+"(DecodeString): err: %s", err)
+		}
+
+		if wantContent != string(haveContent) {
+			t.Errorf(r.Name+"(DecodeString): \nwant: %q \nhave: %q", wantContent, string(haveContent))
+		}
+
+		if !reflect.DeepEqual(wantMetaData, haveMetaData) {
+			t.Errorf(r.Name+"(DecodeString): \nwant: %+v \nhave: %+v", wantMetaData, haveMetaData)
+		}
+
+		haveFile := r.Encoding.EncodeToString([]byte(wantContent), wantMetaData)
+		if r.File != haveFile {
+			t.Errorf(r.Name+"(EncodeToString): \nwant: %q \nhave: %q", r.File, haveFile)
+		}
+
+		haveFileBuf := new(bytes.Buffer)
+		out, _ := NewEncoder(r.Encoding, haveFileBuf, wantMetaData)
+		out.Write([]byte(wantContent))
+		out.Close()
+
+		if r.File != haveFileBuf.String() {
+			t.Errorf(r.Name+"(NewEncoder): \nwant: %q \nhave: %q", r.File, haveFileBuf.String())
+		}
+	}
+
+	haveMetaData := testMetaData{}
+	haveContent, err := YAMLEncoding.Clone(WithPosition(FooterPosition)).DecodeString(wantContent, &haveMetaData)
+	if err != nil {
+		t.Errorf("(no footer): err: %s", err)
+	}
+
+	if wantContent != string(haveContent) {
+		t.Errorf("(no footer): \nwant: %q \nhave: %q", wantContent, string(haveContent))
+	}
+
+	// a start delimiter line inside the footer doesn't start the block when
+	// the block from it doesn't parse
+	for _, r := range []struct {
+		Name     string
+		Encoding *Encoding
+		File     string
+		Want     map[string]interface{}
+		Content  string
+	}{
+		{"YAML", YAMLEncoding.Clone(WithPosition(FooterPosition)), wantContent + "\n---\nname: John Doe\n---\n- a\n---\n", map[string]interface{}{"name": "John Doe"}, wantContent},
+		{"TOML", TOMLEncoding.Clone(WithPosition(FooterPosition)), wantContent + "\n+++\nname = \"\"\"\n+++\n\"\"\"\n+++\n", map[string]interface{}{"name": "+++\n"}, wantContent},
+		{"Rule", YAMLEncoding.Clone(WithPosition(FooterPosition)), "above\n---\nbelow\n\n---\nname: John Doe\n---\n", map[string]interface{}{"name": "John Doe"}, "above\n---\nbelow\n"},
+		{"Invalid", YAMLEncoding.Clone(WithPosition(FooterPosition)), wantContent + "\n---\n- a\n---\n", nil, wantContent},
+	} {
+		have := make(map[string]interface{})
+		haveContent, err := r.Encoding.DecodeString(r.File, &have)
+		if r.Want == nil {
+			if err == nil {
+				t.Errorf(r.Name+"(inside): want an error have: %v", have)
+			}
+			continue
+		}
+
+		if err != nil || r.Content != string(haveContent) || !reflect.DeepEqual(r.Want, have) {
+			t.Errorf(r.Name+"(inside): \nwant: %v %q \nhave: %v %q %v", r.Want, r.Content, have, string(haveContent), err)
+		}
+	}
+}
+
+func TestDecodeLocated(t *testing.T) {
+	var runner = []struct {
+		Name     string
+		Encoding *Encoding
+		File     string
+		WantLoc  Location
+	}{
+		{"YAML", YAMLEncoding, testCaseData["YAML"]["file"], Location{Start: 4, End: 55, LineStart: 2, LineEnd: 4}},
+		{"TOML", TOMLEncoding, testCaseData["TOML"]["file"], Location{Start: 4, End: 64, LineStart: 2, LineEnd: 4}},
+		{"JSON", JSONEncoding, testCaseData["JSON"]["file"], Location{Start: 0, End: 72, LineStart: 1, LineEnd: 5}},
+		{"None", YAMLEncoding, wantContent, Location{}},
+	}
+
+	for _, r := range runner {
+		haveMetaData := testMetaData{}
+		haveContent, haveLoc, err := r.Encoding.DecodeLocated([]byte(r.File), &haveMetaData)
+		if err != nil {
+			t.Errorf(r.Name+": err: %s", err)
+		}
+
+		if wantContent != string(haveContent) {
+			t.Errorf(r.Name+": \nwant: %q \nhave: %q", wantContent, string(haveContent))
+		}
+
+		if r.WantLoc != haveLoc {
+			t.Errorf(r.Name+": \nwant: %+v \nhave: %+v", r.WantLoc, haveLoc)
+		}
+
+		if r.WantLoc.End > 0 {
+			lines := strings.Split(r.File, "\n")
+			if want, have := lines[r.WantLoc.LineEnd-1], r.File[:r.WantLoc.End]; !strings.HasSuffix(have, want) {
+				t.Errorf(r.Name+": the last line should end the location \nwant: %q \nhave: %q", want, have)
+			}
+		}
+	}
+}
+
+func TestFenceValidation(t *testing.T) {
+	var runner = []struct {
+		Name        string
+		File        string
+		WantContent string
+		WantTitle   string
+	}{
+		{
+			Name:        "horizontal rules",
+			File:        "---\n\nA paragraph between rules.\n\n---\n\nAnother paragraph.\n\n---\n",
+			WantContent: "---\n\nA paragraph between rules.\n\n---\n\nAnother paragraph.\n\n---\n",
+		},
+		{
+			Name:        "frontmatter then horizontal rules",
+			File:        "---\ntitle: example\n---\n\nA paragraph.\n\n---\n\nAnother paragraph.\n",
+			WantContent: "A paragraph.\n\n---\n\nAnother paragraph.\n",
+			WantTitle:   "example",
+		},
+	}
+
+	haveEnc := YAMLEncoding.Clone(WithFenceValidation())
+	for _, r := range runner {
+		v := struct{ Title string }{}
+		haveContent, err := haveEnc.DecodeString(r.File, &v)
+		if err != nil {
+			t.Errorf(r.Name+": err: %s", err)
+		}
+
+		if r.WantContent != string(haveContent) {
+			t.Errorf(r.Name+": \nwant: %q \nhave: %q", r.WantContent, string(haveContent))
+		}
+
+		if r.WantTitle != v.Title {
+			t.Errorf(r.Name+": want: %+v have: %+v", r.WantTitle, v.Title)
+		}
+	}
+}
+
+func TestAppendEncode(t *testing.T) {
+	for _, name := range []string{"YAML", "TOML", "JSON"} {
+		enc := map[string]*Encoding{"YAML": YAMLEncoding, "TOML": TOMLEncoding, "JSON": JSONEncoding}[name]
+		wantMetaData.Title = "example " + name
+
+		wantPrefix := "prefix:"
+		have, err := enc.AppendEncode([]byte(wantPrefix), []byte(wantContent), wantMetaData)
+		if err != nil {
+			t.Errorf(name+": err: %s", err)
+		}
+
+		if want := wantPrefix + testCaseData[name]["file"]; want != string(have) {
+			t.Errorf(name+": \nwant: %q \nhave: %q", want, string(have))
+		}
+	}
+
+	haveEnc := YAMLEncoding.Clone(WithMarshalFunc(func(interface{}) ([]byte, error) {
+		return nil, errors.New("marshal error")
+	}))
+
+	have, err := haveEnc.AppendEncode([]byte("prefix:"), []byte(wantContent), wantMetaData)
+	if err == nil {
+		t.Errorf("expected a marshal error")
+	}
+
+	if string(have) != "prefix:" {
+		t.Errorf("want: %q have: %q", "prefix:", string(have))
+	}
+}
+
+func TestJSONPreamble(t *testing.T) {
+	wantMetaData.Title = "example JSON"
+	wantFile := testCaseData["JSON"]["file"]
+
+	var runner = []struct {
+		Name     string
+		Preamble string
+	}{
+		{"blank line", "\n"},
+		{"blank lines and spaces", "\n  \n\t\n"},
+		{"comments", "#!/usr/bin/env render\n// a comment\n"},
+	}
+
+	for _, r := range runner {
+		haveMetaData := testMetaData{}
+		haveContent, err := JSONEncoding.DecodeString(r.Preamble+wantFile, &haveMetaData)
+		if err != nil {
+			t.Errorf(r.Name+": err: %s", err)
+		}
+
+		if wantContent != string(haveContent) {
+			t.Errorf(r.Name+": \nwant: %q \nhave: %q", wantContent, string(haveContent))
+		}
+
+		if !reflect.DeepEqual(wantMetaData, haveMetaData) {
+			t.Errorf(r.Name+": \nwant: %+v \nhave: %+v", wantMetaData, haveMetaData)
+		}
+
+		_, haveLoc, _ := JSONEncoding.DecodeLocated([]byte(r.Preamble+wantFile), &haveMetaData)
+		if want := len(r.Preamble); want != haveLoc.Start {
+			t.Errorf(r.Name+": want: %+v have: %+v", want, haveLoc.Start)
+		}
+	}
+
+	// without frontmatter the preamble is kept as content
+	var noBlock = []struct {
+		Name string
+		File string
+	}{
+		{"no block", "\n# not a comment without frontmatter\n\nThis is an example file.\n"},
+		{"a line starting with a bracket", "# T\n{{< figure >}}\nbody\n"},
+		{"a bracket at the end", "\n{"},
+		{"a block that isn't closed", "# T\n{\n\"title\": \"example\"\nbody\n"},
+	}
+
+	for _, r := range noBlock {
+		haveContent, err := JSONEncoding.DecodeString(r.File, &testMetaData{})
+		if err != nil {
+			t.Errorf(r.Name+": err: %s", err)
+		}
+
+		if r.File != string(haveContent) {
+			t.Errorf(r.Name+": \nwant: %q \nhave: %q", r.File, string(haveContent))
+		}
+
+		rs, err := JSONEncoding.DecodeSeeker(strings.NewReader(r.File), &testMetaData{})
+		if err != nil {
+			t.Errorf(r.Name+"(seeker): err: %s", err)
+			continue
+		}
+
+		if haveContent, _ := ioutil.ReadAll(rs); r.File != string(haveContent) {
+			t.Errorf(r.Name+"(seeker): \nwant: %q \nhave: %q", r.File, string(haveContent))
+		}
+	}
+}
+
+func TestDecodeOptions(t *testing.T) {
+	wantFile := "---\ntitle: example\ntitel: typo\n---\n\n" + wantContent
+	v := struct {
+		Title string `yaml:"title"`
+	}{}
+
+	haveEnc := YAMLEncoding.Clone(WithStrictUnmarshal())
+	if _, err := haveEnc.DecodeString(wantFile, &v); err == nil {
+		t.Errorf("(strict): expected an error for an unknown key")
+	}
+
+	if _, err := haveEnc.DecodeString(wantFile, &v, WithoutStrictUnmarshal()); err != nil {
+		t.Errorf("(lenient call): err: %s", err)
+	}
+
+	if _, err := YAMLEncoding.DecodeString(wantFile, &v, WithStrictUnmarshal()); err == nil {
+		t.Errorf("(strict call): expected an error for an unknown key")
+	}
+
+	if YAMLEncoding.strictUnmarshal || !haveEnc.strictUnmarshal {
+		t.Errorf("per call options should not change the encoding")
+	}
+
+	haveContent, err := YAMLEncoding.DecodeString("\xef\xbb\xbf"+wantFile, &v, WithStripBOM())
+	if err != nil {
+		t.Errorf("(BOM): err: %s", err)
+	}
+
+	if wantContent != string(haveContent) {
+		t.Errorf("(BOM): \nwant: %q \nhave: %q", wantContent, string(haveContent))
+	}
+
+	_, err = YAMLEncoding.DecodeReader(strings.NewReader(wantFile), &v, WithMaxSize(10))
+	if !errors.Is(err, ErrMaxSize) {
+		t.Errorf("(DecodeReader max size): want: %v have: %v", ErrMaxSize, err)
+	}
+
+	_, err = YAMLEncoding.DecodeReader(strings.NewReader(wantContent), &v, WithMaxSize(10))
+	if !errors.Is(err, ErrMaxSize) {
+		t.Errorf("(DecodeReader max size no frontmatter): want: %v have: %v", ErrMaxSize, err)
+	}
+
+	if _, err = YAMLEncoding.DecodeString(wantFile, &v, WithMaxSize(10)); !errors.Is(err, ErrMaxSize) {
+		t.Errorf("(DecodeString max size): want: %v have: %v", ErrMaxSize, err)
+	}
+
+	haveContent, err = YAMLEncoding.DecodeReader(strings.NewReader(wantFile), &v, WithMaxSize(int64(len(wantFile))))
+	if err != nil {
+		t.Errorf("(max size): err: %s", err)
+	}
+
+	if wantContent != string(haveContent) {
+		t.Errorf("(max size): \nwant: %q \nhave: %q", wantContent, string(haveContent))
+	}
+
+	// a per call delimiter derives the split state of the copy only
+	v.Title = ""
+	haveContent, err = YAMLEncoding.DecodeString("<!--\ntitle: example\n-->\n\n"+wantContent, &v, WithDelimiterPair("<!--", "-->"))
+	if err != nil || wantContent != string(haveContent) || v.Title != "example" {
+		t.Errorf("(delimiter pair): \nwant: %q \nhave: %q %v", wantContent, string(haveContent), err)
+	}
+
+	if open, close, _ := YAMLEncoding.Delimiters(); open != YAMLDelimiter || close != YAMLDelimiter {
+		t.Errorf("(delimiter pair): want: %s %s have: %s %s", YAMLDelimiter, YAMLDelimiter, open, close)
+	}
+
+	// a per call option also applies to the encode functions
+	wantMetaData.Title = "example YAML"
+	wantEncoded := YAMLEncoding.Clone(WithHeaderComment("generated")).EncodeToString([]byte(wantContent), wantMetaData)
+	haveEncoded := YAMLEncoding.EncodeToString([]byte(wantContent), wantMetaData, WithHeaderComment("generated"))
+	if wantEncoded != haveEncoded {
+		t.Errorf("(encode): \nwant: %q \nhave: %q", wantEncoded, haveEncoded)
+	}
+
+	if wantEncoded == YAMLEncoding.EncodeToString([]byte(wantContent), wantMetaData) {
+		t.Errorf("(encode): per call options should not change the encoding")
+	}
+
+	// an option that fails is returned by the call, not panicked
+	errOption := errors.New("option failed")
+	failing := func(*Encoding) error { return errOption }
+
+	var runner = []struct {
+		Name string
+		Fn   func() error
+	}{
+		{"DecodeString", func() error {
+			_, err := YAMLEncoding.DecodeString(wantFile, &v, failing)
+			return err
+		}},
+		{"DecodeReader", func() error {
+			_, err := YAMLEncoding.DecodeReader(strings.NewReader(wantFile), &v, failing)
+			return err
+		}},
+		{"DecodePreview", func() error {
+			_, _, err := YAMLEncoding.DecodePreview([]byte(wantFile), &v, 10, failing)
+			return err
+		}},
+		{"DecodeStringMap", func() error {
+			_, _, err := YAMLEncoding.DecodeStringMap(wantFile, failing)
+			return err
+		}},
+		{"DecodeLocated", func() error {
+			_, _, err := YAMLEncoding.DecodeLocated([]byte(wantFile), &v, failing)
+			return err
+		}},
+		{"Metadata", func() error {
+			return YAMLEncoding.Metadata([]byte(wantFile), &v, failing)
+		}},
+		{"StripFrontmatter", func() error {
+			_, err := YAMLEncoding.StripFrontmatter([]byte(wantFile), failing)
+			return err
+		}},
+		{"DecodeTo", func() error {
+			return YAMLEncoding.DecodeTo(strings.NewReader(wantFile), &v, ioutil.Discard, failing)
+		}},
+		{"NewDecoder", func() error {
+			_, err := NewDecoder(YAMLEncoding, strings.NewReader(wantFile), &v, failing)
+			return err
+		}},
+		{"NewLazyDecoder", func() error {
+			return NewLazyDecoder(YAMLEncoding, strings.NewReader(wantFile), failing).Metadata(&v)
+		}},
+		{"AppendEncode", func() error {
+			_, err := YAMLEncoding.AppendEncode(nil, []byte(wantContent), v, failing)
+			return err
+		}},
+		{"NewEncoder", func() error {
+			_, err := NewEncoder(YAMLEncoding, ioutil.Discard, v, failing)
+			return err
+		}},
+	}
+
+	for _, r := range runner {
+		if err := r.Fn(); err != errOption {
+			t.Errorf(r.Name+": want: %v have: %v", errOption, err)
+		}
+	}
+
+	// the fenced encodings are copied along with the options
+	fenced := NewMultiFenceEncoding(YAMLEncoding, TOMLEncoding)
+	if _, err := fenced.DecodeString(wantFile, &v, failing); err != errOption {
+		t.Errorf("(fenced): want: %v have: %v", errOption, err)
+	}
+}
+
+func TestBlankLineDelimiter(t *testing.T) {
+	haveEnc := MustNewEncoding(
+		WithDelimiter("%%%"),
+		WithMarshalFunc(yaml.Marshal),
+		WithUnmarshalFunc(yaml.Unmarshal),
+		WithSplitFunc(BlankLineDelimiter),
+	)
+
+	wantMetaData.Title = "example YAML"
+	wantFile := "%%%\nname: John Doe\ndate: 10-10-2016\ntitle: example YAML\n\n" + wantContent
+
+	haveMetaData := testMetaData{}
+	haveContent, err := haveEnc.DecodeString(wantFile, &haveMetaData)
+	if err != nil {
+		t.Errorf("err: %s", err)
+	}
+
+	if wantContent != string(haveContent) {
+		t.Errorf("\nwant: %q \nhave: %q", wantContent, string(haveContent))
+	}
+
+	if !reflect.DeepEqual(wantMetaData, haveMetaData) {
+		t.Errorf("\nwant: %+v \nhave: %+v", wantMetaData, haveMetaData)
+	}
+
+	haveMetaData = testMetaData{}
+	haveContent, err = haveEnc.DecodeString(haveEnc.EncodeToString([]byte(wantContent), wantMetaData), &haveMetaData)
+	if err != nil {
+		t.Errorf("(round trip): err: %s", err)
+	}
+
+	if wantContent != string(haveContent) {
+		t.Errorf("(round trip): \nwant: %q \nhave: %q", wantContent, string(haveContent))
+	}
+
+	if !reflect.DeepEqual(wantMetaData, haveMetaData) {
+		t.Errorf("(round trip): \nwant: %+v \nhave: %+v", wantMetaData, haveMetaData)
+	}
+}
+
+func TestDecodeDelimiterChunks(t *testing.T) {
+	var runner = []struct {
+		Name        string
+		Encoding    *Encoding
+		File        string
+		WantContent string
+		WantMatter  string
+	}{
+		{"delimiter only", YAMLEncoding, "---", "---", ""},
+		{"metadata line is a delimiter", TOMLEncoding, "+++\n+++x\n+++\n\nbody", "body", "+++x"},
+		{"content is a delimiter", TOMLEncoding, "+++\na = 1\n+++\n\n+++", "+++", "a = 1"},
+	}
+
+	for _, r := range runner {
+		m, c := r.Encoding.readFrom(strings.NewReader(r.File))
+
+		haveMatter, _ := ioutil.ReadAll(m)
+		haveContent, _ := ioutil.ReadAll(c)
+
+		if r.WantMatter != string(haveMatter) {
+			t.Errorf(r.Name+": \nwant: %q \nhave: %q", r.WantMatter, string(haveMatter))
+		}
+
+		if r.WantContent != string(haveContent) {
+			t.Errorf(r.Name+": \nwant: %q \nhave: %q", r.WantContent, string(haveContent))
+		}
+	}
+}
+
+func TestTrimDelimiterWhitespace(t *testing.T) {
+	var runner = []struct {
+		Name         string
+		Encoding     *Encoding
+		File         string
+		WantContent  string
+		WantMetaData testMetaData
+	}{
+		{"YAML", YAMLEncoding, "--- \nname: John Doe\n---\t \n\n" + wantContent, wantContent, testMetaData{Name: "John Doe"}},
+		{"YAML exact", YAMLEncoding, "---\nname: John Doe\n---\n\n" + wantContent, wantContent, testMetaData{Name: "John Doe"}},
+		{"YAML content", YAMLEncoding, "--- \nname: John Doe\n--- \n\n--- \n" + wantContent, "--- \n" + wantContent, testMetaData{Name: "John Doe"}},
+		{"YAML not a delimiter", YAMLEncoding, "--- x\nname: John Doe\n--- \n\n" + wantContent, "--- x\nname: John Doe\n--- \n\n" + wantContent, testMetaData{}},
+		{"TOML", TOMLEncoding, "+++ \nname = \"John Doe\"\n+++ \n\n" + wantContent, wantContent, testMetaData{Name: "John Doe"}},
+		{"YAML CRLF", YAMLEncoding.Clone(WithCRLFDelimiters()), "--- \r\nname: John Doe\r\n---\t\r\n\r\n" + wantContent, wantContent, testMetaData{Name: "John Doe"}},
+		{"JSON", JSONEncoding, "{ \n\"name\": \"John Doe\"\n}\t\n\n" + wantContent, wantContent, testMetaData{Name: "John Doe"}},
+	}
+
+	for _, r := range runner {
+		e := r.Encoding.Clone(WithTrimDelimiterWhitespace())
+
+		haveMetaData := testMetaData{}
+		haveContent, err := e.DecodeString(r.File, &haveMetaData)
+		if err != nil {
+			t.Errorf(r.Name+"(DecodeString): err: %s", err)
+		}
+
+		if r.WantContent != string(haveContent) {
+			t.Errorf(r.Name+"(DecodeString): \nwant: %q \nhave: %q", r.WantContent, string(haveContent))
+		}
+
+		if r.WantMetaData != haveMetaData {
+			t.Errorf(r.Name+"(DecodeString): \nwant: %+v \nhave: %+v", r.WantMetaData, haveMetaData)
+		}
+
+		haveMetaData = testMetaData{}
+		offset, err := e.DecodeReaderAt(strings.NewReader(r.File), 8, &haveMetaData)
+		if err != nil {
+			t.Errorf(r.Name+"(DecodeReaderAt): err: %s", err)
+		}
+
+		if r.WantMetaData != haveMetaData || !strings.HasSuffix(r.File[offset:], r.WantContent) {
+			t.Errorf(r.Name+"(DecodeReaderAt): \nwant: %+v %q \nhave: %+v %q", r.WantMetaData, r.WantContent, haveMetaData, r.File[offset:])
+		}
+	}
+
+	haveMetaData := testMetaData{}
+	haveContent, err := YAMLEncoding.DecodeString("--- \nname: John Doe\n---\n\n"+wantContent, &haveMetaData)
+	if err != nil || haveMetaData.Name != "" || !strings.HasPrefix(string(haveContent), "--- \n") {
+		t.Errorf("(without): want the block left as content have: %+v %q %v", haveMetaData, string(haveContent), err)
+	}
+}
+
+func TestNoTrailingSeparatorOnEmptyContent(t *testing.T) {
+	var runner = []struct {
+		Name     string
+		Encoding *Encoding
+		Src      string
+		Want     string
+	}{
+		{"YAML", YAMLEncoding, "", "---\nname: John Doe\n---\n"},
+		{"YAML content", YAMLEncoding, wantContent, "---\nname: John Doe\n---\n\n" + wantContent},
+		{"TOML", TOMLEncoding, "", "+++\nname = \"John Doe\"\n+++\n"},
+		{"Footer", YAMLEncoding.Clone(WithPosition(FooterPosition)), "", "---\nname: John Doe\n---\n"},
+		{"Separator", YAMLEncoding.Clone(WithContentSeparator("<!-- -->\n")), "", "---\nname: John Doe\n---\n"},
+	}
+
+	v := map[string]interface{}{"name": "John Doe"}
+	for _, r := range runner {
+		e := r.Encoding.Clone(WithNoTrailingSeparatorOnEmptyContent())
+
+		have, err := e.AppendEncode(nil, []byte(r.Src), v)
+		if err != nil {
+			t.Errorf(r.Name+"(AppendEncode): err: %s", err)
+		}
+
+		if r.Want != string(have) {
+			t.Errorf(r.Name+"(AppendEncode): \nwant: %q \nhave: %q", r.Want, string(have))
+		}
+
+		if have := e.EncodeToString([]byte(r.Src), v); r.Want != have {
+			t.Errorf(r.Name+"(EncodeToString): \nwant: %q \nhave: %q", r.Want, have)
+		}
+
+		buf := new(bytes.Buffer)
+		if _, err := e.EncodeStream(buf, strings.NewReader(r.Src), v); err != nil || r.Want != buf.String() {
+			t.Errorf(r.Name+"(EncodeStream): \nwant: %q \nhave: %q %v", r.Want, buf.String(), err)
+		}
+
+		haveMap := make(map[string]interface{})
+		haveContent, err := e.DecodeString(r.Want, &haveMap)
+		if err != nil || r.Src != string(haveContent) || haveMap["name"] != "John Doe" {
+			t.Errorf(r.Name+"(DecodeString): want: %q %v have: %q %v %v", r.Src, v, string(haveContent), haveMap, err)
+		}
+	}
+
+	if have, _ := YAMLEncoding.AppendEncode(nil, nil, v); string(have) != "---\nname: John Doe\n---\n\n" {
+		t.Errorf("(without): want the blank line have: %q", string(have))
+	}
+}
+
+func TestOmitEmptyFrontmatter(t *testing.T) {
+	var runner = []struct {
+		Name     string
+		Encoding *Encoding
+		MetaData interface{}
+		Want     string
+	}{
+		{"YAML", YAMLEncoding, testMetaData{}, wantContent},
+		{"YAMLPointer", YAMLEncoding, &testMetaData{}, wantContent},
+		{"TOML", TOMLEncoding, testMetaData{}, wantContent},
+		{"JSON", JSONEncoding, testMetaData{}, wantContent},
+		{"Map", YAMLEncoding, map[string]interface{}{}, wantContent},
+		{"Nil", YAMLEncoding, nil, wantContent},
+		{"Footer", YAMLEncoding.Clone(WithPosition(FooterPosition)), testMetaData{}, wantContent},
+		{"NotEmpty", YAMLEncoding, testMetaData{Name: "John Doe"}, "---\nname: John Doe\ndate: \"\"\ntitle: \"\"\n---\n\n" + wantContent},
+	}
+
+	for _, r := range runner {
+		e := r.Encoding.Clone(WithOmitEmptyFrontmatter())
+
+		have, err := e.AppendEncode(nil, []byte(wantContent), r.MetaData)
+		if err != nil {
+			t.Errorf(r.Name+"(AppendEncode): err: %s", err)
+		}
+
+		if r.Want != string(have) {
+			t.Errorf(r.Name+"(AppendEncode): \nwant: %q \nhave: %q", r.Want, string(have))
+		}
+
+		buf := new(bytes.Buffer)
+		w, err := NewEncoder(e, buf, r.MetaData)
+		if err == nil {
+			io.WriteString(w, wantContent)
+			err = w.Close()
+		}
+		if err != nil || r.Want != buf.String() {
+			t.Errorf(r.Name+"(NewEncoder): \nwant: %q \nhave: %q %v", r.Want, buf.String(), err)
+		}
+	}
+
+	if have, _ := YAMLEncoding.AppendEncode(nil, []byte(wantContent), testMetaData{}); !strings.HasPrefix(string(have), "---\n") {
+		t.Errorf("(without): want the block have: %q", string(have))
+	}
+}
+
+func gobMarshal(v interface{}) ([]byte, error) {
+	buf := new(bytes.Buffer)
+	err := gob.NewEncoder(buf).Encode(v)
+	return buf.Bytes(), err
+}
+
+func gobUnmarshal(data []byte, v interface{}) error {
+	return gob.NewDecoder(bytes.NewReader(data)).Decode(v)
+}
+
+func TestLengthPrefixedDelimiter(t *testing.T) {
+	type binaryMetaData struct {
+		Name string
+		Data []byte
+	}
+
+	const delim = "GOB"
+	gobEncoding := MustNewEncoding(
+		WithName("gob"),
+		WithDelimiter(delim),
+		WithSplitFunc(LengthPrefixedDelimiter),
+		WithMarshalFunc(gobMarshal),
+		WithUnmarshalFunc(gobUnmarshal),
+	)
+
+	rnd := rand.New(rand.NewSource(1))
+	random := func(n int) []byte {
+		b := make([]byte, n)
+		rnd.Read(b)
+		return b
+	}
+
+	var runner = []struct {
+		Name     string
+		MetaData binaryMetaData
+		Content  []byte
+	}{
+		{"Text", binaryMetaData{Name: "John Doe"}, []byte(wantContent)},
+		{"Empty", binaryMetaData{}, nil},
+		{"Delimiters", binaryMetaData{Name: delim, Data: []byte(delim + delim + "\n---\n")}, []byte(delim + "\x00\x00\x00\x03" + delim + "\n---\n")},
+		{"JustDelimiter", binaryMetaData{Name: "John Doe"}, []byte(delim)},
+		{"Random", binaryMetaData{Name: "John Doe", Data: random(1 << 16)}, random(1 << 16)},
+	}
+
+	for _, r := range runner {
+		file, err := gobEncoding.AppendEncode(nil, r.Content, r.MetaData)
+		if err != nil {
+			t.Fatalf(r.Name+"(AppendEncode): err: %s", err)
+		}
+
+		n := len(file) - len(r.Content) - len(delim) - LengthPrefixWidth
+		if !bytes.HasPrefix(file, []byte(delim)) || int(beUint(file[len(delim):len(delim)+LengthPrefixWidth])) != n {
+			t.Errorf(r.Name+"(AppendEncode): want a length prefix of %d have: % x", n, file[:len(delim)+LengthPrefixWidth])
+		}
+
+		for _, rd := range []struct {
+			Name   string
+			Reader func(io.Reader) io.Reader
+		}{
+			{"", func(r io.Reader) io.Reader { return r }},
+			{"OneByte", iotest.OneByteReader},
+			{"DataErr", iotest.DataErrReader},
+		} {
+			have := binaryMetaData{}
+			haveContent, err := gobEncoding.DecodeReader(rd.Reader(bytes.NewReader(file)), &have)
+			if err != nil {
+				t.Errorf(r.Name+rd.Name+"(DecodeReader): err: %s", err)
+			}
+
+			if !bytes.Equal(r.Content, haveContent) {
+				t.Errorf(r.Name+rd.Name+"(DecodeReader): want %d bytes of content have: %d", len(r.Content), len(haveContent))
+			}
+
+			if r.MetaData.Name != have.Name || !bytes.Equal(r.MetaData.Data, have.Data) {
+				t.Errorf(r.Name+rd.Name+"(DecodeReader): want %q and %d bytes have: %q and %d bytes", r.MetaData.Name, len(r.MetaData.Data), have.Name, len(have.Data))
+			}
+		}
+
+		haveContent, err := gobEncoding.StripFrontmatter(file)
+		if err != nil || !bytes.Equal(r.Content, haveContent) {
+			t.Errorf(r.Name+"(StripFrontmatter): want %d bytes of content have: %d %v", len(r.Content), len(haveContent), err)
+		}
+	}
+
+	for _, file := range []string{delim, delim + "\x00\x00", wantContent} {
+		haveContent, err := gobEncoding.DecodeString(file, &binaryMetaData{})
+		if err != nil || file != string(haveContent) {
+			t.Errorf("NoFrontmatter: want: %q have: %q %v", file, string(haveContent), err)
+		}
+	}
+
+	if _, err := gobEncoding.DecodeString(delim+"\x00\x00\x01\x00short", &binaryMetaData{}); err == nil {
+		t.Error("Short: want an error")
+	}
+}
+
+func TestProtobufFrontmatter(t *testing.T) {
+	protoEncoding := MustNewEncoding(
+		WithName("proto"),
+		WithDelimiter("PB"),
+		WithSplitFunc(LengthPrefixedDelimiter),
+		WithMarshalFunc(protoMarshal),
+		WithUnmarshalFunc(protoUnmarshal),
+	)
+
+	var runner = []struct {
+		Name     string
+		Encoding *Encoding
+		Post     proto.Message
+		Content  string
+	}{
+		{"Message", protoEncoding, &structpb.Struct{Fields: map[string]*structpb.Value{"name": structpb.NewStringValue("John Doe"), "views": structpb.NewNumberValue(1 << 40)}}, wantContent},
+		{"Whitespace", protoEncoding, wrapperspb.String(strings.Repeat(" ", 9)), wantContent}, // the message bytes are all whitespace
+		{"Newlines", protoEncoding, wrapperspb.String("\n\n"), "\n\n"},
+		{"Empty", protoEncoding.Clone(WithNoTrailingSeparatorOnEmptyContent()), wrapperspb.String("John Doe"), ""},
+		{"HeaderComment", protoEncoding.Clone(WithHeaderComment("# comment")), wrapperspb.String("John Doe"), wantContent},
+	}
+
+	for _, r := range runner {
+		want, _ := protoMarshal(r.Post)
+		wantFile := append(append([]byte("PB\x00\x00\x00"), byte(len(want))), want...)
+		wantFile = append(wantFile, r.Content...)
+
+		haveFile, err := r.Encoding.AppendEncode(nil, []byte(r.Content), r.Post)
+		if err != nil {
+			t.Errorf(r.Name+"(AppendEncode): err: %s", err)
+		}
+
+		if !bytes.Equal(wantFile, haveFile) {
+			t.Errorf(r.Name+"(AppendEncode): \nwant: %q \nhave: %q", wantFile, haveFile)
+		}
+
+		w := new(bytes.Buffer)
+		if _, err := r.Encoding.EncodeStream(w, strings.NewReader(r.Content), r.Post); err != nil || !bytes.Equal(wantFile, w.Bytes()) {
+			t.Errorf(r.Name+"(EncodeStream): \nwant: %q \nhave: %q %v", wantFile, w.Bytes(), err)
+		}
+
+		have := r.Post.ProtoReflect().New().Interface()
+		haveContent, err := r.Encoding.DecodeString(string(haveFile), have)
+		if err != nil {
+			t.Errorf(r.Name+"(DecodeString): err: %s", err)
+		}
+
+		if r.Content != string(haveContent) || !proto.Equal(r.Post, have) {
+			t.Errorf(r.Name+"(DecodeString): \nwant: %+v %q \nhave: %+v %q", r.Post, r.Content, have, string(haveContent))
+		}
+	}
+}
+
+func TestLongDelimiterTrickle(t *testing.T) {
+	const delim = "=========="
+	var runner = []struct {
+		Name     string
+		Encoding *Encoding
+		File     string
+	}{
+		{"Single", YAMLEncoding.Clone(WithDelimiter(delim)), delim + "\nname: John Doe\n" + delim + "\n\n" + wantContent},
+		{"Pair", YAMLEncoding.Clone(WithDelimiterPair("<<<<<<<<<<", ">>>>>>>>>>")), "<<<<<<<<<<\nname: John Doe\n>>>>>>>>>>\n\n" + wantContent},
+		{"Empty", YAMLEncoding.Clone(WithDelimiter(delim)), delim + "\n" + delim + "\n\n" + wantContent},
+		{"StrictFence", YAMLEncoding.Clone(WithDelimiter(delim), WithStrictFence()), delim + "\nname: John Doe\n" + delim + "\n\n" + wantContent},
+		{"Fenced", JSONFencedEncoding, "```json\n{\"name\": \"John Doe\"}\n```\n\n" + wantContent},
+		{"Almost", YAMLEncoding.Clone(WithDelimiter(delim)), delim[1:] + "\nname: John Doe\n" + delim + "\n\n" + wantContent},
+	}
+
+	for _, r := range runner {
+		wantMetaData := testMetaData{}
+		want, err := r.Encoding.DecodeString(r.File, &wantMetaData)
+		if err != nil {
+			t.Fatalf(r.Name+": err: %s", err)
+		}
+
+		readers := []struct {
+			Name   string
+			Reader io.Reader
+		}{
+			{"OneByte", iotest.OneByteReader(strings.NewReader(r.File))},
+			{"HalfReader", iotest.HalfReader(strings.NewReader(r.File))},
+		}
+		for i := 1; i < len(r.File); i++ {
+			readers = append(readers, struct {
+				Name   string
+				Reader io.Reader
+			}{fmt.Sprintf("Split%d", i), &splitReader{b: []byte(r.File), i: i}})
+		}
+
+		for _, rd := range readers {
+			haveMetaData := testMetaData{}
+			haveContent, err := r.Encoding.DecodeReader(rd.Reader, &haveMetaData)
+			if err != nil {
+				t.Errorf(r.Name+"(%s): err: %s", rd.Name, err)
+			}
+
+			if string(want) != string(haveContent) || wantMetaData != haveMetaData {
+				t.Errorf(r.Name+"(%s): \nwant: %+v %q \nhave: %+v %q", rd.Name, wantMetaData, want, haveMetaData, haveContent)
+			}
+		}
+	}
+}
+
+func TestInvalidDelimiter(t *testing.T) {
+	var runner = []struct {
+		Name    string
+		Options []EncodingOptionFunc
+		WantErr string
+	}{
+		{"Empty", []EncodingOptionFunc{WithDelimiter("")}, "particle: invalid delimiter: it is empty"},
+		{"Missing", []EncodingOptionFunc{WithMarshalFunc(yaml.Marshal)}, "particle: invalid delimiter: it is empty"},
+		{"Newline", []EncodingOptionFunc{WithDelimiter("a\nb")}, `particle: invalid delimiter "a\nb": it has a line break`},
+		{"CarriageReturn", []EncodingOptionFunc{WithDelimiter("---\r")}, `particle: invalid delimiter "---\r": it has a line break`},
+		{"PairNewline", []EncodingOptionFunc{WithDelimiterPair("<!--\n", "-->")}, `particle: invalid delimiter pair "<!--\n" "-->"`},
+		{"NotAPair", []EncodingOptionFunc{WithDelimiter("---"), WithSplitFunc(SpaceSeparatedTokenDelimiters)}, `particle: invalid delimiter "---": The delimiter token does not split into exactly two`},
+		{"Valid", []EncodingOptionFunc{WithDelimiter(YAMLDelimiter)}, ""},
+		{"ValidPair", []EncodingOptionFunc{WithDelimiterPair("<!--", "-->")}, ""},
+		{"Late", []EncodingOptionFunc{WithDelimiter(""), WithDelimiter(YAMLDelimiter)}, ""}, // validated once all options are set
+		{"WholeDocument", []EncodingOptionFunc{WithWholeDocument()}, ""},
+	}
+
+	for _, r := range runner {
+		e, err := NewEncoding(r.Options...)
+		if r.WantErr == "" {
+			if err != nil || e == nil {
+				t.Errorf(r.Name+": err: %v", err)
+			}
+			continue
+		}
+
+		if err == nil || err.Error() != r.WantErr || e != nil {
+			t.Errorf(r.Name+": \nwant: %q \nhave: %v", r.WantErr, err)
+		}
+
+		func() {
+			defer func() {
+				if have := recover(); fmt.Sprint(have) != r.WantErr {
+					t.Errorf(r.Name+"(MustNewEncoding): want a panic with: %q have: %v", r.WantErr, have)
+				}
+			}()
+			MustNewEncoding(r.Options...)
+		}()
+	}
+
+	// a per call delimiter is validated the same way
+	wantErr := `particle: invalid delimiter "a\nb": it has a line break`
+	if _, err := YAMLEncoding.DecodeString(wantContent, &testMetaData{}, WithDelimiter("a\nb")); err == nil || err.Error() != wantErr {
+		t.Errorf("(per call): \nwant: %q \nhave: %v", wantErr, err)
+	}
+}
+
+func TestDelimiterPair(t *testing.T) {
+	var runner = []struct {
+		Name     string
+		Encoding *Encoding
+		File     string
+		WantLoc  Location
+	}{
+		{"ShortOpen", YAMLEncoding.Clone(WithDelimiterPair("<%", "%%%%>")), "<%\nname: John Doe\n%%%%>\n\n" + wantContent, Location{Start: 3, End: 17, LineStart: 2, LineEnd: 2}},
+		{"LongOpen", YAMLEncoding.Clone(WithDelimiterPair("<%%%%", "%>")), "<%%%%\nname: John Doe\n%>\n\n" + wantContent, Location{Start: 6, End: 20, LineStart: 2, LineEnd: 2}},
+	}
+
+	for _, r := range runner {
+		for _, rd := range []struct {
+			Name   string
+			Reader func(io.Reader) io.Reader
+		}{
+			{"", func(r io.Reader) io.Reader { return r }},
+			{"OneByte", iotest.OneByteReader},
+			{"DataErr", iotest.DataErrReader},
+		} {
+			haveMetaData := testMetaData{}
+			haveContent, err := r.Encoding.DecodeReader(rd.Reader(strings.NewReader(r.File)), &haveMetaData)
+			if err != nil {
+				t.Errorf(r.Name+rd.Name+": err: %s", err)
+			}
+
+			if wantContent != string(haveContent) {
+				t.Errorf(r.Name+rd.Name+": \nwant: %q \nhave: %q", wantContent, string(haveContent))
+			}
+
+			if haveMetaData.Name != "John Doe" {
+				t.Errorf(r.Name+rd.Name+": want: %q have: %q", "John Doe", haveMetaData.Name)
+			}
+		}
+
+		_, haveLoc, err := r.Encoding.DecodeLocated([]byte(r.File), &testMetaData{})
+		if err != nil {
+			t.Errorf(r.Name+"(DecodeLocated): err: %s", err)
+		}
+
+		if r.WantLoc != haveLoc {
+			t.Errorf(r.Name+"(DecodeLocated): \nwant: %+v \nhave: %+v", r.WantLoc, haveLoc)
+		}
+
+		if want, have := "name: John Doe", r.File[haveLoc.Start:haveLoc.End]; want != have {
+			t.Errorf(r.Name+"(DecodeLocated): \nwant: %q \nhave: %q", want, have)
+		}
+
+		if have := r.Encoding.EncodeToString([]byte(wantContent), map[string]string{"name": "John Doe"}); r.File != have {
+			t.Errorf(r.Name+"(EncodeToString): \nwant: %q \nhave: %q", r.File, have)
+		}
+	}
+}
+
+func TestDecodeReaderCompressed(t *testing.T) {
+	gzipped := func(s string) string {
+		buf := new(bytes.Buffer)
+		zw := gzip.NewWriter(buf)
+		zw.Write([]byte(s))
+		zw.Close()
+		return buf.String()
+	}
+
+	var runner = []struct {
+		Name string
+		File string
+		Err  bool
+	}{
+		{"Plain", testCaseData["YAML"]["file"], false},
+		{"Gzip", gzipped(testCaseData["YAML"]["file"]), false},
+		{"Short", "\x1f", false},
+		{"Corrupt", "\x1f\x8b\x00", true},
+	}
+
+	for _, r := range runner {
+		haveMetaData := testMetaData{}
+		haveContent, err := YAMLEncoding.DecodeReaderCompressed(strings.NewReader(r.File), &haveMetaData)
+		if r.Err {
+			if err == nil {
+				t.Errorf(r.Name + ": want an error")
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf(r.Name+": err: %s", err)
+		}
+
+		wantFile := r.File
+		if r.Name != "Short" {
+			wantFile = wantContent
+		}
+		if wantFile != string(haveContent) {
+			t.Errorf(r.Name+": \nwant: %q \nhave: %q", wantFile, string(haveContent))
+		}
+
+		if r.Name != "Short" && haveMetaData.Name != "John Doe" {
+			t.Errorf(r.Name+": want: %q have: %q", "John Doe", haveMetaData.Name)
+		}
+	}
+}
+
+func TestDestinationNotPointer(t *testing.T) {
+	var nilMetaData *testMetaData
+	var nilMap map[string]interface{}
+
+	var runner = []struct {
+		Name string
+		V    interface{}
+	}{
+		{"Value", testMetaData{}},
+		{"NilPointer", nilMetaData},
+		{"NilInterface", nil},
+		{"NilMap", nilMap},
+	}
+
+	encodings := map[string]*Encoding{"YAML": YAMLEncoding, "TOML": TOMLEncoding, "JSON": JSONEncoding}
+
+	for name, enc := range encodings {
+		for _, r := range runner {
+			_, err := enc.DecodeString(testCaseData[name]["file"], r.V)
+			if !errors.Is(err, ErrDestinationNotPointer) {
+				t.Errorf(r.Name+"("+name+"): want: %v have: %v", ErrDestinationNotPointer, err)
+			}
+		}
+
+		// a map is filled in without a pointer to it
+		haveMap := map[string]interface{}{}
+		if _, err := enc.DecodeString(testCaseData[name]["file"], haveMap); err != nil {
+			t.Errorf("Map("+name+"): err: %s", err)
+		}
+
+		if len(haveMap) != 3 {
+			t.Errorf("Map("+name+"): want 3 keys have: %v", haveMap)
+		}
+	}
+}
+
+func TestStripFrontmatter(t *testing.T) {
+	var runner = []struct {
+		Name     string
+		Encoding *Encoding
+		File     string
+	}{
+		{"YAML", YAMLEncoding, testCaseData["YAML"]["file"]},
+		{"TOML", TOMLEncoding, testCaseData["TOML"]["file"]},
+		{"JSON", JSONEncoding, testCaseData["JSON"]["file"]},
+		{"Preamble", JSONEncoding, "// comment\n\n" + testCaseData["JSON"]["file"]},
+		{"NoFrontmatter", YAMLEncoding, wantContent},
+		{"NeverClosed", YAMLEncoding, "---\nname: John Doe\n"},
+		{"Empty", YAMLEncoding, "---\n---\n\n" + wantContent},
+		{"BOM", YAMLEncoding.Clone(WithStripBOM()), "\xef\xbb\xbf" + testCaseData["YAML"]["file"]},
+		{"TrimSpace", YAMLEncoding.Clone(WithTrimSpace()), "---\nname: John Doe\n---\n\n\n  " + wantContent + "\n\n"},
+		{"Footer", YAMLEncoding.Clone(WithPosition(FooterPosition)), wantContent + "\n---\nname: John Doe\n---\n"},
+	}
+
+	for _, r := range runner {
+		want, err := r.Encoding.DecodeString(r.File, &map[string]interface{}{})
+		if err != nil {
+			t.Errorf(r.Name+"(DecodeString): err: %s", err)
+		}
+
+		have, err := r.Encoding.StripFrontmatter([]byte(r.File))
+		if err != nil {
+			t.Errorf(r.Name+": err: %s", err)
+		}
+
+		if string(want) != string(have) {
+			t.Errorf(r.Name+": \nwant: %q \nhave: %q", string(want), string(have))
+		}
+	}
+
+	if _, err := YAMLEncoding.Clone(WithMaxSize(8)).StripFrontmatter([]byte(testCaseData["YAML"]["file"])); !errors.Is(err, ErrMaxSize) {
+		t.Errorf("MaxSize: want: %v have: %v", ErrMaxSize, err)
+	}
+}
+
+func BenchmarkStripFrontmatter(b *testing.B) {
+	src := []byte(testCaseData["YAML"]["file"])
+
+	b.Run("StripFrontmatter", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			YAMLEncoding.StripFrontmatter(src)
+		}
+	})
+
+	b.Run("Decode", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			v := map[string]interface{}{}
+			YAMLEncoding.DecodeString(string(src), &v)
+		}
+	})
+}
+
+func TestEnvExpand(t *testing.T) {
+	t.Setenv("FOO", "bar")
+
+	type site struct {
+		BaseURL string `yaml:"baseurl" json:"baseurl"`
+		Title   string `yaml:"title" json:"title"`
+	}
+
+	var runner = []struct {
+		Name     string
+		Encoding *Encoding
+		File     string
+		Want     site
+	}{
+		{"Env", YAMLEncoding.Clone(WithEnvExpand()), "---\nbaseurl: ${FOO}\ntitle: ${FOO} site\n---\n\n" + wantContent, site{"bar", "bar site"}},
+		{"Dollar", YAMLEncoding.Clone(WithEnvExpand()), "---\nbaseurl: $5 and $FOO\ntitle: ${not a var} ${}\n---\n\n" + wantContent, site{"$5 and $FOO", "${not a var} ${}"}},
+		{"Unset", YAMLEncoding.Clone(WithEnvExpand()), "---\nbaseurl: ${PARTICLE_UNSET}x\n---\n\n" + wantContent, site{"x", ""}},
+		{"Expander", JSONEncoding.Clone(WithExpander(strings.ToUpper)), "{\n\t\"baseurl\": \"${foo}\"\n}\n\n" + wantContent, site{"FOO", ""}},
+		{"Without", YAMLEncoding, "---\nbaseurl: ${FOO}\n---\n\n" + wantContent, site{"${FOO}", ""}},
+	}
+
+	for _, r := range runner {
+		have := site{}
+		haveContent, err := r.Encoding.DecodeString(r.File, &have)
+		if err != nil {
+			t.Errorf(r.Name+": err: %s", err)
+		}
+
+		if wantContent != string(haveContent) {
+			t.Errorf(r.Name+": \nwant: %q \nhave: %q", wantContent, string(haveContent))
+		}
+
+		if r.Want != have {
+			t.Errorf(r.Name+": \nwant: %+v \nhave: %+v", r.Want, have)
+		}
+	}
+}
+
+func TestEncodeStream(t *testing.T) {
+	var runner = []struct {
+		Name     string
+		Encoding *Encoding
+		Want     string
+	}{
+		{"YAML", YAMLEncoding, testCaseData["YAML"]["file"]},
+		{"Footer", YAMLEncoding.Clone(WithPosition(FooterPosition)), wantContent + "\n---\nname: John Doe\ndate: 10-10-2016\ntitle: example YAML\n---\n"},
+		{"Trailer", YAMLEncoding.Clone(WithTrailer("<!-- end -->\n")), testCaseData["YAML"]["file"] + "<!-- end -->\n"},
+	}
+
+	wantMetaData.Title = "example YAML"
+	for _, r := range runner {
+		buf := new(bytes.Buffer)
+		w := bufio.NewWriter(buf)
+
+		n, err := r.Encoding.EncodeStream(w, iotest.OneByteReader(strings.NewReader(wantContent)), wantMetaData)
+		if err != nil {
+			t.Errorf(r.Name+": err: %s", err)
+		}
+
+		if r.Want != buf.String() {
+			t.Errorf(r.Name+": \nwant: %q \nhave: %q", r.Want, buf.String())
+		}
+
+		if int64(len(r.Want)) != n {
+			t.Errorf(r.Name+": want: %d have: %d", len(r.Want), n)
+		}
+	}
+
+	if _, err := YAMLEncoding.EncodeStream(ioutil.Discard, strings.NewReader(wantContent), func() {}); err == nil {
+		t.Error("Marshal: want an error")
+	}
+
+	errWrite := errors.New("write error")
+	if _, err := YAMLEncoding.EncodeStream(errWriter{errWrite}, strings.NewReader(wantContent), wantMetaData); err != errWrite {
+		t.Errorf("Write: want: %v have: %v", errWrite, err)
+	}
+
+	if _, err := YAMLEncoding.EncodeStream(ioutil.Discard, iotest.ErrReader(errWrite), wantMetaData); err != errWrite {
+		t.Errorf("Read: want: %v have: %v", errWrite, err)
+	}
+}
+
+// errWriter fails every write with err.
+type errWriter struct{ err error }
+
+func (w errWriter) Write(p []byte) (int, error) { return 0, w.err }
+
+// repeatReader reads the byte c, n times, without holding them in memory.
+type repeatReader struct {
+	c byte
+	n int64
+}
+
+func (r *repeatReader) Read(p []byte) (int, error) {
+	if r.n <= 0 {
+		return 0, io.EOF
+	}
+	if int64(len(p)) > r.n {
+		p = p[:r.n]
+	}
+	for i := range p {
+		p[i] = r.c
+	}
+	r.n -= int64(len(p))
+	return len(p), nil
+}
+
+func BenchmarkEncodeStream(b *testing.B) {
+	for _, size := range []int64{1 << 10, 1 << 20, 1 << 24} {
+		b.Run(fmt.Sprint(size), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				YAMLEncoding.EncodeStream(ioutil.Discard, &repeatReader{c: 'a', n: size}, wantMetaData)
+			}
+		})
+	}
+}
+
+func TestHeaderComment(t *testing.T) {
+	var runner = []struct {
+		Name     string
+		Encoding *Encoding
+		File     string
+	}{
+		{"YAML", YAMLEncoding.Clone(WithHeaderComment("# Generated by mytool, do not edit")), "# Generated by mytool, do not edit\n" + testCaseData["YAML"]["file"]},
+		{"TOML", TOMLEncoding.Clone(WithHeaderComment("# Generated\n# do not edit\n")), "# Generated\n# do not edit\n" + testCaseData["TOML"]["file"]},
+		{"JSON", JSONEncoding.Clone(WithHeaderComment("// Generated")), "// Generated\n" + testCaseData["JSON"]["file"]},
+	}
+
+	for _, r := range runner {
+		wantMetaData.Title = "example " + r.Name
+
+		haveMetaData := testMetaData{}
+		haveContent, err := r.Encoding.DecodeString(r.File, &haveMetaData)
+		if err != nil {
+			t.Errorf(r.Name+"(DecodeString): err: %s", err)
+		}
+
+		if wantContent != string(haveContent) {
+			t.Errorf(r.Name+"(DecodeString): \nwant: %q \nhave: %q", wantContent, string(haveContent))
+		}
+
+		if !reflect.DeepEqual(wantMetaData, haveMetaData) {
+			t.Errorf(r.Name+"(DecodeString): \nwant: %+v \nhave: %+v", wantMetaData, haveMetaData)
+		}
+
+		if have := r.Encoding.EncodeToString(haveContent, haveMetaData); r.File != have {
+			t.Errorf(r.Name+"(EncodeToString): \nwant: %q \nhave: %q", r.File, have)
+		}
+
+		// without frontmatter the comment is content
+		noFrontmatter := strings.SplitAfter(r.File, "\n")[0] + wantContent
+		haveContent, err = r.Encoding.DecodeReader(strings.NewReader(noFrontmatter), &testMetaData{})
+		if err != nil {
+			t.Errorf(r.Name+"(no frontmatter): err: %s", err)
+		}
+
+		if noFrontmatter != string(haveContent) {
+			t.Errorf(r.Name+"(no frontmatter): \nwant: %q \nhave: %q", noFrontmatter, string(haveContent))
+		}
+	}
+}
+
+func TestHTMLCommentEncoding(t *testing.T) {
+	wantFile := "<!--\nname: John Doe\ndate: 10-10-2016\ntitle: example YAML\n-->\n\n# Title\n\n" + wantContent
+	wantBody := "# Title\n\n" + wantContent
+	wantMetaData.Title = "example YAML"
+
+	for _, rd := range []struct {
+		Name   string
+		Reader func(io.Reader) io.Reader
+	}{
+		{"", func(r io.Reader) io.Reader { return r }},
+		{"OneByte", iotest.OneByteReader},
+	} {
+		haveMetaData := testMetaData{}
+		haveContent, err := HTMLCommentEncoding.DecodeReader(rd.Reader(strings.NewReader(wantFile)), &haveMetaData)
+		if err != nil {
+			t.Errorf(rd.Name+"(DecodeReader): err: %s", err)
+		}
+
+		if wantBody != string(haveContent) {
+			t.Errorf(rd.Name+"(DecodeReader): \nwant: %q \nhave: %q", wantBody, string(haveContent))
+		}
+
+		if !reflect.DeepEqual(wantMetaData, haveMetaData) {
+			t.Errorf(rd.Name+"(DecodeReader): \nwant: %+v \nhave: %+v", wantMetaData, haveMetaData)
+		}
+	}
+
+	if have := HTMLCommentEncoding.EncodeToString([]byte(wantBody), wantMetaData); wantFile != have {
+		t.Errorf("(EncodeToString): \nwant: %q \nhave: %q", wantFile, have)
+	}
+
+	// a comment that isn't at the start is content
+	haveContent, err := HTMLCommentEncoding.DecodeString(wantBody+"<!--\nnote\n-->\n", &testMetaData{})
+	if err != nil || wantBody+"<!--\nnote\n-->\n" != string(haveContent) {
+		t.Errorf("(comment in content): have: %q %v", string(haveContent), err)
+	}
+}
+
+func TestContentOnUnmarshalError(t *testing.T) {
+	badFile := "---\nname: [John Doe\n---\n\n" + wantContent
+
+	var runner = []struct {
+		Name   string
+		Decode func() ([]byte, error)
+	}{
+		{"DecodeString", func() ([]byte, error) { return YAMLEncoding.DecodeString(badFile, &testMetaData{}) }},
+		{"DecodeReader", func() ([]byte, error) {
+			return YAMLEncoding.DecodeReader(iotest.OneByteReader(strings.NewReader(badFile)), &testMetaData{})
+		}},
+		{"Decode", func() ([]byte, error) {
+			dst := make([]byte, len(wantContent))
+			n, err := YAMLEncoding.Decode(dst, []byte(badFile), &testMetaData{})
+			return dst[:n], err
+		}},
+		{"DecodeLocated", func() ([]byte, error) {
+			content, _, err := YAMLEncoding.DecodeLocated([]byte(badFile), &testMetaData{})
+			return content, err
+		}},
+		{"DecodeStringMap", func() ([]byte, error) {
+			_, content, err := YAMLEncoding.DecodeStringMap(badFile)
+			return content, err
+		}},
+		{"TrimSpace", func() ([]byte, error) {
+			return YAMLEncoding.DecodeString(badFile+"\n\n", &testMetaData{}, WithTrimSpace())
+		}},
+	}
+
+	for _, r := range runner {
+		haveContent, err := r.Decode()
+
+		var fmErr *FrontmatterError
+		if !errors.As(err, &fmErr) {
+			t.Errorf(r.Name+": want a *FrontmatterError have: %v", err)
+		}
+
+		want := wantContent
+		if r.Name == "TrimSpace" {
+			want = strings.TrimSpace(wantContent)
+		}
+		if want != string(haveContent) {
+			t.Errorf(r.Name+": \nwant: %q \nhave: %q", want, string(haveContent))
+		}
+	}
+
+	if o, err := NewDecoder(YAMLEncoding, iotest.OneByteReader(strings.NewReader(badFile)), &testMetaData{}); o != nil || err == nil {
+		t.Errorf("NewDecoder: want a nil reader and an error have: %v %v", o, err)
+	}
+}
+
+// splitReader reads b in two reads, the first one ends at i.
+type splitReader struct {
+	b []byte
+	i int
+}
+
+func (r *splitReader) Read(p []byte) (int, error) {
+	if len(r.b) == 0 {
+		return 0, io.EOF
+	}
+
+	n := len(r.b)
+	if r.i > 0 {
+		n, r.i = r.i, 0
+	}
+	n = copy(p, r.b[:n])
+	r.b = r.b[n:]
+	return n, nil
+}
+
+func TestDecodeChunkedReads(t *testing.T) {
+	type namedReader struct {
+		Name   string
+		Reader io.Reader
+	}
+
+	var runner = []struct {
+		Name     string
+		Encoding *Encoding
+		File     string
+	}{
+		{"YAML", YAMLEncoding, testCaseData["YAML"]["file"]},
+		{"TOML", TOMLEncoding, testCaseData["TOML"]["file"]},
+		{"JSON", JSONEncoding, testCaseData["JSON"]["file"]},
+		{"JSONFenced", JSONFencedEncoding, "```json\n" + strings.TrimSuffix(testCaseData["JSON"]["file"], "\n\n"+wantContent) + "\n```\n\n" + wantContent},
+		{"HTMLComment", HTMLCommentEncoding, "<!--\nname: John Doe\ndate: 10-10-2016\ntitle: example YAML\n-->\n\n" + wantContent},
+		{"StrictFence", YAMLEncoding.Clone(WithStrictFence()), testCaseData["YAML"]["file"]},
+	}
+
+	for _, r := range runner {
+		wantMetaData := testMetaData{}
+		if _, err := r.Encoding.DecodeString(r.File, &wantMetaData); err != nil || wantMetaData.Name != "John Doe" {
+			t.Fatalf(r.Name+": want the metadata have: %+v %v", wantMetaData, err)
+		}
+
+		readers := []namedReader{
+			{"OneByte", iotest.OneByteReader(strings.NewReader(r.File))},
+			{"Half", iotest.HalfReader(strings.NewReader(r.File))},
+			{"DataErr", iotest.DataErrReader(strings.NewReader(r.File))},
+		}
+
+		// split the input in two reads at every offset, so each delimiter
+		// is split across reads, also with the end of the input returned
+		// along with the last read
+		for i := 1; i < len(r.File); i++ {
+			readers = append(readers,
+				namedReader{fmt.Sprintf("Split%d", i), &splitReader{b: []byte(r.File), i: i}},
+				namedReader{fmt.Sprintf("SplitDataErr%d", i), iotest.DataErrReader(&splitReader{b: []byte(r.File), i: i})},
+			)
+		}
+
+		for _, rd := range readers {
+			haveMetaData := testMetaData{}
+			haveContent, err := r.Encoding.DecodeReader(rd.Reader, &haveMetaData)
+			if err != nil {
+				t.Errorf(r.Name+"("+rd.Name+"): err: %s", err)
+			}
+
+			if wantContent != string(haveContent) {
+				t.Errorf(r.Name+"("+rd.Name+"): \nwant: %q \nhave: %q", wantContent, string(haveContent))
+			}
+
+			if !reflect.DeepEqual(wantMetaData, haveMetaData) {
+				t.Errorf(r.Name+"("+rd.Name+"): \nwant: %+v \nhave: %+v", wantMetaData, haveMetaData)
+			}
+		}
+	}
+}
+
+func TestDecodeStringContent(t *testing.T) {
+	var runner = []struct {
+		Name     string
+		Encoding *Encoding
+		File     string
+		Want     string
+		Err      error
+	}{
+		{"YAML", YAMLEncoding, testCaseData["YAML"]["file"], wantContent, nil},
+		{"NoFrontmatter", YAMLEncoding, wantContent, wantContent, nil},
+		{"BOM", YAMLEncoding.Clone(WithStripBOM()), "\xef\xbb\xbf" + wantContent, wantContent, nil},
+		{"TrimSpace", YAMLEncoding.Clone(WithTrimSpace()), "\n" + wantContent, strings.TrimSpace(wantContent), nil},
+		{"Preamble", JSONEncoding, "// comment\n" + testCaseData["JSON"]["file"], wantContent, nil},
+		{"PreambleNoFrontmatter", JSONEncoding, "// comment\n" + wantContent, "// comment\n" + wantContent, nil},
+		{"Footer", YAMLEncoding.Clone(WithPosition(FooterPosition)), wantContent + "\n---\nname: John Doe\n---\n", wantContent, nil},
+		{"Invalid", YAMLEncoding, testCaseData["YAML"]["file"] + "\xff", wantContent + "\xff", nil},
+		{"ValidUTF8", YAMLEncoding.Clone(WithValidUTF8()), testCaseData["YAML"]["file"] + "héllo", wantContent + "héllo", nil},
+		{"InvalidUTF8", YAMLEncoding.Clone(WithValidUTF8()), testCaseData["YAML"]["file"] + "\xff", wantContent + "\xff", ErrInvalidUTF8},
+		{"InvalidUTF8NoFrontmatter", YAMLEncoding.Clone(WithValidUTF8()), "\xff", "\xff", ErrInvalidUTF8},
+		{"UnmarshalError", YAMLEncoding, "---\nname: [\n---\n\n" + wantContent, wantContent, &FrontmatterError{}},
+	}
+
+	for _, r := range runner {
+		haveMetaData := testMetaData{}
+		have, err := r.Encoding.DecodeStringContent(r.File, &haveMetaData)
+
+		var fmErr *FrontmatterError
+		switch {
+		case r.Err == nil && err != nil:
+			t.Errorf(r.Name+": err: %s", err)
+		case r.Err == ErrInvalidUTF8 && err != ErrInvalidUTF8:
+			t.Errorf(r.Name+": want: %v have: %v", r.Err, err)
+		case r.Err != nil && r.Err != ErrInvalidUTF8 && !errors.As(err, &fmErr):
+			t.Errorf(r.Name+": want a *FrontmatterError have: %v", err)
+		}
+
+		if r.Want != have {
+			t.Errorf(r.Name+": \nwant: %q \nhave: %q", r.Want, have)
+		}
+
+		if r.Name == "YAML" && haveMetaData.Name != "John Doe" {
+			t.Errorf(r.Name+": want: %q have: %q", "John Doe", haveMetaData.Name)
+		}
+	}
+}
+
+func TestDecodeFrontAndBack(t *testing.T) {
+	type backMatter struct {
+		Notes []string
+	}
+
+	front := "---\nname: John Doe\n---\n\n"
+	back := "\n---\nnotes:\n- first\n- second\n---\n"
+
+	var runner = []struct {
+		Name      string
+		Encoding  *Encoding
+		File      string
+		WantFront testMetaData
+		WantBack  backMatter
+	}{
+		{"Both", YAMLEncoding, front + wantContent + back, testMetaData{Name: "John Doe"}, backMatter{Notes: []string{"first", "second"}}},
+		{"Front", YAMLEncoding, front + wantContent, testMetaData{Name: "John Doe"}, backMatter{}},
+		{"Back", YAMLEncoding, wantContent + back, testMetaData{}, backMatter{Notes: []string{"first", "second"}}},
+		{"Neither", YAMLEncoding, wantContent, testMetaData{}, backMatter{}},
+		{"Footer", YAMLEncoding.Clone(WithPosition(FooterPosition)), front + wantContent + back, testMetaData{Name: "John Doe"}, backMatter{Notes: []string{"first", "second"}}},
+		{"TOML", TOMLEncoding, "+++\nname = \"John Doe\"\n+++\n\n" + wantContent + "\n+++\nnotes = [\"first\", \"second\"]\n+++\n", testMetaData{Name: "John Doe"}, backMatter{Notes: []string{"first", "second"}}},
+	}
+
+	for _, r := range runner {
+		haveFront, haveBack := testMetaData{}, backMatter{}
+		haveContent, err := r.Encoding.DecodeFrontAndBack([]byte(r.File), &haveFront, &haveBack)
+		if err != nil {
+			t.Errorf(r.Name+": err: %s", err)
+		}
+
+		if wantContent != string(haveContent) {
+			t.Errorf(r.Name+": \nwant: %q \nhave: %q", wantContent, string(haveContent))
+		}
+
+		if !reflect.DeepEqual(r.WantFront, haveFront) {
+			t.Errorf(r.Name+"(front): \nwant: %+v \nhave: %+v", r.WantFront, haveFront)
+		}
+
+		if !reflect.DeepEqual(r.WantBack, haveBack) {
+			t.Errorf(r.Name+"(back): \nwant: %+v \nhave: %+v", r.WantBack, haveBack)
+		}
+	}
+}
+
+func TestFenceNewlines(t *testing.T) {
+	var runner = []struct {
+		Name     string
+		Encoding *Encoding
+		Want     string
+	}{
+		{"Default", YAMLEncoding, "---\nname: John Doe\n---\n\n" + wantContent},
+		{"AfterOpen", YAMLEncoding.Clone(WithFenceNewlines("\n\n", "\n")), "---\n\nname: John Doe\n---\n\n" + wantContent},
+		{"BeforeClose", YAMLEncoding.Clone(WithFenceNewlines("\n", "\n\n")), "---\nname: John Doe\n\n---\n\n" + wantContent},
+		{"Separator", YAMLEncoding.Clone(WithContentSeparator("\n\n")), "---\nname: John Doe\n---\n\n\n" + wantContent},
+		{"Tight", YAMLEncoding.Clone(WithFenceNewlines("\n", "\n"), WithContentSeparator("\n\n")), "---\nname: John Doe\n---\n\n\n" + wantContent},
+		{"All", YAMLEncoding.Clone(WithFenceNewlines("\n\n", "\n\n"), WithContentSeparator("")), "---\n\nname: John Doe\n\n---\n" + wantContent},
+		{"TOML", TOMLEncoding.Clone(WithFenceNewlines("\n\n", "\n\n")), "+++\n\nname = \"John Doe\"\n\n+++\n\n" + wantContent},
+		{"JSON", JSONEncoding.Clone(WithFenceNewlines("\n\n", "\n\n")), "{\n\t\"name\": \"John Doe\"\n}\n\n" + wantContent},
+	}
+
+	for _, r := range runner {
+		haveFile, err := r.Encoding.AppendEncode(nil, []byte(wantContent), map[string]interface{}{"name": "John Doe"})
+		if err != nil {
+			t.Errorf(r.Name+"(AppendEncode): err: %s", err)
+		}
+
+		if r.Want != string(haveFile) {
+			t.Errorf(r.Name+"(AppendEncode): \nwant: %q \nhave: %q", r.Want, string(haveFile))
+		}
+
+		haveMetaData := testMetaData{}
+		haveContent, err := r.Encoding.DecodeString(string(haveFile), &haveMetaData)
+		if err != nil {
+			t.Errorf(r.Name+"(DecodeString): err: %s", err)
+		}
+
+		if wantContent != strings.TrimLeft(string(haveContent), "\n") || haveMetaData.Name != "John Doe" {
+			t.Errorf(r.Name+"(DecodeString): \nwant: %q %q \nhave: %q %q", "John Doe", wantContent, haveMetaData.Name, string(haveContent))
+		}
+	}
+}
+
+func TestContentSeparator(t *testing.T) {
+	type payloadMetaData struct {
+		ID int `json:"id" yaml:"id"`
+	}
+
+	var runner = []struct {
+		Name     string
+		Encoding *Encoding
+		Body     string
+		File     string
+	}{
+		{"JSON", JSONEncoding.Clone(WithContentSeparator("")), `{"data":[1,2]}`, "{\n\t\"id\": 7\n}\n{\"data\":[1,2]}"},
+		{"JSONNewline", JSONEncoding.Clone(WithContentSeparator("")), "\n{\"data\":[1,2]}", "{\n\t\"id\": 7\n}\n\n{\"data\":[1,2]}"},
+		{"YAML", YAMLEncoding.Clone(WithContentSeparator("")), wantContent, "---\nid: 7\n---\n" + wantContent},
+		{"YAMLTwoLines", YAMLEncoding.Clone(WithContentSeparator("\n\n")), wantContent, "---\nid: 7\n---\n\n\n" + wantContent},
+		{"Footer", YAMLEncoding.Clone(WithContentSeparator(""), WithPosition(FooterPosition)), wantContent, wantContent + "---\nid: 7\n---\n"},
+	}
+
+	for _, r := range runner {
+		haveFile, err := r.Encoding.AppendEncode(nil, []byte(r.Body), payloadMetaData{ID: 7})
+		if err != nil {
+			t.Errorf(r.Name+"(AppendEncode): err: %s", err)
+		}
+
+		if r.File != string(haveFile) {
+			t.Errorf(r.Name+"(AppendEncode): \nwant: %q \nhave: %q", r.File, string(haveFile))
+		}
+
+		for _, rd := range []struct {
+			Name   string
+			Reader func(io.Reader) io.Reader
+		}{
+			{"", func(r io.Reader) io.Reader { return r }},
+			{"OneByte", iotest.OneByteReader},
+		} {
+			haveMetaData := payloadMetaData{}
+			haveBody, err := r.Encoding.DecodeReader(rd.Reader(strings.NewReader(r.File)), &haveMetaData)
+			if err != nil {
+				t.Errorf(r.Name+rd.Name+"(DecodeReader): err: %s", err)
+			}
+
+			if r.Body != string(haveBody) {
+				t.Errorf(r.Name+rd.Name+"(DecodeReader): \nwant: %q \nhave: %q", r.Body, string(haveBody))
+			}
+
+			if haveMetaData.ID != 7 {
+				t.Errorf(r.Name+rd.Name+"(DecodeReader): want: %d have: %d", 7, haveMetaData.ID)
+			}
+		}
+	}
+}
+
+func TestBufioReader(t *testing.T) {
+	var runner = []struct {
+		Name     string
+		Encoding *Encoding
+		File     string
+	}{
+		{"YAML", YAMLEncoding, testCaseData["YAML"]["file"]},
+		{"NoFrontmatter", YAMLEncoding, wantContent},
+		{"Preamble", JSONEncoding, "// comment\n" + testCaseData["JSON"]["file"]},
+		{"BOM", YAMLEncoding.Clone(WithStripBOM()), "\xef\xbb\xbf" + testCaseData["YAML"]["file"]},
+	}
+
+	for _, r := range runner {
+		wantMetaData := testMetaData{}
+		r.Encoding.DecodeString(r.File, &wantMetaData)
+
+		for _, size := range []int{16, 4096} {
+			br := bufio.NewReaderSize(iotest.OneByteReader(strings.NewReader(r.File)), size)
+
+			haveMetaData := testMetaData{}
+			haveContent, err := r.Encoding.DecodeReader(br, &haveMetaData)
+			if err != nil {
+				t.Errorf(r.Name+": err: %s", err)
+			}
+
+			if wantContent != string(haveContent) {
+				t.Errorf(r.Name+": \nwant: %q \nhave: %q", wantContent, string(haveContent))
+			}
+
+			if !reflect.DeepEqual(wantMetaData, haveMetaData) {
+				t.Errorf(r.Name+": \nwant: %+v \nhave: %+v", wantMetaData, haveMetaData)
+			}
+		}
+	}
+
+	// the *bufio.Reader is peeked, not wrapped
+	br := bufio.NewReader(strings.NewReader(testCaseData["YAML"]["file"]))
+	if have, _, ok := YAMLEncoding.peekFrontmatter(br); have != io.Reader(br) || !ok {
+		t.Errorf("(peekFrontmatter): want the same reader have: %T %t", have, ok)
+	}
+
+	// the block is scanned out of the buffer of the *bufio.Reader, and
+	// what isn't scanned is left in it
+	scnr := YAMLEncoding.newScanner(br, bufio.ScanLines)
+	if !scnr.Scan() || scnr.br != br || scnr.Text() != YAMLDelimiter {
+		t.Errorf("(newScanner): want %q from the same reader have: %q", YAMLDelimiter, scnr.Text())
+	}
+
+	rest, _ := ioutil.ReadAll(br)
+	if want := strings.TrimPrefix(testCaseData["YAML"]["file"], YAMLDelimiter+"\n"); want != string(rest) {
+		t.Errorf("(newScanner): \nwant: %q \nhave: %q", want, string(rest))
+	}
+}
+
+func TestSortedKeys(t *testing.T) {
+	type sortedMetaData struct {
+		Title  string `json:"title"`
+		Count  int64  `json:"count"`
+		Author struct {
+			Name string `json:"name"`
+			Bio  string `json:"bio"`
+		} `json:"author"`
+	}
+
+	v := sortedMetaData{Title: "example", Count: 1<<53 + 1}
+	v.Author.Name, v.Author.Bio = "John Doe", "<b>bio</b>"
+
+	m := map[string]interface{}{
+		"title":  "example",
+		"count":  int64(1<<53 + 1),
+		"author": map[string]interface{}{"name": "John Doe", "bio": "<b>bio</b>"},
+	}
+
+	wantFile := "{\n\t\"author\": {\n\t\t\"bio\": \"\\u003cb\\u003ebio\\u003c/b\\u003e\",\n\t\t\"name\": \"John Doe\"\n\t},\n\t\"count\": 9007199254740993,\n\t\"title\": \"example\"\n}\n\n" + wantContent
+
+	sorted := JSONEncoding.Clone(WithSortedKeys())
+	if have := JSONEncoding.EncodeToString([]byte(wantContent), v); wantFile == have {
+		t.Error("(without): want the struct fields in declaration order")
+	}
+
+	for _, r := range []struct {
+		Name string
+		V    interface{}
+	}{
+		{"Struct", v},
+		{"Map", m},
+		{"MapAgain", m},
+	} {
+		haveFile, err := sorted.Clone().AppendEncode(nil, []byte(wantContent), r.V)
+		if err != nil {
+			t.Errorf(r.Name+": err: %s", err)
+		}
+
+		if wantFile != string(haveFile) {
+			t.Errorf(r.Name+": \nwant: %q \nhave: %q", wantFile, string(haveFile))
+		}
+	}
+
+	fenced := JSONFencedEncoding.Clone(WithSortedKeys())
+	if want, have := "```json\n{\n\t\"A\": 1,\n\t\"B\": 2\n}\n```\n\n", fenced.EncodeToString(nil, struct{ B, A int }{2, 1}); want != have {
+		t.Errorf("Fenced: \nwant: %q \nhave: %q", want, have)
+	}
+
+	// the marshal func is wrapped once all of the options are set, so it
+	// doesn't matter which comes first
+	late := MustNewEncoding(
+		WithSortedKeys(),
+		WithName("json"),
+		WithDelimiter(JSONDelimiterPair),
+		WithSplitFunc(SpaceSeparatedTokenDelimiters),
+		WithIncludeDelimiter(),
+		WithMarshalFunc(jsonMarshal),
+	)
+	if haveFile, err := late.AppendEncode(nil, []byte(wantContent), v); err != nil || wantFile != string(haveFile) {
+		t.Errorf("Late: \nwant: %q \nhave: %q %v", wantFile, string(haveFile), err)
+	}
+
+	for _, option := range []EncodingOptionFunc{WithSortedKeys(), WithJSONNumber()} {
+		if _, err := YAMLEncoding.AppendEncode(nil, []byte(wantContent), v, option); err == nil || !strings.Contains(err.Error(), "only for JSON") {
+			t.Errorf("YAML: want an only for JSON error have: %v", err)
+		}
+	}
+}
+
+func TestMetadata(t *testing.T) {
+	var runner = []struct {
+		Name     string
+		Encoding *Encoding
+		File     string
+	}{
+		{"YAML", YAMLEncoding, testCaseData["YAML"]["file"]},
+		{"TOML", TOMLEncoding, testCaseData["TOML"]["file"]},
+		{"JSON", JSONEncoding, testCaseData["JSON"]["file"]},
+		{"Footer", YAMLEncoding.Clone(WithPosition(FooterPosition)), wantContent + "\n---\nname: John Doe\n---\n"},
+		{"BOM", YAMLEncoding.Clone(WithStripBOM()), "\xef\xbb\xbf" + testCaseData["YAML"]["file"]},
+		{"NoFrontmatter", YAMLEncoding, wantContent},
+		{"Unclosed", YAMLEncoding, "---\nname: John Doe\n"},
+		{"Large", YAMLEncoding, string(largeFile)},
+	}
+
+	for _, r := range runner {
+		wantMetaData := testMetaData{}
+		_, wantErr := r.Encoding.DecodeString(r.File, &wantMetaData)
+
+		haveMetaData := testMetaData{}
+		if err := r.Encoding.Metadata([]byte(r.File), &haveMetaData); err != wantErr {
+			t.Errorf(r.Name+": want: %v have: %v", wantErr, err)
+		}
+
+		if wantMetaData != haveMetaData {
+			t.Errorf(r.Name+": \nwant: %+v \nhave: %+v", wantMetaData, haveMetaData)
+		}
+	}
+
+	if err := YAMLEncoding.Metadata([]byte("---\nname: [\n---\n\n"+wantContent), &testMetaData{}); err == nil {
+		t.Error("UnmarshalError: want an error")
+	}
+}
+
+func BenchmarkMetadata(b *testing.B) {
+	b.Run("Metadata", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			YAMLEncoding.Metadata(largeFile, &testMetaData{})
+		}
+	})
+
+	b.Run("DecodeString", func(b *testing.B) {
+		src := string(largeFile)
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			YAMLEncoding.DecodeString(src, &testMetaData{})
+		}
+	})
+}
+
+func TestDecodePreview(t *testing.T) {
+	var runner = []struct {
+		Name          string
+		Encoding      *Encoding
+		File          string
+		N             int
+		WantContent   string
+		WantTruncated bool
+	}{
+		{"Short", YAMLEncoding, testCaseData["YAML"]["file"], 4, "This", true},
+		{"Exact", YAMLEncoding, testCaseData["YAML"]["file"], len(wantContent), wantContent, false},
+		{"Long", YAMLEncoding, testCaseData["YAML"]["file"], 1024, wantContent, false},
+		{"Zero", YAMLEncoding, testCaseData["YAML"]["file"], 0, "", true},
+		{"NoFrontmatter", YAMLEncoding, wantContent, 4, "This", true},
+		{"NoFrontmatterLong", YAMLEncoding, wantContent, 1024, wantContent, false},
+		{"TOML", TOMLEncoding, testCaseData["TOML"]["file"], 7, "This is", true},
+		{"Large", YAMLEncoding, string(largeFile), 7, "This is", true},
+		{"Huge", YAMLEncoding, testCaseData["YAML"]["file"], math.MaxInt, wantContent, false},
+	}
+
+	for _, r := range runner {
+		haveMetaData := testMetaData{}
+		haveContent, haveTruncated, err := r.Encoding.DecodePreview([]byte(r.File), &haveMetaData, r.N)
+		if err != nil {
+			t.Errorf(r.Name+": err: %s", err)
+		}
+
+		if r.WantContent != string(haveContent) || r.WantTruncated != haveTruncated {
+			t.Errorf(r.Name+": \nwant: %q %t \nhave: %q %t", r.WantContent, r.WantTruncated, string(haveContent), haveTruncated)
+		}
+
+		if r.Name != "NoFrontmatter" && r.Name != "NoFrontmatterLong" && haveMetaData.Name != "John Doe" {
+			t.Errorf(r.Name+": want: %q have: %q", "John Doe", haveMetaData.Name)
+		}
+	}
+
+	haveContent, _, err := YAMLEncoding.DecodePreview([]byte("---\nname: [\n---\n\n"+wantContent), &testMetaData{}, 4)
+	if err == nil || string(haveContent) != "This" {
+		t.Errorf("UnmarshalError: want the content and an error have: %q %v", string(haveContent), err)
+	}
+}
+
+func BenchmarkDecodePreview(b *testing.B) {
+	b.Run("DecodePreview", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			YAMLEncoding.DecodePreview(largeFile, &testMetaData{}, 256)
+		}
+	})
+
+	b.Run("DecodeReader", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			YAMLEncoding.DecodeReader(bytes.NewReader(largeFile), &testMetaData{})
+		}
+	})
+}
+
+func TestRawMatterHook(t *testing.T) {
+	wantRaw := "name: John Doe\ndate: 10-10-2016\ntitle: example YAML"
+	errStop := errors.New("stop")
+
+	var haveRaw []string
+	e := YAMLEncoding.Clone(WithRawMatterHook(func(raw []byte) error {
+		haveRaw = append(haveRaw, string(raw))
+		return nil
+	}))
+
+	var runner = []struct {
+		Name   string
+		Decode func(e *Encoding, v interface{}) error
+	}{
+		{"DecodeString", func(e *Encoding, v interface{}) error {
+			_, err := e.DecodeString(testCaseData["YAML"]["file"], v)
+			return err
+		}},
+		{"DecodeReaderAt", func(e *Encoding, v interface{}) error {
+			_, err := e.DecodeReaderAt(strings.NewReader(testCaseData["YAML"]["file"]), 16, v)
+			return err
+		}},
+		{"StreamDecoder", func(e *Encoding, v interface{}) error {
+			d := e.NewStreamDecoder(strings.NewReader(testCaseData["YAML"]["file"]))
+			if _, err := ioutil.ReadAll(d); err != nil {
+				return err
+			}
+			return d.Decode(v)
+		}},
+	}
+
+	for _, r := range runner {
+		haveRaw = nil
+		if err := r.Decode(e, &testMetaData{}); err != nil {
+			t.Errorf(r.Name+": err: %s", err)
+		}
+
+		if len(haveRaw) != 1 || haveRaw[0] != wantRaw {
+			t.Errorf(r.Name+": \nwant: %q \nhave: %q", []string{wantRaw}, haveRaw)
+		}
+
+		haveMetaData := testMetaData{}
+		stop := e.Clone(WithRawMatterHook(func([]byte) error { return errStop }))
+		if err := r.Decode(stop, &haveMetaData); !errors.Is(err, errStop) {
+			t.Errorf(r.Name+"(stop): want: %v have: %v", errStop, err)
+		}
+
+		if haveMetaData != (testMetaData{}) {
+			t.Errorf(r.Name+"(stop): want the metadata untouched have: %+v", haveMetaData)
+		}
+	}
+
+	haveRaw = nil
+	if _, err := e.DecodeString(wantContent, &testMetaData{}); err != nil || haveRaw != nil {
+		t.Errorf("NoFrontmatter: want no call have: %q %v", haveRaw, err)
+	}
+}
+
+func TestDecodeTo(t *testing.T) {
+	encodings := map[string]*Encoding{"YAML": YAMLEncoding, "TOML": TOMLEncoding, "JSON": JSONEncoding}
+	for _, name := range []string{"YAML", "TOML", "JSON"} {
+		haveMetaData := testMetaData{}
+		haveContent := new(bytes.Buffer)
+		if err := encodings[name].DecodeTo(strings.NewReader(testCaseData[name]["file"]), &haveMetaData, haveContent); err != nil {
+			t.Errorf(name+": err: %s", err)
+		}
+
+		if wantContent != haveContent.String() {
+			t.Errorf(name+": \nwant: %q \nhave: %q", wantContent, haveContent.String())
+		}
+
+		if haveMetaData.Name != "John Doe" {
+			t.Errorf(name+": want: %q have: %q", "John Doe", haveMetaData.Name)
+		}
+	}
+
+	const size = 1 << 22 // streamed, so never held in memory
+	n := &countWriter{w: ioutil.Discard}
+	src := io.MultiReader(strings.NewReader("---\nname: John Doe\n---\n\n"), &repeatReader{c: 'a', n: size})
+	if err := YAMLEncoding.DecodeTo(src, &testMetaData{}, n); err != nil || n.n != size {
+		t.Errorf("Large: want: %d have: %d %v", size, n.n, err)
+	}
+
+	errStop := errors.New("stop")
+	src = io.MultiReader(strings.NewReader("---\nname: John Doe\n---\n\n"), &repeatReader{c: 'a', n: size})
+	if err := YAMLEncoding.DecodeTo(src, &testMetaData{}, errWriter{err: errStop}); !errors.Is(err, errStop) {
+		t.Errorf("WriteError: want: %v have: %v", errStop, err)
+	}
+
+	haveContent := new(bytes.Buffer)
+	err := YAMLEncoding.DecodeTo(strings.NewReader("---\nname: [\n---\n\n"+wantContent), &testMetaData{}, haveContent)
+	if err == nil || wantContent != haveContent.String() {
+		t.Errorf("UnmarshalError: want the content and an error have: %q %v", haveContent.String(), err)
+	}
+}
+
+func TestJSONFencedEncoding(t *testing.T) {
+	fencedFile := "```json\n" + strings.TrimSuffix(testCaseData["JSON"]["file"], "\n\n"+wantContent) + "\n```\n\n" + wantContent
+
+	var runner = []struct {
+		Name     string
+		Encoding *Encoding
+		File     string
+	}{
+		{"Bare", JSONEncoding, testCaseData["JSON"]["file"]},
+		{"Fenced", JSONFencedEncoding, fencedFile},
+	}
+
+	for _, r := range runner {
+		for _, rd := range []struct {
+			Name   string
+			Reader func(io.Reader) io.Reader
+		}{
+			{"", func(r io.Reader) io.Reader { return r }},
+			{"OneByte", iotest.OneByteReader},
+		} {
+			haveMetaData := testMetaData{}
+			haveContent, err := r.Encoding.DecodeReader(rd.Reader(strings.NewReader(r.File)), &haveMetaData)
+			if err != nil {
+				t.Errorf(r.Name+rd.Name+": err: %s", err)
+			}
+
+			if wantContent != string(haveContent) {
+				t.Errorf(r.Name+rd.Name+": \nwant: %q \nhave: %q", wantContent, string(haveContent))
+			}
+
+			wantMetaData := testMetaData{Name: "John Doe", Date: "10-10-2016", Title: "example JSON"}
+			if !reflect.DeepEqual(wantMetaData, haveMetaData) {
+				t.Errorf(r.Name+rd.Name+": \nwant: %+v \nhave: %+v", wantMetaData, haveMetaData)
+			}
+		}
+	}
+
+	haveMetaData := testMetaData{}
+	if _, err := JSONFencedEncoding.DecodeString(fencedFile, &haveMetaData); err != nil {
+		t.Errorf("Fenced(DecodeString): err: %s", err)
+	}
+
+	if have := JSONFencedEncoding.EncodeToString([]byte(wantContent), haveMetaData); fencedFile != have {
+		t.Errorf("Fenced(EncodeToString): \nwant: %q \nhave: %q", fencedFile, have)
+	}
+}
+
+func TestDecodeRaw(t *testing.T) {
+	var runner = []struct {
+		Name       string
+		Encoding   *Encoding
+		File       string
+		WantMatter string
+	}{
+		{"YAML", YAMLEncoding, testCaseData["YAML"]["file"], "name: John Doe\ndate: 10-10-2016\ntitle: example YAML"},
+		{"YAMLDelimiter", YAMLEncoding.Clone(WithIncludeRawDelimiter()), testCaseData["YAML"]["file"], "---\nname: John Doe\ndate: 10-10-2016\ntitle: example YAML\n---\n"},
+		{"TOMLDelimiter", TOMLEncoding.Clone(WithIncludeRawDelimiter()), testCaseData["TOML"]["file"], strings.TrimSuffix(testCaseData["TOML"]["file"], "\n"+wantContent)},
+		{"JSON", JSONEncoding, testCaseData["JSON"]["file"], "{\t\"Name\": \"John Doe\",\n\t\"Date\": \"10-10-2016\",\n\t\"Title\": \"example JSON\"}"},
+		{"JSONDelimiter", JSONEncoding.Clone(WithIncludeRawDelimiter()), testCaseData["JSON"]["file"], strings.TrimSuffix(testCaseData["JSON"]["file"], "\n"+wantContent)},
+		{"None", YAMLEncoding.Clone(WithIncludeRawDelimiter()), wantContent, ""},
+		{"CRLFDelimiter", YAMLEncoding.Clone(WithIncludeRawDelimiter(), WithCRLFDelimiters()), "---\r\nname: John Doe\r\ntitle: example\r\n---\r\n" + wantContent, "---\r\nname: John Doe\r\ntitle: example\r\n---\r\n"},
+		{"SpaceDelimiter", YAMLEncoding.Clone(WithIncludeRawDelimiter(), WithTrimDelimiterWhitespace()), "---  \nname: John Doe\n---\t\n\n" + wantContent, "---  \nname: John Doe\n---\t\n"},
+		{"EmptyDelimiter", YAMLEncoding.Clone(WithIncludeRawDelimiter()), "---\n---\n\n" + wantContent, "---\n---\n"},
+	}
+
+	for _, r := range runner {
+		haveMatter, haveContent, err := r.Encoding.DecodeRaw([]byte(r.File))
+		if err != nil {
+			t.Errorf(r.Name+": err: %s", err)
+		}
+
+		if r.WantMatter != string(haveMatter) {
+			t.Errorf(r.Name+": \nwant: %q \nhave: %q", r.WantMatter, string(haveMatter))
+		}
+
+		if wantContent != string(haveContent) {
+			t.Errorf(r.Name+": \nwant: %q \nhave: %q", wantContent, string(haveContent))
+		}
+	}
+
+	// a "\r\n" delimiter line doesn't open a block without WithCRLFDelimiters
+	wantFile := "---\r\n" + wantContent
+	haveMatter, haveContent, err := YAMLEncoding.Clone(WithIncludeRawDelimiter()).DecodeRaw([]byte(wantFile))
+	if err != nil || haveMatter != nil || wantFile != string(haveContent) {
+		t.Errorf("CRLFNone: \nwant: %q %q \nhave: %q %q %v", "", wantFile, haveMatter, haveContent, err)
+	}
+}
+
+func TestDecodeToWriters(t *testing.T) {
+	var runner = []struct {
+		Name       string
+		Encoding   *Encoding
+		File       string
+		WantMatter string
+	}{
+		{"YAML", YAMLEncoding, testCaseData["YAML"]["file"], "name: John Doe\ndate: 10-10-2016\ntitle: example YAML"},
+		{"TOML", TOMLEncoding, testCaseData["TOML"]["file"], "Name = \"John Doe\"\nDate = \"10-10-2016\"\nTitle = \"example TOML\""},
+		{"None", YAMLEncoding, wantContent, ""},
+	}
+
+	for _, r := range runner {
+		matterW, contentW := new(bytes.Buffer), new(bytes.Buffer)
+		nm, nc, err := r.Encoding.DecodeToWriters(iotest.OneByteReader(strings.NewReader(r.File)), matterW, contentW)
+		if err != nil {
+			t.Errorf(r.Name+": err: %s", err)
+		}
+
+		if r.WantMatter != matterW.String() || int64(len(r.WantMatter)) != nm {
+			t.Errorf(r.Name+": \nwant: %q (%d) \nhave: %q (%d)", r.WantMatter, len(r.WantMatter), matterW.String(), nm)
+		}
+
+		if wantContent != contentW.String() || int64(len(wantContent)) != nc {
+			t.Errorf(r.Name+": \nwant: %q (%d) \nhave: %q (%d)", wantContent, len(wantContent), contentW.String(), nc)
+		}
+	}
+}
+
+func TestDecodeShortContent(t *testing.T) {
+	var runner = []struct {
+		Name    string
+		File    string
+		DstLen  int
+		WantN   int
+		WantErr error
+	}{
+		{"Shorter", testCaseData["YAML"]["file"], len(wantContent) - 5, len(wantContent) - 5, nil},
+		{"Equal", testCaseData["YAML"]["file"], len(wantContent), len(wantContent), nil},
+		{"Longer", testCaseData["YAML"]["file"], len(wantContent) + 5, len(wantContent), io.EOF},
+		{"NoFrontmatterShorter", wantContent, len(wantContent) - 5, len(wantContent) - 5, nil},
+		{"NoFrontmatterEqual", wantContent, len(wantContent), len(wantContent), nil},
+		{"NoFrontmatterLonger", wantContent, len(wantContent) + 5, len(wantContent), io.EOF},
+		{"NoContent", "---\nname: John Doe\n---\n", 5, 0, io.EOF},
+	}
+
+	for _, r := range runner {
+		dst := make([]byte, r.DstLen)
+		haveN, err := YAMLEncoding.Decode(dst, []byte(r.File), &testMetaData{})
+		if r.WantErr != err {
+			t.Errorf(r.Name+": want: %v have: %v", r.WantErr, err)
+		}
+
+		if r.WantN != haveN {
+			t.Errorf(r.Name+": want: %d have: %d", r.WantN, haveN)
+		}
+
+		if want := wantContent[:r.WantN]; want != string(dst[:haveN]) {
+			t.Errorf(r.Name+": \nwant: %q \nhave: %q", want, string(dst[:haveN]))
+		}
+	}
+}
+
+func TestJSONNumber(t *testing.T) {
+	file := "{\n\"id\": 9007199254740993\n}\n\n" + wantContent
+
+	haveMap := make(map[string]interface{})
+	if _, err := JSONEncoding.DecodeString(file, &haveMap); err != nil {
+		t.Errorf("(float64): err: %s", err)
+	}
+
+	if have, ok := haveMap["id"].(float64); !ok || have != 9007199254740992 {
+		t.Errorf("(float64): want a rounded float64 have: %#v", haveMap["id"])
+	}
+
+	for _, enc := range []*Encoding{
+		JSONEncoding.Clone(WithJSONNumber()),
+		JSONEncoding.Clone(WithJSONNumber(), WithStrictUnmarshal()),
+	} {
+		haveMap = make(map[string]interface{})
+		haveContent, err := enc.DecodeString(file, &haveMap)
+		if err != nil {
+			t.Errorf("(json.Number): err: %s", err)
+		}
+
+		if wantContent != string(haveContent) {
+			t.Errorf("(json.Number): \nwant: %q \nhave: %q", wantContent, string(haveContent))
+		}
+
+		if want := json.Number("9007199254740993"); want != haveMap["id"] {
+			t.Errorf("(json.Number): want: %#v have: %#v", want, haveMap["id"])
+		}
+
+		// data after the object is an error, as it is for json.Unmarshal
+		if _, err := enc.DecodeString("{\n\"id\": 1}\n{\"id\": 2\n}\n\n"+wantContent, &map[string]interface{}{}); err == nil {
+			t.Errorf("(json.Number): want an error for data after the object")
+		}
+	}
+}
+
+func TestLenientFallback(t *testing.T) {
+	haveEnc := YAMLEncoding.Clone(WithLenientFallback())
+	file := "---\nname: [John, Doe\n---\n\n" + wantContent
+
+	haveMetaData := testMetaData{Name: "untouched"}
+	haveContent, err := haveEnc.DecodeString(file, &haveMetaData)
+	if err != nil {
+		t.Errorf("(DecodeString): err: %s", err)
+	}
+
+	if file != string(haveContent) {
+		t.Errorf("(DecodeString): \nwant: %q \nhave: %q", file, string(haveContent))
+	}
+
+	if haveMetaData.Name != "untouched" {
+		t.Errorf("(DecodeString): the metadata should be untouched: %+v", haveMetaData)
+	}
+
+	rs, err := haveEnc.DecodeSeeker(strings.NewReader(file), &haveMetaData)
+	if err != nil {
+		t.Errorf("(DecodeSeeker): err: %s", err)
+	}
+
+	if haveContent, _ := ioutil.ReadAll(rs); file != string(haveContent) {
+		t.Errorf("(DecodeSeeker): \nwant: %q \nhave: %q", file, string(haveContent))
+	}
+
+	wantMetaData.Title = "example YAML"
+	haveMetaData = testMetaData{}
+	haveContent, err = haveEnc.DecodeString(testCaseData["YAML"]["file"], &haveMetaData)
+	if err != nil || wantContent != string(haveContent) || !reflect.DeepEqual(wantMetaData, haveMetaData) {
+		t.Errorf("(valid): want the frontmatter decoded have: %+v %q %v", haveMetaData, string(haveContent), err)
+	}
+
+	if _, err := YAMLEncoding.DecodeString(file, &testMetaData{}); err == nil {
+		t.Error("(without): want an error")
+	}
+}
+
+type testPage struct {
+	Type, Title string
+}
+
+type testRedirect struct {
+	Type, To string
+}
+
+func TestDecodeDiscriminated(t *testing.T) {
+	registry := map[string]func() interface{}{
+		"page":     func() interface{} { return &testPage{} },
+		"redirect": func() interface{} { return &testRedirect{} },
+	}
+
+	var runner = []struct {
+		Name    string
+		File    string
+		Want    interface{}
+		WantErr error
+	}{
+		{"Page", "---\ntype: page\ntitle: example\n---\n\n" + wantContent, &testPage{Type: "page", Title: "example"}, nil},
+		{"Redirect", "---\ntype: redirect\nto: /example\n---\n\n" + wantContent, &testRedirect{Type: "redirect", To: "/example"}, nil},
+		{"Missing", "---\ntitle: example\n---\n\n" + wantContent, nil, ErrNoDiscriminator},
+		{"NoFrontmatter", wantContent, nil, ErrNoDiscriminator},
+		{"Unknown", "---\ntype: post\n---\n\n" + wantContent, nil, ErrUnknownDiscriminator},
+	}
+
+	for _, r := range runner {
+		have, haveContent, err := YAMLEncoding.DecodeDiscriminated([]byte(r.File), "type", registry)
+		if !errors.Is(err, r.WantErr) {
+			t.Errorf(r.Name+": want: %v have: %v", r.WantErr, err)
+		}
+
+		if r.WantErr != nil {
+			continue
+		}
+
+		if wantContent != string(haveContent) {
+			t.Errorf(r.Name+": \nwant: %q \nhave: %q", wantContent, string(haveContent))
+		}
+
+		if !reflect.DeepEqual(r.Want, have) {
+			t.Errorf(r.Name+": \nwant: %#v \nhave: %#v", r.Want, have)
+		}
+	}
+}
+
+func TestNewDecoderLen(t *testing.T) {
+	type lener interface{ Len() int }
+
+	var runner = []struct {
+		Name    string
+		Reader  io.Reader
+		WantLen bool
+	}{
+		{"bytes.Reader", bytes.NewReader([]byte(testCaseData["YAML"]["file"])), true},
+		{"bytes.Buffer", bytes.NewBufferString(testCaseData["YAML"]["file"]), true},
+		{"strings.Reader", strings.NewReader(testCaseData["YAML"]["file"]), true},
+		{"Stream", iotest.OneByteReader(strings.NewReader(testCaseData["YAML"]["file"])), false},
+	}
+
+	for _, r := range runner {
+		out, err := NewDecoder(YAMLEncoding, r.Reader, &testMetaData{})
+		if err != nil {
+			t.Errorf(r.Name+": err: %s", err)
+		}
+
+		l, ok := out.(lener)
+		if r.WantLen != ok {
+			t.Errorf(r.Name+": want Len: %t have: %t", r.WantLen, ok)
+		}
+
+		if ok && len(wantContent) != l.Len() {
+			t.Errorf(r.Name+": want: %d have: %d", len(wantContent), l.Len())
+		}
+
+		if haveContent, _ := ioutil.ReadAll(out); wantContent != string(haveContent) {
+			t.Errorf(r.Name+": \nwant: %q \nhave: %q", wantContent, string(haveContent))
+		}
+	}
+}
+
+func TestEmptyFrontmatter(t *testing.T) {
+	var runner = []struct {
+		Name     string
+		Encoding *Encoding
+		File     string
+	}{
+		{"YAML", YAMLEncoding, "---\n---\n\n" + wantContent},
+		{"TOML", TOMLEncoding, "+++\n+++\n\n" + wantContent},
+		{"JSON", JSONEncoding, "{\n}\n\n" + wantContent},
+		{"YAMLBlankLine", YAMLEncoding, "---\n\n---\n\n" + wantContent},
+	}
+
+	for _, r := range runner {
+		haveMetaData := testMetaData{}
+		have, err := r.Encoding.DecodeMatched([]byte(r.File), &haveMetaData)
+		if err != nil {
+			t.Errorf(r.Name+": err: %s", err)
+		}
+
+		if !have.Matched {
+			t.Errorf(r.Name + ": want a match")
+		}
+
+		if wantContent != string(have.Content) {
+			t.Errorf(r.Name+": \nwant: %q \nhave: %q", wantContent, string(have.Content))
+		}
+
+		if (testMetaData{}) != haveMetaData {
+			t.Errorf(r.Name+": want the zero value have: %+v", haveMetaData)
+		}
+
+		rs, err := r.Encoding.DecodeSeeker(strings.NewReader(r.File), &haveMetaData)
+		if err != nil {
+			t.Errorf(r.Name+"(DecodeSeeker): err: %s", err)
+		}
+
+		if haveContent, _ := ioutil.ReadAll(rs); wantContent != string(haveContent) {
+			t.Errorf(r.Name+"(DecodeSeeker): \nwant: %q \nhave: %q", wantContent, string(haveContent))
+		}
+	}
+
+	for _, file := range []string{wantContent, "---\nname: John Doe\n"} {
+		have, err := YAMLEncoding.DecodeMatched([]byte(file), &testMetaData{})
+		if err != nil || have.Matched || file != string(have.Content) {
+			t.Errorf("want no match have: %+v %v", have, err)
+		}
+	}
+
+	for _, file := range []string{"---\n---", "---\n---\n"} {
+		have, err := YAMLEncoding.DecodeMatched([]byte(file), &testMetaData{})
+		if err != nil || !have.Matched || len(have.Content) != 0 {
+			t.Errorf("%q: want a match without content have: %+v %v", file, have, err)
+		}
+	}
+}
+
+func TestStrictSeparation(t *testing.T) {
+	strict := JSONEncoding.Clone(WithStrictSeparation())
+
+	var runner = []struct {
+		Name        string
+		Encoding    *Encoding
+		File        string
+		WantErr     bool
+		WantContent string
+	}{
+		{"Separated", strict, "{\n\"title\": \"example\"\n}\n\n" + wantContent, false, wantContent},
+		{"NoBlankLine", strict, "{\n\"title\": \"example\"\n}\n" + wantContent, false, wantContent},
+		{"NoFrontmatter", strict, wantContent, false, wantContent},
+		{"ClosingAdjacent", strict, "{\n\"title\": \"example\"\n}" + wantContent, true, ""},
+		{"ClosingSpace", strict, "{\n\"title\": \"example\"\n} " + wantContent, true, ""},
+		{"OpeningAdjacent", strict, "{\"title\": \"example\"}\n\n" + wantContent, true, ""},
+		{"StrictFence", strict.Clone(WithStrictFence()), "{\n\"title\": \"example\"\n}\n" + wantContent, true, ""},
+		{"Without", JSONEncoding, "{\n\"title\": \"example\"\n}" + wantContent, false, "{\n\"title\": \"example\"\n}" + wantContent},
+	}
+
+	for _, r := range runner {
+		decoders := []struct {
+			Name   string
+			Decode func(v *testMetaData) ([]byte, error)
+		}{
+			{"DecodeString", func(v *testMetaData) ([]byte, error) { return r.Encoding.DecodeString(r.File, v) }},
+			{"Metadata", func(v *testMetaData) ([]byte, error) {
+				if err := r.Encoding.Metadata([]byte(r.File), v); err != nil {
+					return nil, err
+				}
+				return r.Encoding.StripFrontmatter([]byte(r.File))
+			}},
+			{"DecodeReaderAt", func(v *testMetaData) ([]byte, error) {
+				offset, err := r.Encoding.DecodeReaderAt(strings.NewReader(r.File), 8, v)
+				return []byte(r.File[offset:]), err
+			}},
+		}
+
+		for _, d := range decoders {
+			haveContent, err := d.Decode(&testMetaData{})
+			if r.WantErr {
+				if !errors.Is(err, ErrNotSeparated) {
+					t.Errorf(r.Name+"("+d.Name+"): want: %v have: %v", ErrNotSeparated, err)
+				}
+				continue
+			}
+
+			if err != nil {
+				t.Errorf(r.Name+"("+d.Name+"): err: %s", err)
+			}
+
+			if r.WantContent != string(haveContent) {
+				t.Errorf(r.Name+"("+d.Name+"): \nwant: %q \nhave: %q", r.WantContent, string(haveContent))
+			}
+		}
+	}
+}
+
+func TestStrictFence(t *testing.T) {
+	var runner = []struct {
+		Name        string
+		Encoding    *Encoding
+		File        string
+		WantMatter  string
+		WantContent string
+	}{
+		{"Default", TOMLEncoding, "+++\na = 1\n+++\nb = 2\n+++\n\nbody", "a = 1", "b = 2\n+++\n\nbody"},
+		{"Strict", TOMLEncoding.Clone(WithStrictFence()), "+++\na = 1\n+++\nb = 2\n+++\n\nbody", "a = 1\n+++\nb = 2", "body"},
+		{"StrictEOF", TOMLEncoding.Clone(WithStrictFence()), "+++\na = 1\n+++", "a = 1", ""},
+		{"StrictEmpty", TOMLEncoding.Clone(WithStrictFence()), "+++\n+++\na = 1\n+++\n\nbody", "+++\na = 1", "body"},
+		{"BlockScalar", YAMLEncoding, "---\nbody: |\n  ---\n  text\n---\n\nbody", "body: |\n  ---\n  text", "body"},
+	}
+
+	for _, r := range runner {
+		haveMatter, haveContent, err := r.Encoding.DecodeRaw([]byte(r.File))
+		if err != nil {
+			t.Errorf(r.Name+": err: %s", err)
+		}
+
+		if r.WantMatter != string(haveMatter) {
+			t.Errorf(r.Name+": \nwant: %q \nhave: %q", r.WantMatter, string(haveMatter))
+		}
+
+		if r.WantContent != string(haveContent) {
+			t.Errorf(r.Name+": \nwant: %q \nhave: %q", r.WantContent, string(haveContent))
+		}
+
+		matterW, contentW := new(bytes.Buffer), new(bytes.Buffer)
+		r.Encoding.DecodeToWriters(iotest.OneByteReader(strings.NewReader(r.File)), matterW, contentW)
+		if r.WantMatter != matterW.String() || r.WantContent != contentW.String() {
+			t.Errorf(r.Name+"(OneByteReader): \nwant: %q %q \nhave: %q %q", r.WantMatter, r.WantContent, matterW.String(), contentW.String())
+		}
+	}
+}
+
+// countingReaderAt counts the bytes read from an io.ReaderAt.
+type countingReaderAt struct {
+	ra io.ReaderAt
+	n  int
+}
+
+func (c *countingReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	n, err := c.ra.ReadAt(p, off)
+	c.n += n
+	return n, err
+}
+
+func TestDecodeReaderAt(t *testing.T) {
+	var runner = []struct {
+		Name       string
+		Encoding   *Encoding
+		File       string
+		Probe      int
+		WantOffset int64
+	}{
+		{"YAML", YAMLEncoding, testCaseData["YAML"]["file"], 16, int64(len(testCaseData["YAML"]["file"]) - len(wantContent))},
+		{"TOML", TOMLEncoding, testCaseData["TOML"]["file"], 1, int64(len(testCaseData["TOML"]["file"]) - len(wantContent))},
+		{"JSON", JSONEncoding, "// comment\n" + testCaseData["JSON"]["file"], 4, int64(len(testCaseData["JSON"]["file"]) - len(wantContent) + 11)},
+		{"Large", YAMLEncoding, string(largeFile), 64, int64(len(testCaseData["YAML"]["file"]) - len(wantContent))},
+		{"None", YAMLEncoding, wantContent, 4, 0},
+		{"NeverClosed", YAMLEncoding, "---\nname: John Doe\n", 4, 0},
+		{"BOM", YAMLEncoding.Clone(WithStripBOM()), "\xef\xbb\xbf" + testCaseData["YAML"]["file"], 8, int64(3 + len(testCaseData["YAML"]["file"]) - len(wantContent))},
+	}
+
+	for _, r := range runner {
+		wantMetaData := testMetaData{}
+		r.Encoding.DecodeString(r.File, &wantMetaData)
+
+		ra := &countingReaderAt{ra: strings.NewReader(r.File)}
+		haveMetaData := testMetaData{}
+		haveOffset, err := r.Encoding.DecodeReaderAt(ra, r.Probe, &haveMetaData)
+		if err != nil {
+			t.Errorf(r.Name+": err: %s", err)
+		}
+
+		if r.WantOffset != haveOffset {
+			t.Errorf(r.Name+": want: %d have: %d", r.WantOffset, haveOffset)
+		}
+
+		if !reflect.DeepEqual(wantMetaData, haveMetaData) {
+			t.Errorf(r.Name+": \nwant: %+v \nhave: %+v", wantMetaData, haveMetaData)
+		}
+
+		if r.Name == "Large" && ra.n > 4*len(testCaseData["YAML"]["file"]) {
+			t.Errorf(r.Name+": only the frontmatter should be read, read: %d", ra.n)
+		}
+	}
+}
+
+func TestTrimSpace(t *testing.T) {
+	haveEnc := YAMLEncoding.Clone(WithTrimSpace())
+
+	var runner = []struct {
+		Name        string
+		File        string
+		WantContent string
+	}{
+		{"frontmatter", "---\ntitle: example\n---\n\n\nBody", "Body"},
+		{"trailing whitespace", "---\ntitle: example\n---\n\n\nBody\n\nMore body.\n \n\t\n", "Body\n\nMore body."},
+		{"no frontmatter", "\n\nBody\n\n", "Body"},
+		{"only whitespace", "---\ntitle: example\n---\n \n", ""},
+	}
+
+	for _, r := range runner {
+		haveContent, err := haveEnc.DecodeString(r.File, &struct{ Title string }{})
+		if err != nil {
+			t.Errorf(r.Name+"(DecodeString): err: %s", err)
+		}
+
+		if r.WantContent != string(haveContent) {
+			t.Errorf(r.Name+"(DecodeString): \nwant: %q \nhave: %q", r.WantContent, string(haveContent))
+		}
+
+		// read a byte at a time, so the whitespace is split over many reads
+		out, err := NewDecoder(haveEnc, strings.NewReader(r.File), &struct{ Title string }{})
+		if err != nil {
+			t.Errorf(r.Name+"(NewDecoder): err: %s", err)
+		}
+
+		haveContentBuf := new(bytes.Buffer)
+		for p := make([]byte, 1); ; {
+			n, err := out.Read(p)
+			haveContentBuf.Write(p[:n])
+			if err != nil {
+				break
+			}
+		}
+
+		if r.WantContent != haveContentBuf.String() {
+			t.Errorf(r.Name+"(NewDecoder): \nwant: %q \nhave: %q", r.WantContent, haveContentBuf.String())
+		}
+	}
+}
+
+func TestDecodeSeeker(t *testing.T) {
+	var runner = []struct {
+		Name     string
+		Encoding *Encoding
+		File     string
+	}{
+		{"YAML", YAMLEncoding, testCaseData["YAML"]["file"]},
+		{"TOML", TOMLEncoding, testCaseData["TOML"]["file"]},
+		{"JSON", JSONEncoding, "\n" + testCaseData["JSON"]["file"]},
+		{"None", YAMLEncoding, wantContent},
+	}
+
+	for _, r := range runner {
+		wantMetaData.Title = "example " + r.Name
+
+		haveMetaData := testMetaData{}
+		rs, err := r.Encoding.DecodeSeeker(strings.NewReader(r.File), &haveMetaData)
+		if err != nil {
+			t.Errorf(r.Name+": err: %s", err)
+			continue
+		}
+
+		if r.Name != "None" && !reflect.DeepEqual(wantMetaData, haveMetaData) {
+			t.Errorf(r.Name+": \nwant: %+v \nhave: %+v", wantMetaData, haveMetaData)
+		}
+
+		haveContent, _ := ioutil.ReadAll(rs)
+		if wantContent != string(haveContent) {
+			t.Errorf(r.Name+": \nwant: %q \nhave: %q", wantContent, string(haveContent))
+		}
+
+		n, err := rs.Seek(5, io.SeekStart)
+		if err != nil || n != 5 {
+			t.Errorf(r.Name+": seek: want: %d have: %d (err: %v)", 5, n, err)
+		}
+
+		haveContent, _ = ioutil.ReadAll(rs)
+		if wantContent[5:] != string(haveContent) {
+			t.Errorf(r.Name+": \nwant: %q \nhave: %q", wantContent[5:], string(haveContent))
+		}
+
+		if n, _ := rs.Seek(0, io.SeekEnd); n != int64(len(wantContent)) {
+			t.Errorf(r.Name+": seek end: want: %d have: %d", len(wantContent), n)
+		}
+
+		if _, err := rs.Seek(-1, io.SeekStart); err == nil {
+			t.Errorf(r.Name + ": expected an error seeking before the content")
+		}
+	}
+}
+
+func TestWholeDocument(t *testing.T) {
+	var runner = []struct {
+		Name     string
+		Encoding *Encoding
+		File     string
+	}{
+		{"YAML", YAMLEncoding.Clone(WithWholeDocument()), "name: John Doe\ndate: 10-10-2016\ntitle: example YAML\n"},
+		{"TOML", TOMLEncoding.Clone(WithWholeDocument()), "Name = \"John Doe\"\nDate = \"10-10-2016\"\nTitle = \"example TOML\"\n"},
+		{"JSON", JSONEncoding.Clone(WithWholeDocument()), "{\n\t\"Name\": \"John Doe\",\n\t\"Date\": \"10-10-2016\",\n\t\"Title\": \"example JSON\"\n}"},
+	}
+
+	for _, r := range runner {
+		wantMetaData.Title = "example " + r.Name
+
+		haveMetaData := testMetaData{}
+		haveContent, err := r.Encoding.DecodeString(r.File, &haveMetaData)
+		if err != nil {
+			t.Errorf(r.Name+"(DecodeString): err: %s", err)
+		}
+
+		if len(haveContent) != 0 {
+			t.Errorf(r.Name+"(DecodeString): want no content have: %q", string(haveContent))
+		}
+
+		if !reflect.DeepEqual(wantMetaData, haveMetaData) {
+			t.Errorf(r.Name+"(DecodeString): \nwant: %+v \nhave: %+v", wantMetaData, haveMetaData)
+		}
+
+		haveMetaData = testMetaData{}
+		rs, err := r.Encoding.DecodeSeeker(strings.NewReader(r.File), &haveMetaData)
+		if err != nil {
+			t.Errorf(r.Name+"(DecodeSeeker): err: %s", err)
+		}
+
+		if haveContent, _ := ioutil.ReadAll(rs); len(haveContent) != 0 {
+			t.Errorf(r.Name+"(DecodeSeeker): want no content have: %q", string(haveContent))
+		}
+
+		if !reflect.DeepEqual(wantMetaData, haveMetaData) {
+			t.Errorf(r.Name+"(DecodeSeeker): \nwant: %+v \nhave: %+v", wantMetaData, haveMetaData)
+		}
+
+		if haveFile := r.Encoding.EncodeToString(nil, wantMetaData); r.File != haveFile {
+			t.Errorf(r.Name+"(EncodeToString): \nwant: %q \nhave: %q", r.File, haveFile)
+		}
+	}
+}
+
+func TestFrontmatterError(t *testing.T) {
+	_, err := YAMLEncoding.DecodeString("---\nname: [John, Doe]\n---\n\n"+wantContent, &testMetaData{})
+
+	var haveErr *FrontmatterError
+	if !errors.As(err, &haveErr) {
+		t.Fatalf("want: %T have: %T", haveErr, err)
+	}
+
+	if haveErr.Op != "decode" || haveErr.Format != "yaml" {
+		t.Errorf("want: %s %s have: %s %s", "decode", "yaml", haveErr.Op, haveErr.Format)
+	}
+
+	var haveTypeErr *yaml.TypeError
+	if !errors.As(err, &haveTypeErr) {
+		t.Errorf("want: %T have: %T", haveTypeErr, haveErr.Err)
+	}
+
+	if want := "particle: decode yaml frontmatter: "; !strings.HasPrefix(err.Error(), want) {
+		t.Errorf("want prefix: %q have: %q", want, err.Error())
+	}
+
+	_, err = JSONEncoding.AppendEncode(nil, nil, map[string]interface{}{"bad": make(chan int)})
+	if !errors.As(err, &haveErr) || haveErr.Op != "encode" || haveErr.Format != "json" {
+		t.Errorf("want an encode json error have: %v", err)
+	}
+}
+
+func TestLazyDecoder(t *testing.T) {
+	var runner = []struct {
+		Name     string
+		Encoding *Encoding
+	}{
+		{"YAML", YAMLEncoding},
+		{"TOML", TOMLEncoding},
+		{"JSON", JSONEncoding},
+	}
+
+	for _, r := range runner {
+		wantMetaData.Title = "example " + r.Name
+
+		d := NewLazyDecoder(r.Encoding, strings.NewReader(testCaseData[r.Name]["file"]))
+
+		haveContent, err := ioutil.ReadAll(d) // the content first
+		if err != nil {
+			t.Errorf(r.Name+"(Read): err: %s", err)
+		}
+
+		if wantContent != string(haveContent) {
+			t.Errorf(r.Name+"(Read): \nwant: %q \nhave: %q", wantContent, string(haveContent))
+		}
+
+		haveMetaData := testMetaData{}
+		if err := d.Metadata(&haveMetaData); err != nil {
+			t.Errorf(r.Name+"(Metadata): err: %s", err)
+		}
+
+		if !reflect.DeepEqual(wantMetaData, haveMetaData) {
+			t.Errorf(r.Name+"(Metadata): \nwant: %+v \nhave: %+v", wantMetaData, haveMetaData)
+		}
+	}
+
+	d := NewLazyDecoder(YAMLEncoding, strings.NewReader(wantContent))
+	if haveContent, _ := ioutil.ReadAll(d); wantContent != string(haveContent) {
+		t.Errorf("(no frontmatter): \nwant: %q \nhave: %q", wantContent, string(haveContent))
+	}
+
+	haveMetaData := testMetaData{Name: "unchanged"}
+	if err := d.Metadata(&haveMetaData); err != nil || haveMetaData.Name != "unchanged" {
+		t.Errorf("(no frontmatter): want untouched metadata have: %+v %v", haveMetaData, err)
+	}
+}
+
+func TestStreamDecoder(t *testing.T) {
+	var runner = []struct {
+		Name     string
+		Encoding *Encoding
+		WantRaw  string
+	}{
+		{"YAML", YAMLEncoding, "name: John Doe\ndate: 10-10-2016\ntitle: example YAML"},
+		{"TOML", TOMLEncoding, "Name = \"John Doe\"\nDate = \"10-10-2016\"\nTitle = \"example TOML\""},
+		{"JSON", JSONEncoding, "{\t\"Name\": \"John Doe\",\n\t\"Date\": \"10-10-2016\",\n\t\"Title\": \"example JSON\"}"},
+	}
+
+	for _, r := range runner {
+		wantMetaData.Title = "example " + r.Name
+
+		d := r.Encoding.NewStreamDecoder(strings.NewReader(testCaseData[r.Name]["file"]))
+
+		haveContent, err := ioutil.ReadAll(d) // the content first
+		if err != nil {
+			t.Errorf(r.Name+"(Read): err: %s", err)
+		}
+
+		if wantContent != string(haveContent) {
+			t.Errorf(r.Name+"(Read): \nwant: %q \nhave: %q", wantContent, string(haveContent))
+		}
+
+		if have := strings.TrimSpace(string(d.Raw())); r.WantRaw != have {
+			t.Errorf(r.Name+"(Raw): \nwant: %q \nhave: %q", r.WantRaw, have)
+		}
+
+		// peek at a field, then decode to the struct
+		peek := map[string]interface{}{}
+		if err := d.Decode(&peek); err != nil || len(peek) != 3 {
+			t.Errorf(r.Name+"(Decode): want 3 keys have: %v %v", peek, err)
+		}
+
+		haveMetaData := testMetaData{}
+		if err := d.Decode(&haveMetaData); err != nil {
+			t.Errorf(r.Name+"(Decode): err: %s", err)
+		}
+
+		if !reflect.DeepEqual(wantMetaData, haveMetaData) {
+			t.Errorf(r.Name+"(Decode): \nwant: %+v \nhave: %+v", wantMetaData, haveMetaData)
+		}
+	}
+
+	d := YAMLEncoding.NewStreamDecoder(strings.NewReader(wantContent))
+	if haveContent, _ := ioutil.ReadAll(d); wantContent != string(haveContent) {
+		t.Errorf("(no frontmatter): \nwant: %q \nhave: %q", wantContent, string(haveContent))
+	}
+
+	if d.Raw() != nil {
+		t.Errorf("(no frontmatter): want nil raw have: %q", d.Raw())
+	}
+}
+
+func TestMust(t *testing.T) {
+	wantMetaData.Title = "example YAML"
+
+	haveMetaData := testMetaData{}
+	haveContent := MustDecodeString(YAMLEncoding, testCaseData["YAML"]["file"], &haveMetaData)
+	if wantContent != string(haveContent) {
+		t.Errorf("(MustDecodeString): \nwant: %q \nhave: %q", wantContent, string(haveContent))
+	}
+
+	if !reflect.DeepEqual(wantMetaData, haveMetaData) {
+		t.Errorf("(MustDecodeString): \nwant: %+v \nhave: %+v", wantMetaData, haveMetaData)
+	}
+
+	if want, have := testCaseData["YAML"]["file"], MustEncodeToString(YAMLEncoding, []byte(wantContent), wantMetaData); want != have {
+		t.Errorf("(MustEncodeToString): \nwant: %q \nhave: %q", want, have)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("(MustDecodeString): want a panic")
+		}
+	}()
+	MustDecodeString(YAMLEncoding, "---\nname: [John, Doe]\n---\n\n"+wantContent, &testMetaData{})
+}
+
+// yamlDoc keeps the YAML frontmatter metadata as it was written, so its
+// anchors and aliases are written out again, along with the values that
+// yaml.Unmarshal reads from it.
+type yamlDoc struct {
+	raw    []byte
+	Values map[string]interface{}
+}
+
+func TestYAMLAnchors(t *testing.T) {
+	wantContent := "This is an example file.\n"
+	wantMatter := "base: &base\n  name: John Doe\nchild: *base\n"
+	file := "---\n" + wantMatter + "---\n\n" + wantContent
+
+	// with a plain map, the anchor is expanded and lost when encoding again
+	haveMap := make(map[string]interface{})
+	haveContent, err := YAMLEncoding.DecodeString(file, &haveMap)
+	if err != nil {
+		t.Fatalf("(map): err: %s", err)
+	}
+
+	want := "---\nbase:\n  name: John Doe\nchild:\n  name: John Doe\n---\n\n" + wantContent
+	if have := YAMLEncoding.EncodeToString(haveContent, haveMap); want != have {
+		t.Errorf("(map): \nwant: %q \nhave: %q", want, have)
+	}
+
+	// with a document type, the values are unmarshaled by yaml.v2 and the
+	// anchor is kept
+	enc := YAMLEncoding.Clone(
+		WithUnmarshalFunc(func(b []byte, v interface{}) error {
+			doc := v.(*yamlDoc)
+			doc.raw = append([]byte(nil), b...)
+			return yaml.Unmarshal(b, &doc.Values)
+		}),
+		WithMarshalFunc(func(v interface{}) ([]byte, error) {
+			return append(v.(*yamlDoc).raw, '\n'), nil
+		}),
+	)
+
+	haveDoc := &yamlDoc{}
+	haveContent, err = enc.DecodeString(file, haveDoc)
+	if err != nil {
+		t.Fatalf("(doc): err: %s", err)
+	}
+
+	wantChild := map[interface{}]interface{}{"name": "John Doe"}
+	if !reflect.DeepEqual(wantChild, haveDoc.Values["child"]) {
+		t.Errorf("(doc): \nwant: %v \nhave: %v", wantChild, haveDoc.Values["child"])
+	}
+
+	if have := enc.EncodeToString(haveContent, haveDoc); file != have {
+		t.Errorf("(doc): \nwant: %q \nhave: %q", file, have)
+	}
+
+	if _, err := enc.DecodeString("---\nchild: *missing\n---\n\n"+wantContent, &yamlDoc{}); err == nil {
+		t.Errorf("(doc): want an error for an unknown alias")
+	}
+}
+
+func TestContentLeadingWhitespace(t *testing.T) {
+	var runner = []struct {
+		Name     string
+		Encoding *Encoding
+		Content  string
+	}{
+		{"YAML", YAMLEncoding, "\tfunc main() {}\n\nThis is an example file.\n"},
+		{"TOML", TOMLEncoding, "\tfunc main() {}\n\nThis is an example file.\n"},
+		{"JSON", JSONEncoding, "\tfunc main() {}\n\nThis is an example file.\n"},
+		{"BlankLines", YAMLEncoding, "\n\n    indented\n"},
+	}
+
+	for _, r := range runner {
+		file := r.Encoding.EncodeToString([]byte(r.Content), map[string]string{"name": "John Doe"})
+
+		haveContent, err := r.Encoding.DecodeString(file, &testMetaData{})
+		if err != nil {
+			t.Errorf(r.Name+"(DecodeString): err: %s", err)
+		}
+
+		if r.Content != string(haveContent) {
+			t.Errorf(r.Name+"(DecodeString): \nwant: %q \nhave: %q", r.Content, string(haveContent))
+		}
+
+		rs, err := r.Encoding.DecodeSeeker(strings.NewReader(file), &testMetaData{})
+		if err != nil {
+			t.Errorf(r.Name+"(DecodeSeeker): err: %s", err)
+		}
+
+		if haveContent, _ := ioutil.ReadAll(rs); r.Content != string(haveContent) {
+			t.Errorf(r.Name+"(DecodeSeeker): \nwant: %q \nhave: %q", r.Content, string(haveContent))
+		}
+	}
+}
+
+// lineDelimiter splits a frontmatter file into whole lines, so a long line is
+// read as a single token.
+func lineDelimiter(delim string) Splitter {
+	return Splitter{
+		Start: delim,
+		End:   delim,
+		SplitFunc: func(data []byte, atEOF bool) (int, []byte, error) {
+			advance, token, err := bufio.ScanLines(data, atEOF)
+			if token != nil && string(token) != delim {
+				token = append(append([]byte(nil), token...), '\n')
+			}
+			return advance, token, err
+		},
+	}
+}
+
+func TestScannerBufferSize(t *testing.T) {
+	wantName := strings.Repeat("a", 200*1024)
+	file := "---\nname: " + wantName + "\n---\n\n" + wantContent
+
+	haveMetaData := testMetaData{}
+	if _, err := YAMLEncoding.DecodeString(file, &haveMetaData); err != nil || wantName != haveMetaData.Name {
+		t.Errorf("(default): want the long name have: %d bytes %v", len(haveMetaData.Name), err)
+	}
+
+	haveEnc := YAMLEncoding.Clone(WithSplitFunc(lineDelimiter))
+	if _, err := haveEnc.DecodeString(file, &testMetaData{}); !errors.Is(err, bufio.ErrTooLong) {
+		t.Errorf("(lines): want: %v have: %v", bufio.ErrTooLong, err)
+	}
+
+	haveMetaData = testMetaData{}
+	haveEnc = haveEnc.Clone(WithScannerBufferSize(256 * 1024))
+	if _, err := haveEnc.DecodeString(file, &haveMetaData); err != nil || wantName != haveMetaData.Name {
+		t.Errorf("(lines): want the long name have: %d bytes %v", len(haveMetaData.Name), err)
+	}
+}
+
+func TestGenericDecodeString(t *testing.T) {
+	wantMetaData.Title = "example YAML"
+
+	haveMetaData, haveContent, err := DecodeString[testMetaData](YAMLEncoding, testCaseData["YAML"]["file"])
+	if err != nil {
+		t.Errorf("err: %s", err)
+	}
+
+	if wantContent != string(haveContent) {
+		t.Errorf("\nwant: %q \nhave: %q", wantContent, string(haveContent))
+	}
+
+	if !reflect.DeepEqual(wantMetaData, haveMetaData) {
+		t.Errorf("\nwant: %+v \nhave: %+v", wantMetaData, haveMetaData)
+	}
+
+	haveMap, _, err := DecodeString[map[string]interface{}](TOMLEncoding, testCaseData["TOML"]["file"])
+	if err != nil || haveMap["Title"] != "example TOML" {
+		t.Errorf("want: %q have: %v %v", "example TOML", haveMap["Title"], err)
+	}
+}
+
+type testDefaultsMetaData struct {
+	Title  string
+	Draft  bool
+	Tags   []string
+	Author struct{ Name, Email string }
+}
+
+func TestGenericDecodeDefaults(t *testing.T) {
+	defaults := testDefaultsMetaData{Title: "Untitled", Draft: true, Tags: []string{"misc"}}
+	defaults.Author.Name = "Staff"
+	defaults.Author.Email = "staff@example.com"
+
+	wantMerged := defaults
+	wantMerged.Draft = false
+	wantMerged.Author.Name = "John Doe"
+
+	var runner = []struct {
+		Name     string
+		Encoding *Encoding
+		File     string
+	}{
+		{"YAML", YAMLEncoding, "---\ndraft: false\nauthor:\n  name: John Doe\n---\n\n" + wantContent},
+		{"TOML", TOMLEncoding, "+++\ndraft = false\n[author]\nname = \"John Doe\"\n+++\n\n" + wantContent},
+		{"JSON", JSONEncoding, "{\n\"draft\": false, \"author\": {\"name\": \"John Doe\"}\n}\n\n" + wantContent},
+	}
+
+	for _, r := range runner {
+		haveMetaData, haveContent, err := Decode(r.Encoding, []byte(r.File), defaults)
+		if err != nil {
+			t.Errorf(r.Name+"(Decode): err: %s", err)
+		}
+
+		if wantContent != string(haveContent) {
+			t.Errorf(r.Name+"(Decode): \nwant: %q \nhave: %q", wantContent, string(haveContent))
+		}
+
+		if !reflect.DeepEqual(wantMerged, haveMetaData) {
+			t.Errorf(r.Name+"(Decode): \nwant: %+v \nhave: %+v", wantMerged, haveMetaData)
+		}
+
+		if defaults.Author.Name != "Staff" || !defaults.Draft {
+			t.Errorf(r.Name+"(Decode): the defaults changed: %+v", defaults)
+		}
+	}
+
+	haveMetaData, haveContent, err := Decode(YAMLEncoding, []byte(wantContent), defaults)
+	if err != nil || wantContent != string(haveContent) || !reflect.DeepEqual(defaults, haveMetaData) {
+		t.Errorf("(none): \nwant: %+v \nhave: %+v %v", defaults, haveMetaData, err)
+	}
+}
+
+func BenchmarkDecodeStringInterface(b *testing.B) {
+	src := testCaseData["YAML"]["file"]
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		v := testMetaData{}
+		YAMLEncoding.DecodeString(src, &v)
+	}
+}
+
+func BenchmarkDecodeStringGeneric(b *testing.B) {
+	src := testCaseData["YAML"]["file"]
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		DecodeString[testMetaData](YAMLEncoding, src)
+	}
+}
+
+// largeFile is a YAML frontmatter file with a 1MB body.
+var largeFile = append([]byte(testCaseData["YAML"]["file"]), bytes.Repeat([]byte("This is a line of content in a large file.\n"), 1024*1024/43)...)
+
+func BenchmarkDecodeLarge(b *testing.B) {
+	v := testMetaData{}
+
+	b.ReportAllocs()
+	b.SetBytes(int64(len(largeFile)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		YAMLEncoding.DecodeReader(bytes.NewReader(largeFile), &v)
+	}
+}
+
+func TestBufferPool(t *testing.T) {
+	var news int32
+	pool := &sync.Pool{New: func() interface{} { atomic.AddInt32(&news, 1); return new(bytes.Buffer) }}
+
+	var runner = []struct {
+		Name     string
+		Encoding *Encoding
+	}{
+		{"YAML", YAMLEncoding},
+		{"TOML", TOMLEncoding},
+		{"JSON", JSONEncoding},
+	}
+
+	for _, r := range runner {
+		wantFile := testCaseData[r.Name]["file"]
+		wantMetaData := testMetaData{}
+		r.Encoding.DecodeString(wantFile, &wantMetaData)
+
+		pooled := r.Encoding.Clone(WithBufferPool(pool))
+		for i := 0; i < 3; i++ {
+			haveMetaData := testMetaData{}
+			haveContent, err := pooled.DecodeString(wantFile, &haveMetaData)
+			if err != nil {
+				t.Errorf(r.Name+"(DecodeString): err: %s", err)
+			}
+
+			if wantContent != string(haveContent) {
+				t.Errorf(r.Name+"(DecodeString): \nwant: %q \nhave: %q", wantContent, string(haveContent))
+			}
+
+			if !reflect.DeepEqual(wantMetaData, haveMetaData) {
+				t.Errorf(r.Name+"(DecodeString): \nwant: %+v \nhave: %+v", wantMetaData, haveMetaData)
+			}
+
+			want := r.Encoding.EncodeToString([]byte(wantContent), wantMetaData)
+			have := pooled.EncodeToString([]byte(wantContent), haveMetaData)
+			if want != have {
+				t.Errorf(r.Name+"(EncodeToString): \nwant: %q \nhave: %q", want, have)
+			}
+		}
+	}
+
+	if atomic.LoadInt32(&news) == 0 {
+		t.Error("want buffers drawn from the pool")
+	}
+}
+
+func BenchmarkBufferPool(b *testing.B) {
+	src := []byte(testCaseData["YAML"]["file"])
+	dst := make([]byte, len(wantContent))
+
+	for _, bb := range []struct {
+		Name     string
+		Encoding *Encoding
+	}{
+		{"Without", YAMLEncoding.Clone()},
+		{"With", YAMLEncoding.Clone(WithBufferPool(&sync.Pool{}))},
+	} {
+		b.Run(bb.Name+"/Decode", func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				v := testMetaData{}
+				bb.Encoding.Decode(dst, src, &v)
+			}
+		})
+
+		b.Run(bb.Name+"/Encode", func(b *testing.B) {
+			out := make([]byte, bb.Encoding.EncodeLen(dst, wantMetaData))
+
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				bb.Encoding.Encode(out, dst, wantMetaData)
+			}
+		})
+	}
+}
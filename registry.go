@@ -0,0 +1,116 @@
+// Copyright 2016 Nika Jones. All rights reserved.
+// Use of this source code is governed by the MIT license.
+// license that can be found in the LICENSE file.
+
+package particle
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// ErrUnknownEncoding is returned (wrapped with the name) by EncodingByName
+// when no encoding is registered for the name.
+var ErrUnknownEncoding = errors.New("particle: unknown encoding")
+
+// extEncodings maps a file extension to the encoding of its frontmatter.
+var extEncodings = struct {
+	sync.RWMutex
+	m map[string]*Encoding
+}{m: map[string]*Encoding{
+	".md":       YAMLEncoding,
+	".markdown": YAMLEncoding,
+	".html":     YAMLEncoding,
+	".yaml":     YAMLEncoding,
+	".yml":      YAMLEncoding,
+	".toml":     TOMLEncoding,
+	".json":     JSONEncoding,
+}}
+
+// RegisterExt sets e as the encoding for files with the extension ext (i.e.
+// ".md" or "md"), replacing any encoding that was set for it before. A nil e
+// removes the extension. Extensions are matched without regard to case.
+func RegisterExt(ext string, e *Encoding) {
+	ext = normalizeExt(ext)
+
+	extEncodings.Lock()
+	defer extEncodings.Unlock()
+
+	if e == nil {
+		delete(extEncodings.m, ext)
+		return
+	}
+	extEncodings.m[ext] = e
+}
+
+// EncodingForExt returns the encoding registered for the file extension ext,
+// as returned by filepath.Ext. When no encoding is registered it returns
+// YAMLEncoding, the most common format, and false. This is a convenience
+// mapping from file names only, the contents of a file are never looked at.
+// The ".md", ".markdown", ".html", ".yaml" and ".yml" extensions are set to
+// YAMLEncoding, ".toml" to TOMLEncoding and ".json" to JSONEncoding.
+func EncodingForExt(ext string) (*Encoding, bool) {
+	extEncodings.RLock()
+	defer extEncodings.RUnlock()
+
+	if e, ok := extEncodings.m[normalizeExt(ext)]; ok {
+		return e, true
+	}
+	return YAMLEncoding, false
+}
+
+// normalizeExt returns ext in lower case with a leading dot.
+func normalizeExt(ext string) string {
+	ext = strings.ToLower(ext)
+	if !strings.HasPrefix(ext, ".") {
+		ext = "." + ext
+	}
+	return ext
+}
+
+// nameEncodings maps a format name to its encoding.
+var nameEncodings = struct {
+	sync.RWMutex
+	m map[string]*Encoding
+}{m: map[string]*Encoding{
+	"yaml":        YAMLEncoding,
+	"toml":        TOMLEncoding,
+	"json":        JSONEncoding,
+	"jsonfenced":  JSONFencedEncoding,
+	"msgpack":     MsgpackEncoding,
+	"htmlmeta":    HTMLMetaEncoding,
+	"htmlcomment": HTMLCommentEncoding,
+}}
+
+// RegisterEncoding sets e as the encoding for the format name (i.e. "yaml"),
+// replacing any encoding that was set for it before. A nil e removes the
+// name. Names are matched without regard to case.
+func RegisterEncoding(name string, e *Encoding) {
+	name = strings.ToLower(name)
+
+	nameEncodings.Lock()
+	defer nameEncodings.Unlock()
+
+	if e == nil {
+		delete(nameEncodings.m, name)
+		return
+	}
+	nameEncodings.m[name] = e
+}
+
+// EncodingByName returns the encoding registered for the format name, so an
+// encoding can be picked by a string from a config file. Each built-in
+// encoding is set under its name (i.e. "yaml", "jsonfenced" or
+// "htmlcomment"), others are added with RegisterEncoding. It returns an error wrapping
+// ErrUnknownEncoding when no encoding is registered for the name.
+func EncodingByName(name string) (*Encoding, error) {
+	nameEncodings.RLock()
+	defer nameEncodings.RUnlock()
+
+	if e, ok := nameEncodings.m[strings.ToLower(name)]; ok {
+		return e, nil
+	}
+	return nil, fmt.Errorf("%w: %q", ErrUnknownEncoding, name)
+}
@@ -0,0 +1,128 @@
+package particle
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestEncodingForExt(t *testing.T) {
+	custom := YAMLEncoding.Clone(WithName("custom"))
+	RegisterExt("MDX", custom)
+	defer RegisterExt(".mdx", nil)
+
+	var runner = []struct {
+		Name     string
+		Ext      string
+		Encoding *Encoding
+		Found    bool
+	}{
+		{"Markdown", ".md", YAMLEncoding, true},
+		{"Upper", ".MD", YAMLEncoding, true},
+		{"TOML", ".toml", TOMLEncoding, true},
+		{"JSON", "json", JSONEncoding, true},
+		{"Registered", ".mdx", custom, true},
+		{"Unknown", ".txt", YAMLEncoding, false},
+		{"None", "", YAMLEncoding, false},
+	}
+
+	for _, r := range runner {
+		have, found := EncodingForExt(r.Ext)
+		if r.Encoding != have || r.Found != found {
+			t.Errorf(r.Name+": want: %q %t have: %q %t", r.Encoding.Name(), r.Found, have.Name(), found)
+		}
+	}
+
+	RegisterExt(".mdx", nil)
+	if _, found := EncodingForExt(".mdx"); found {
+		t.Error("Removed: want the extension to be removed")
+	}
+}
+
+func TestEncodingForExtDecodeFile(t *testing.T) {
+	dir := t.TempDir()
+
+	for _, name := range []string{"YAML", "TOML", "JSON"} {
+		path := filepath.Join(dir, "post."+map[string]string{"YAML": "md", "TOML": "toml", "JSON": "json"}[name])
+		if err := os.WriteFile(path, []byte(testCaseData[name]["file"]), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		e, _ := EncodingForExt(filepath.Ext(path))
+
+		haveMetaData := testMetaData{}
+		haveContent, err := e.DecodeFile(path, &haveMetaData)
+		if err != nil {
+			t.Errorf(name+": err: %s", err)
+		}
+
+		if wantContent != string(haveContent) {
+			t.Errorf(name+": \nwant: %q \nhave: %q", wantContent, string(haveContent))
+		}
+
+		wantMetaData := testMetaData{Name: "John Doe", Date: "10-10-2016", Title: "example " + name}
+		if !reflect.DeepEqual(wantMetaData, haveMetaData) {
+			t.Errorf(name+": \nwant: %+v \nhave: %+v", wantMetaData, haveMetaData)
+		}
+	}
+}
+
+func TestEncodingByName(t *testing.T) {
+	custom := YAMLEncoding.Clone(WithName("custom"))
+	RegisterEncoding("Custom", custom)
+	defer RegisterEncoding("custom", nil)
+
+	var runner = []struct {
+		Name     string
+		Format   string
+		Encoding *Encoding
+	}{
+		{"YAML", "yaml", YAMLEncoding},
+		{"TOML", "TOML", TOMLEncoding},
+		{"JSON", "json", JSONEncoding},
+		{"Msgpack", "msgpack", MsgpackEncoding},
+		{"Registered", "custom", custom},
+		{"Unknown", "xml", nil},
+		{"None", "", nil},
+	}
+
+	for _, r := range runner {
+		have, err := EncodingByName(r.Format)
+		if r.Encoding == nil {
+			if !errors.Is(err, ErrUnknownEncoding) || have != nil {
+				t.Errorf(r.Name+": want: %v have: %v %v", ErrUnknownEncoding, have, err)
+			}
+			continue
+		}
+
+		if err != nil || r.Encoding != have {
+			t.Errorf(r.Name+": want: %q have: %v %v", r.Encoding.Name(), have, err)
+		}
+	}
+
+	RegisterEncoding("custom", nil)
+	if _, err := EncodingByName("custom"); !errors.Is(err, ErrUnknownEncoding) {
+		t.Error("Removed: want the name to be removed")
+	}
+}
+
+func TestEncodingByNameBuiltIn(t *testing.T) {
+	builtIn := []*Encoding{
+		YAMLEncoding,
+		TOMLEncoding,
+		JSONEncoding,
+		JSONFencedEncoding,
+		MsgpackEncoding,
+		HTMLMetaEncoding,
+		HTMLCommentEncoding,
+	}
+
+	for _, e := range builtIn {
+		have, err := EncodingByName(e.Name())
+		if err != nil || e != have {
+			t.Errorf(e.Name()+": want: %q have: %v %v", e.Name(), have, err)
+		}
+	}
+}
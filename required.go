@@ -0,0 +1,68 @@
+// Copyright 2016 Nika Jones. All rights reserved.
+// Use of this source code is governed by the MIT license.
+// license that can be found in the LICENSE file.
+
+package particle
+
+import (
+	"reflect"
+	"strings"
+)
+
+// RequiredError is returned (as the Err of a *FrontmatterError) when the
+// frontmatter metadata is missing fields that are tagged as required, i.e.
+// with `frontmatter:"title,required"`.
+type RequiredError struct {
+	Fields []string // the names of all of the missing fields
+}
+
+func (e *RequiredError) Error() string {
+	return "particle: missing required frontmatter fields: " + strings.Join(e.Fields, ", ")
+}
+
+// checkRequired returns a *RequiredError listing the fields of the struct v
+// points to that are tagged as required, but are still the zero value after
+// the frontmatter metadata f is unmarshaled, and weren't keys in f. The name
+// of a field is the name in its frontmatter tag, or else its metadata key.
+// Only the top level fields are checked.
+func (e *Encoding) checkRequired(f []byte, v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.Elem().Kind() != reflect.Struct {
+		return nil
+	}
+	rv = rv.Elem()
+
+	var keys map[string]interface{}
+	var missing []string
+	for i := 0; i < rv.NumField(); i++ {
+		field := rv.Type().Field(i)
+		tag := strings.Split(field.Tag.Get("frontmatter"), ",")
+		if !hasTagOption(tag[1:], "required") || !rv.Field(i).IsZero() {
+			continue
+		}
+
+		key, ok := fieldKey(field, e.tag())
+		if !ok {
+			continue
+		}
+
+		if keys == nil {
+			keys = make(map[string]interface{})
+			e.unmarshalFunc(f, &keys) // the zero value may have been set
+		}
+		if _, ok := e.lookupKey(keys, key); ok {
+			continue
+		}
+
+		name := tag[0]
+		if name == "" {
+			name = key
+		}
+		missing = append(missing, name)
+	}
+
+	if len(missing) > 0 {
+		return &RequiredError{Fields: missing}
+	}
+	return nil
+}
@@ -0,0 +1,67 @@
+package particle
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+type requiredMetaData struct {
+	Name  string
+	Title string `frontmatter:"title,required"`
+	Date  string `frontmatter:",required"`
+	Draft bool   `frontmatter:"draft,required"`
+}
+
+func TestRequired(t *testing.T) {
+	var runner = []struct {
+		Name        string
+		Encoding    *Encoding
+		File        string
+		WantMissing []string
+	}{
+		{"Neither", YAMLEncoding, "---\nname: John Doe\ndraft: true\n---\n\n" + wantContent, []string{"title", "date"}},
+		{"All", YAMLEncoding, "---\ntitle: example\ndate: 10-10-2016\ndraft: true\n---\n\n" + wantContent, nil},
+		{"ZeroValue", YAMLEncoding, "---\ntitle: example\ndate: 10-10-2016\ndraft: false\n---\n\n" + wantContent, nil},
+		{"Empty", YAMLEncoding, "---\n---\n\n" + wantContent, []string{"title", "date", "draft"}},
+		{"TOML", TOMLEncoding, "+++\nname = \"John Doe\"\ndraft = false\n+++\n\n" + wantContent, []string{"title", "date"}},
+		{"JSON", JSONEncoding, "{\n\t\"title\": \"example\"\n}\n\n" + wantContent, []string{"date", "draft"}},
+		{"JSONCase", JSONEncoding, "{\n\t\"Date\": \"\",\n\t\"Draft\": false\n}\n\n" + wantContent, []string{"title"}},
+		{"TOMLCase", TOMLEncoding, "+++\nDate = \"\"\nDraft = false\n+++\n\n" + wantContent, []string{"title"}},
+		{"Lenient", YAMLEncoding.Clone(WithLenientFallback()), "---\nname: John Doe\ndraft: true\n---\n\n" + wantContent, []string{"title", "date"}},
+	}
+
+	for _, r := range runner {
+		haveContent, err := r.Encoding.DecodeString(r.File, &requiredMetaData{})
+		if wantContent != string(haveContent) {
+			t.Errorf(r.Name+": \nwant: %q \nhave: %q", wantContent, string(haveContent))
+		}
+
+		if r.WantMissing == nil {
+			if err != nil {
+				t.Errorf(r.Name+": err: %s", err)
+			}
+			continue
+		}
+
+		var reqErr *RequiredError
+		if !errors.As(err, &reqErr) {
+			t.Errorf(r.Name+": want a *RequiredError have: %v", err)
+			continue
+		}
+
+		if !reflect.DeepEqual(r.WantMissing, reqErr.Fields) {
+			t.Errorf(r.Name+": \nwant: %q \nhave: %q", r.WantMissing, reqErr.Fields)
+		}
+	}
+
+	// a map has no required fields
+	if _, err := YAMLEncoding.DecodeString("---\nname: John Doe\n---\n", &map[string]interface{}{}); err != nil {
+		t.Errorf("Map: err: %s", err)
+	}
+
+	_, err := YAMLEncoding.DecodeString("---\nname: John Doe\n---\n", &requiredMetaData{})
+	if want := "particle: decode yaml frontmatter: particle: missing required frontmatter fields: title, date, draft"; err == nil || want != err.Error() {
+		t.Errorf("Error: \nwant: %q \nhave: %v", want, err)
+	}
+}
@@ -0,0 +1,97 @@
+// Copyright 2016 Nika Jones. All rights reserved.
+// Use of this source code is governed by the MIT license.
+// license that can be found in the LICENSE file.
+
+package particle
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrRoundTrip is returned (wrapped with a diff) by VerifyRoundTrip when the
+// frontmatter metadata changes when it is decoded and encoded again.
+var ErrRoundTrip = errors.New("particle: frontmatter does not round trip")
+
+// VerifyRoundTrip decodes the frontmatter metadata of src to a
+// map[string]interface{}, encodes it again, and returns an ErrRoundTrip
+// error if the result isn't the same as the metadata in src. The error holds
+// a line diff, the lines of src start with "-" and the encoded lines with
+// "+". Keys that are reordered, values that are quoted differently and
+// comments that are dropped all make the metadata differ. The content and
+// the delimiter lines are not compared. A src without frontmatter round
+// trips.
+func (e *Encoding) VerifyRoundTrip(src []byte) error {
+	e = e.fenceFor(src)
+	src = e.trimBOM(src)
+
+	var block []byte
+	if e.position == FooterPosition {
+		block, _ = e.splitFooter(src)
+	} else if loc := e.locate(src); loc != (Location{}) {
+		block = src[loc.Start:loc.End]
+	}
+
+	if len(bytes.TrimSpace(block)) == 0 {
+		return nil // there is no metadata
+	}
+
+	m := make(map[string]interface{})
+	if err := e.unmarshal(block, &m); err != nil {
+		return err
+	}
+
+	f, err := e.marshal(m)
+	if err != nil {
+		return err
+	}
+
+	want, have := strings.TrimRight(string(block), "\n"), strings.TrimRight(string(f), "\n")
+	if want != have {
+		return fmt.Errorf("%w:\n%s", ErrRoundTrip, lineDiff(want, have))
+	}
+	return nil
+}
+
+// lineDiff returns the lines of a and b that differ, the lines of a start
+// with "-", the lines of b with "+", and the lines in both with a space.
+func lineDiff(a, b string) string {
+	x, y := strings.Split(a, "\n"), strings.Split(b, "\n")
+
+	// the length of the longest common subsequence of x[i:] and y[j:]
+	lcs := make([][]int, len(x)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(y)+1)
+	}
+	for i := len(x) - 1; i >= 0; i-- {
+		for j := len(y) - 1; j >= 0; j-- {
+			switch {
+			case x[i] == y[j]:
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			case lcs[i+1][j] >= lcs[i][j+1]:
+				lcs[i][j] = lcs[i+1][j]
+			default:
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	var buf strings.Builder
+	i, j := 0, 0
+	for i < len(x) || j < len(y) {
+		switch {
+		case i < len(x) && j < len(y) && x[i] == y[j]:
+			buf.WriteString("  " + x[i] + "\n")
+			i, j = i+1, j+1
+		case j == len(y) || (i < len(x) && lcs[i+1][j] >= lcs[i][j+1]):
+			buf.WriteString("- " + x[i] + "\n")
+			i++
+		default:
+			buf.WriteString("+ " + y[j] + "\n")
+			j++
+		}
+	}
+	return buf.String()
+}
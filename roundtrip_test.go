@@ -0,0 +1,49 @@
+package particle
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestVerifyRoundTrip(t *testing.T) {
+	var runner = []struct {
+		Name     string
+		Encoding *Encoding
+		File     string
+		WantDiff string
+	}{
+		{"Sorted", YAMLEncoding, "---\ndate: 10-10-2016\nname: John Doe\n---\n\n" + wantContent, ""},
+		{"Reordered", YAMLEncoding, testCaseData["YAML"]["file"], "- name: John Doe\n  date: 10-10-2016\n+ name: John Doe\n  title: example YAML\n"},
+		{"Quoted", YAMLEncoding, "---\nname: \"John Doe\"\n---\n\n" + wantContent, "- name: \"John Doe\"\n+ name: John Doe\n"},
+		{"Comment", YAMLEncoding, "---\n# author\nname: John Doe\n---\n\n" + wantContent, "- # author\n  name: John Doe\n"},
+		{"TOML", TOMLEncoding, "+++\ndate = \"10-10-2016\"\nname = \"John Doe\"\n+++\n\n" + wantContent, ""},
+		{"JSON", JSONEncoding, "{\n\t\"date\": \"10-10-2016\",\n\t\"name\": \"John Doe\"\n}\n\n" + wantContent, ""},
+		{"JSONIndent", JSONEncoding, "{\n  \"name\": \"John Doe\"\n}\n\n" + wantContent, "  {\n-   \"name\": \"John Doe\"\n+ \t\"name\": \"John Doe\"\n  }\n"},
+		{"Footer", YAMLEncoding.Clone(WithPosition(FooterPosition)), wantContent + "\n---\nname: John Doe\n---\n", ""},
+		{"NoFrontmatter", YAMLEncoding, wantContent, ""},
+		{"Empty", YAMLEncoding, "---\n---\n\n" + wantContent, ""},
+	}
+
+	for _, r := range runner {
+		err := r.Encoding.VerifyRoundTrip([]byte(r.File))
+		if r.WantDiff == "" {
+			if err != nil {
+				t.Errorf(r.Name+": err: %s", err)
+			}
+			continue
+		}
+
+		if !errors.Is(err, ErrRoundTrip) {
+			t.Errorf(r.Name+": want: %v have: %v", ErrRoundTrip, err)
+			continue
+		}
+
+		if want := ErrRoundTrip.Error() + ":\n" + r.WantDiff; want != err.Error() {
+			t.Errorf(r.Name+": \nwant: %q \nhave: %q", want, err.Error())
+		}
+	}
+
+	if err := YAMLEncoding.VerifyRoundTrip([]byte("---\nname: [\n---\n")); err == nil || errors.Is(err, ErrRoundTrip) {
+		t.Errorf("Invalid: want an unmarshal error have: %v", err)
+	}
+}
@@ -0,0 +1,128 @@
+// Copyright 2016 Nika Jones. All rights reserved.
+// Use of this source code is governed by the MIT license.
+// license that can be found in the LICENSE file.
+
+package particle
+
+import (
+	"bufio"
+	"io"
+)
+
+// readerScanner scans the tokens of a split func straight out of the buffer
+// of a *bufio.Reader, the same as a bufio.Scanner would, but without a
+// buffer of its own. Only a token that is longer than the buffer of the
+// reader is collected in buf. Bytes are only taken from the reader as the
+// split func consumes them, so what isn't scanned is left in the reader.
+type readerScanner struct {
+	br    *bufio.Reader
+	split bufio.SplitFunc
+	max   int
+
+	buf []byte // a token that is longer than the buffer of br
+	tok []byte
+	eof bool
+	err error
+}
+
+// Scan advances to the next token, which is then available through the
+// Bytes or Text methods. It returns false when the scan stops, either by
+// reaching the end of the input or an error.
+func (s *readerScanner) Scan() bool {
+	for s.err == nil {
+		data := s.buf
+		if len(data) == 0 {
+			data, _ = s.br.Peek(s.br.Buffered())
+		}
+
+		if len(data) > 0 || s.eof {
+			advance, token, err := s.split(data, s.eof)
+			switch {
+			case err == bufio.ErrFinalToken:
+				s.tok, s.err = token, io.EOF
+				return token != nil
+			case err != nil:
+				s.err = err
+				return false
+			case advance < 0:
+				s.err = bufio.ErrNegativeAdvance
+				return false
+			case advance > len(data):
+				s.err = bufio.ErrAdvanceTooFar
+				return false
+			}
+
+			// the token stays in the buffer until the next read of br
+			if len(s.buf) > 0 {
+				s.buf = s.buf[advance:]
+			} else {
+				s.br.Discard(advance)
+			}
+
+			if token != nil {
+				s.tok = token
+				return true
+			}
+			if advance > 0 {
+				continue
+			}
+			if s.eof {
+				s.err = io.EOF
+				return false
+			}
+		}
+
+		if len(data) >= s.max {
+			s.err = bufio.ErrTooLong
+			return false
+		}
+		s.fill()
+	}
+	return false
+}
+
+// fill reads more of the input, into the buffer of br while there is room
+// left in it, otherwise into buf.
+func (s *readerScanner) fill() {
+	if len(s.buf) == 0 && s.br.Buffered() < s.br.Size() {
+		s.peek(s.br.Buffered() + 1)
+		return
+	}
+
+	if s.br.Buffered() == 0 {
+		if s.peek(1); s.eof || s.err != nil {
+			return
+		}
+	}
+	p, _ := s.br.Peek(s.br.Buffered())
+	s.buf = append(s.buf, p...)
+	s.br.Discard(len(p))
+}
+
+// peek fills the buffer of br with n bytes, noting the end of the input.
+func (s *readerScanner) peek(n int) {
+	switch _, err := s.br.Peek(n); err {
+	case nil:
+	case io.EOF:
+		s.eof = true
+	default:
+		s.err = err
+	}
+}
+
+// Bytes returns the most recent token generated by a call to Scan. The
+// underlying array may point to data that will be overwritten by a
+// subsequent call to Scan.
+func (s *readerScanner) Bytes() []byte { return s.tok }
+
+// Text returns the most recent token generated by a call to Scan as a
+// string.
+func (s *readerScanner) Text() string { return string(s.tok) }
+
+// Err returns the first non-EOF error that was encountered by the scanner.
+func (s *readerScanner) Err() error {
+	if s.err == io.EOF {
+		return nil
+	}
+	return s.err
+}
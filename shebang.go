@@ -0,0 +1,89 @@
+// Copyright 2016 Nika Jones. All rights reserved.
+// Use of this source code is governed by the MIT license.
+// license that can be found in the LICENSE file.
+
+package particle
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+)
+
+// shebang is the start of the interpreter line of an executable script.
+var shebang = []byte("#!")
+
+// WithAllowShebang lets a frontmatter block follow a leading "#!" line (i.e.
+// "#!/usr/bin/env python"), so frontmatter can be used in executable scripts.
+// When decoding, the "#!" line is skipped before looking for the opening
+// delimiter, and is kept as the first line of the content, so the script
+// still runs. Only a first line is skipped, and only for the HeaderPosition.
+// StripFrontmatter copies the content to keep the line, and DecodeReaderAt
+// returns the offset of the content after the block, which doesn't have it.
+func WithAllowShebang() EncodingOptionFunc {
+	return func(e *Encoding) error {
+		e.allowShebang = true
+		return nil
+	}
+}
+
+// WithStripShebang is WithAllowShebang, but the "#!" line is dropped from
+// the content along with the frontmatter block, the same as the preamble
+// lines. The line is kept when no block follows it.
+func WithStripShebang() EncodingOptionFunc {
+	return func(e *Encoding) error {
+		e.allowShebang, e.stripShebang = true, true
+		return nil
+	}
+}
+
+// keepShebang reports whether a leading "#!" line is kept in the content.
+func (e *Encoding) keepShebang() bool {
+	return e.allowShebang && !e.stripShebang && e.position == HeaderPosition && !e.wholeDocument
+}
+
+// shebangLen returns the length of the leading "#!" line of b, with its line
+// ending, or 0 when e doesn't allow one or b doesn't start with one.
+func (e *Encoding) shebangLen(b []byte) int {
+	if !e.allowShebang || !bytes.HasPrefix(b, shebang) {
+		return 0
+	}
+	if i := bytes.IndexByte(b, '\n'); i >= 0 {
+		return i + 1
+	}
+	return 0 // a lone "#!" line has no block after it
+}
+
+// takeShebang reads the leading "#!" line from r, returning it and a reader
+// of the rest of r. The line is nil when r doesn't start with one.
+func (e *Encoding) takeShebang(r io.Reader) ([]byte, io.Reader) {
+	br, ok := r.(*bufio.Reader)
+	if !ok {
+		br = bufio.NewReader(r)
+	}
+
+	if p, _ := br.Peek(len(shebang)); !bytes.Equal(p, shebang) {
+		return nil, br
+	}
+
+	line, err := br.ReadBytes('\n')
+	if err != nil {
+		return nil, io.MultiReader(bytes.NewReader(line), errReader{err})
+	}
+	return line, br
+}
+
+// shebangReader reads the "#!" line, and then the content from r.
+type shebangReader struct {
+	line []byte
+	r    io.Reader
+}
+
+func (s *shebangReader) Read(p []byte) (int, error) {
+	if len(s.line) > 0 {
+		n := copy(p, s.line)
+		s.line = s.line[n:]
+		return n, nil
+	}
+	return s.r.Read(p)
+}
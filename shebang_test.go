@@ -0,0 +1,65 @@
+package particle
+
+import (
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+type testScriptMetaData struct {
+	Title string
+}
+
+func TestShebang(t *testing.T) {
+	script := "echo \"$0\"\n"
+	file := "#!/usr/bin/env sh\n---\ntitle: example\n---\n\n" + script
+
+	var runner = []struct {
+		Name        string
+		Encoding    *Encoding
+		File        string
+		WantContent string
+		WantTitle   string
+	}{
+		{"Without", YAMLEncoding, file, file, ""},
+		{"Allow", YAMLEncoding.Clone(WithAllowShebang()), file, "#!/usr/bin/env sh\n" + script, "example"},
+		{"Strip", YAMLEncoding.Clone(WithStripShebang()), file, script, "example"},
+		{"AllowNoBlock", YAMLEncoding.Clone(WithAllowShebang()), "#!/usr/bin/env sh\n" + script, "#!/usr/bin/env sh\n" + script, ""},
+		{"StripNoBlock", YAMLEncoding.Clone(WithStripShebang()), "#!/usr/bin/env sh\n" + script, "#!/usr/bin/env sh\n" + script, ""},
+		{"AllowNoShebang", YAMLEncoding.Clone(WithAllowShebang()), "---\ntitle: example\n---\n\n" + script, script, "example"},
+	}
+
+	for _, r := range runner {
+		decoders := []struct {
+			Name   string
+			Decode func(v *testScriptMetaData) ([]byte, error)
+		}{
+			{"DecodeString", func(v *testScriptMetaData) ([]byte, error) { return r.Encoding.DecodeString(r.File, v) }},
+			{"DecodeReader", func(v *testScriptMetaData) ([]byte, error) {
+				return r.Encoding.DecodeReader(iotest.OneByteReader(strings.NewReader(r.File)), v)
+			}},
+			{"StripFrontmatter", func(v *testScriptMetaData) ([]byte, error) {
+				if err := r.Encoding.Metadata([]byte(r.File), v); err != nil {
+					return nil, err
+				}
+				return r.Encoding.StripFrontmatter([]byte(r.File))
+			}},
+		}
+
+		for _, d := range decoders {
+			var haveMetaData testScriptMetaData
+			haveContent, err := d.Decode(&haveMetaData)
+			if err != nil {
+				t.Errorf(r.Name+"("+d.Name+"): err: %s", err)
+			}
+
+			if r.WantContent != string(haveContent) {
+				t.Errorf(r.Name+"("+d.Name+"): \nwant: %q \nhave: %q", r.WantContent, string(haveContent))
+			}
+
+			if r.WantTitle != haveMetaData.Title {
+				t.Errorf(r.Name+"("+d.Name+"): \nwant: %q \nhave: %q", r.WantTitle, haveMetaData.Title)
+			}
+		}
+	}
+}
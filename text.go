@@ -0,0 +1,250 @@
+// Copyright 2016 Nika Jones. All rights reserved.
+// Use of this source code is governed by the MIT license.
+// license that can be found in the LICENSE file.
+
+package particle
+
+import (
+	"encoding"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+var (
+	textMarshalerType   = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+// textMarshal returns v with every value that implements
+// encoding.TextMarshaler replaced by its text, so a marshal func that doesn't
+// know about the interface writes them as strings. Structs, maps and slices
+// that hold such values are copied to maps and slices of interface{} values,
+// a struct field is keyed the same as in structKeys.
+func (e *Encoding) textMarshal(v interface{}) (interface{}, error) {
+	return e.textValue(reflect.ValueOf(v))
+}
+
+func (e *Encoding) textValue(rv reflect.Value) (interface{}, error) {
+	if !rv.IsValid() {
+		return nil, nil
+	}
+
+	if rv.CanAddr() && !rv.Type().Implements(textMarshalerType) && reflect.PtrTo(rv.Type()).Implements(textMarshalerType) {
+		rv = rv.Addr() // MarshalText has a pointer receiver
+	}
+
+	if rv.Type().Implements(textMarshalerType) {
+		if rv.Kind() == reflect.Ptr && rv.IsNil() {
+			return nil, nil
+		}
+		b, err := rv.Interface().(encoding.TextMarshaler).MarshalText()
+		return string(b), err
+	}
+
+	if !hasText(rv.Type(), textMarshalerType, nil) {
+		return rv.Interface(), nil // nothing to replace
+	}
+
+	switch rv.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if rv.IsNil() {
+			return nil, nil
+		}
+		return e.textValue(rv.Elem())
+	case reflect.Struct:
+		m := make(map[string]interface{})
+		for i := 0; i < rv.NumField(); i++ {
+			key, ok := fieldKey(rv.Type().Field(i), e.tag())
+			if !ok {
+				continue
+			}
+
+			fv, err := e.textValue(rv.Field(i))
+			if err != nil {
+				return nil, err
+			}
+			m[key] = fv
+		}
+		return m, nil
+	case reflect.Map:
+		m := make(map[string]interface{}, rv.Len())
+		for _, k := range rv.MapKeys() {
+			fv, err := e.textValue(rv.MapIndex(k))
+			if err != nil {
+				return nil, err
+			}
+			m[fmt.Sprint(k.Interface())] = fv
+		}
+		return m, nil
+	case reflect.Slice, reflect.Array:
+		s := make([]interface{}, rv.Len())
+		for i := range s {
+			fv, err := e.textValue(rv.Index(i))
+			if err != nil {
+				return nil, err
+			}
+			s[i] = fv
+		}
+		return s, nil
+	}
+	return rv.Interface(), nil
+}
+
+// textUnmarshal unmarshals the frontmatter metadata f to interface v with fn,
+// calling UnmarshalText for the struct fields of v (and of its nested
+// structs) that implement encoding.TextUnmarshaler. Those keys are taken out
+// of the metadata before the rest of it is marshaled again and handed to fn.
+func (e *Encoding) textUnmarshal(f []byte, v interface{}, fn UnmarshalFunc) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() || !hasText(rv.Type(), textUnmarshalerType, nil) {
+		return fn(f, v)
+	}
+
+	m := make(map[string]interface{})
+	if err := e.unmarshalFunc(f, &m); err != nil {
+		return err
+	}
+
+	var texts []func() error
+	e.takeTexts(m, rv.Elem(), &texts)
+
+	f, err := e.marshalValue(m)
+	if err != nil {
+		return err
+	}
+
+	if err := fn(f, v); err != nil {
+		return err
+	}
+
+	for _, text := range texts {
+		if err := text(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// takeTexts removes the string values of m that belong to a field of the
+// struct rv that implements encoding.TextUnmarshaler, and adds a func that
+// unmarshals the value to the field to texts.
+func (e *Encoding) takeTexts(m map[string]interface{}, rv reflect.Value, texts *[]func() error) {
+	if rv.Kind() != reflect.Struct {
+		return
+	}
+
+	for i := 0; i < rv.NumField(); i++ {
+		key, ok := fieldKey(rv.Type().Field(i), e.tag())
+		if !ok {
+			continue
+		}
+
+		val, ok := m[key]
+		if !ok {
+			continue
+		}
+
+		field := rv.Field(i)
+		if reflect.PtrTo(field.Type()).Implements(textUnmarshalerType) {
+			if s, ok := val.(string); ok {
+				u := field.Addr().Interface().(encoding.TextUnmarshaler)
+				*texts = append(*texts, func() error { return u.UnmarshalText([]byte(s)) })
+				delete(m, key)
+			}
+			continue
+		}
+
+		if nested, ok := stringMap(val); ok && field.Kind() == reflect.Struct {
+			e.takeTexts(nested, field, texts)
+			m[key] = nested
+		}
+	}
+}
+
+// hasText reports whether t, or any type that t holds, implements iface
+// either directly or through a pointer. An interface type may hold a
+// encoding.TextMarshaler, so it has text when marshaling.
+func hasText(t reflect.Type, iface reflect.Type, seen map[reflect.Type]bool) bool {
+	if t.Implements(iface) || reflect.PtrTo(t).Implements(iface) {
+		return true
+	}
+
+	if t.Kind() == reflect.Interface {
+		return iface == textMarshalerType
+	}
+
+	if seen == nil {
+		seen = make(map[reflect.Type]bool)
+	}
+	if seen[t] {
+		return false
+	}
+	seen[t] = true
+
+	switch t.Kind() {
+	case reflect.Ptr, reflect.Slice, reflect.Array, reflect.Map:
+		return hasText(t.Elem(), iface, seen)
+	case reflect.Struct:
+		for i := 0; i < t.NumField(); i++ {
+			if _, ok := fieldKey(t.Field(i), ""); ok && hasText(t.Field(i).Type, iface, seen) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// fieldKey returns the metadata key of the struct field, the name in its tag
+// for the format, or else its lower cased name. It returns false for
+// unexported fields and fields that are skipped with a "-" tag.
+func fieldKey(field reflect.StructField, tag string) (string, bool) {
+	if field.PkgPath != "" {
+		return "", false
+	}
+
+	name := strings.Split(field.Tag.Get(tag), ",")[0]
+	switch name {
+	case "-":
+		return "", false
+	case "":
+		return strings.ToLower(field.Name), true
+	}
+	return name, true
+}
+
+// lookupKey returns the key of m that the metadata key of a struct field is
+// unmarshaled from: the key itself, or else, for the formats that match keys
+// to fields without regard to case (as encoding/json and BurntSushi/toml
+// do), the first key in sorted order that is the same without regard to case.
+func (e *Encoding) lookupKey(m map[string]interface{}, key string) (string, bool) {
+	if _, ok := m[key]; ok {
+		return key, true
+	}
+	if !e.foldsKeys() {
+		return "", false
+	}
+
+	var folded []string
+	for k := range m {
+		if strings.EqualFold(k, key) {
+			folded = append(folded, k)
+		}
+	}
+	if len(folded) == 0 {
+		return "", false
+	}
+	sort.Strings(folded)
+	return folded[0], true
+}
+
+// foldsKeys reports whether metadata keys are matched to struct fields without
+// regard to case when e unmarshals.
+func (e *Encoding) foldsKeys() bool {
+	switch e.tag() {
+	case "json", "toml":
+		return true
+	}
+	return e.caseInsensitiveKeys
+}
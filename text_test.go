@@ -0,0 +1,130 @@
+package particle
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+type testDate struct{ Year, Month, Day int }
+
+func (d testDate) MarshalText() ([]byte, error) {
+	return []byte(fmt.Sprintf("%04d-%02d-%02d", d.Year, d.Month, d.Day)), nil
+}
+
+func (d *testDate) UnmarshalText(b []byte) error {
+	_, err := fmt.Sscanf(string(b), "%04d-%02d-%02d", &d.Year, &d.Month, &d.Day)
+	return err
+}
+
+type testDateMetaData struct {
+	Name string
+	Date testDate
+}
+
+// kvMarshal is a marshal func for a "key: value" format that doesn't know
+// about encoding.TextMarshaler, it can only write a map of strings.
+func kvMarshal(v interface{}) ([]byte, error) {
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("kv: can't marshal %T", v)
+	}
+
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	buf := new(bytes.Buffer)
+	for _, k := range keys {
+		s, ok := m[k].(string)
+		if !ok {
+			return nil, fmt.Errorf("kv: can't marshal %T", m[k])
+		}
+		fmt.Fprintf(buf, "%s: %s\n", k, s)
+	}
+	return buf.Bytes(), nil
+}
+
+// kvUnmarshal is the unmarshal func for kvMarshal, it can only set a map or
+// the string fields of a struct.
+func kvUnmarshal(data []byte, v interface{}) error {
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		kv := strings.SplitN(line, ": ", 2)
+		if len(kv) != 2 {
+			continue
+		}
+
+		if m, ok := v.(*map[string]interface{}); ok {
+			(*m)[kv[0]] = kv[1]
+			continue
+		}
+
+		rv := reflect.ValueOf(v).Elem()
+		field := rv.FieldByNameFunc(func(name string) bool { return strings.ToLower(name) == kv[0] })
+		if field.Kind() != reflect.String {
+			return errors.New("kv: can't unmarshal " + kv[0])
+		}
+		field.SetString(kv[1])
+	}
+	return nil
+}
+
+func TestTextMarshalers(t *testing.T) {
+	kvEncoding := MustNewEncoding(
+		WithName("kv"),
+		WithDelimiter(YAMLDelimiter),
+		WithMarshalFunc(kvMarshal),
+		WithUnmarshalFunc(kvUnmarshal),
+	)
+
+	wantFile := "---\ndate: 2016-10-10\nname: John Doe\n---\n\n" + wantContent
+	wantMetaData := testDateMetaData{Name: "John Doe", Date: testDate{2016, 10, 10}}
+
+	if _, err := kvEncoding.AppendEncode(nil, []byte(wantContent), wantMetaData); err == nil {
+		t.Error("(without): want an encode error")
+	}
+
+	if _, err := kvEncoding.DecodeString(wantFile, &testDateMetaData{}); err == nil {
+		t.Error("(without): want a decode error")
+	}
+
+	var runner = []struct {
+		Name     string
+		Encoding *Encoding
+		File     string
+	}{
+		{"KV", kvEncoding.Clone(WithTextMarshalers()), wantFile},
+		{"YAML", YAMLEncoding.Clone(WithTextMarshalers()), strings.Replace(wantFile, "2016-10-10", `"2016-10-10"`, 1)},
+	}
+
+	for _, r := range runner {
+		haveFile, err := r.Encoding.AppendEncode(nil, []byte(wantContent), wantMetaData)
+		if err != nil {
+			t.Errorf(r.Name+"(AppendEncode): err: %s", err)
+		}
+
+		if r.File != string(haveFile) {
+			t.Errorf(r.Name+"(AppendEncode): \nwant: %q \nhave: %q", r.File, string(haveFile))
+		}
+
+		haveMetaData := testDateMetaData{}
+		haveContent, err := r.Encoding.DecodeString(r.File, &haveMetaData)
+		if err != nil {
+			t.Errorf(r.Name+"(DecodeString): err: %s", err)
+		}
+
+		if wantContent != string(haveContent) {
+			t.Errorf(r.Name+"(DecodeString): \nwant: %q \nhave: %q", wantContent, string(haveContent))
+		}
+
+		if !reflect.DeepEqual(wantMetaData, haveMetaData) {
+			t.Errorf(r.Name+"(DecodeString): \nwant: %+v \nhave: %+v", wantMetaData, haveMetaData)
+		}
+	}
+}
@@ -0,0 +1,136 @@
+// Copyright 2016 Nika Jones. All rights reserved.
+// Use of this source code is governed by the MIT license.
+// license that can be found in the LICENSE file.
+
+package particle
+
+import (
+	"reflect"
+	"time"
+)
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// timeUnmarshal unmarshals the frontmatter metadata f to interface v with fn,
+// parsing the string values of the time.Time struct fields of v (and of its
+// nested structs) with the time layouts of e. Those keys are taken out of the
+// metadata before the rest of it is marshaled again and handed to fn.
+func (e *Encoding) timeUnmarshal(f []byte, v interface{}, fn UnmarshalFunc) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() || !hasTime(rv.Type().Elem(), nil) {
+		return fn(f, v)
+	}
+
+	m := make(map[string]interface{})
+	if err := e.unmarshalFunc(f, &m); err != nil {
+		return err
+	}
+
+	var times []func()
+	e.takeTimes(m, rv.Elem(), &times)
+	if len(times) == 0 {
+		return fn(f, v)
+	}
+
+	f, err := e.marshalValue(m)
+	if err != nil {
+		return err
+	}
+
+	if err := fn(f, v); err != nil {
+		return err
+	}
+
+	for _, set := range times {
+		set()
+	}
+	return nil
+}
+
+// takeTimes removes the string values of m that belong to a time.Time field
+// of the struct rv, and that parse with a time layout of e, and adds a func
+// that sets the field to the parsed time to times. The keys are matched to
+// the fields as the unmarshal func of e matches them.
+func (e *Encoding) takeTimes(m map[string]interface{}, rv reflect.Value, times *[]func()) {
+	if rv.Kind() != reflect.Struct {
+		return
+	}
+
+	for i := 0; i < rv.NumField(); i++ {
+		key, ok := fieldKey(rv.Type().Field(i), e.tag())
+		if !ok {
+			continue
+		}
+
+		key, ok = e.lookupKey(m, key)
+		if !ok {
+			continue
+		}
+		val := m[key]
+
+		field := rv.Field(i)
+		if field.Type() == timeType || (field.Kind() == reflect.Ptr && field.Type().Elem() == timeType) {
+			s, ok := val.(string)
+			if !ok {
+				continue
+			}
+
+			if t, ok := e.parseTime(s); ok {
+				*times = append(*times, func() { setTime(field, t) })
+				delete(m, key)
+			}
+			continue
+		}
+
+		if nested, ok := stringMap(val); ok && field.Kind() == reflect.Struct {
+			e.takeTimes(nested, field, times)
+			m[key] = nested
+		}
+	}
+}
+
+// parseTime parses s with the first time layout of e that matches.
+func (e *Encoding) parseTime(s string) (time.Time, bool) {
+	for _, layout := range e.timeLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// setTime sets the time.Time or *time.Time field to t.
+func setTime(field reflect.Value, t time.Time) {
+	if field.Kind() == reflect.Ptr {
+		field.Set(reflect.ValueOf(&t))
+		return
+	}
+	field.Set(reflect.ValueOf(t))
+}
+
+// hasTime reports whether the struct t, or a struct that it holds in a
+// field, has a time.Time or *time.Time field.
+func hasTime(t reflect.Type, seen map[reflect.Type]bool) bool {
+	if t.Kind() != reflect.Struct || t == timeType {
+		return false
+	}
+
+	if seen == nil {
+		seen = make(map[reflect.Type]bool)
+	}
+	if seen[t] {
+		return false
+	}
+	seen[t] = true
+
+	for i := 0; i < t.NumField(); i++ {
+		ft := t.Field(i).Type
+		if _, ok := fieldKey(t.Field(i), ""); !ok {
+			continue
+		}
+		if ft == timeType || (ft.Kind() == reflect.Ptr && ft.Elem() == timeType) || hasTime(ft, seen) {
+			return true
+		}
+	}
+	return false
+}
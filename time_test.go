@@ -0,0 +1,62 @@
+package particle
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestTimeLayouts(t *testing.T) {
+	type metaData struct {
+		Name    string
+		Date    time.Time
+		Updated *time.Time
+		Event   struct {
+			Start time.Time
+		}
+	}
+
+	date := time.Date(2016, 10, 10, 0, 0, 0, 0, time.UTC)
+	updated := time.Date(2016, 10, 11, 12, 30, 0, 0, time.UTC)
+	want := metaData{Name: "John Doe", Date: date, Updated: &updated}
+	want.Event.Start = date
+
+	var runner = []struct {
+		Name     string
+		Encoding *Encoding
+		File     string
+	}{
+		{"YAML", YAMLEncoding, "---\nname: John Doe\ndate: 10-10-2016\nupdated: 2016-10-11 12:30\nevent:\n  start: 10-10-2016\n---\n\n" + wantContent},
+		{"JSON", JSONEncoding, "{\n\"name\": \"John Doe\",\n\"date\": \"10-10-2016\",\n\"updated\": \"2016-10-11T12:30:00Z\",\n\"event\": {\"start\": \"10-10-2016\"}\n}\n\n" + wantContent},
+		{"TOML", TOMLEncoding, "+++\nname = \"John Doe\"\ndate = \"10-10-2016\"\nupdated = 2016-10-11T12:30:00Z\n[event]\nstart = \"10-10-2016\"\n+++\n\n" + wantContent},
+		{"JSONCase", JSONEncoding, "{\n\"Name\": \"John Doe\",\n\"Date\": \"10-10-2016\",\n\"Updated\": \"2016-10-11T12:30:00Z\",\n\"Event\": {\"Start\": \"10-10-2016\"}\n}\n\n" + wantContent},
+		{"TOMLCase", TOMLEncoding, "+++\nName = \"John Doe\"\nDate = \"10-10-2016\"\nUpdated = 2016-10-11T12:30:00Z\n[Event]\nStart = \"10-10-2016\"\n+++\n\n" + wantContent},
+	}
+
+	for _, r := range runner {
+		e := r.Encoding.Clone(WithTimeLayouts("01-02-2006", "2006-01-02 15:04"))
+
+		have := metaData{}
+		haveContent, err := e.DecodeString(r.File, &have)
+		if err != nil {
+			t.Errorf(r.Name+": err: %s", err)
+		}
+
+		if wantContent != string(haveContent) {
+			t.Errorf(r.Name+": \nwant: %q \nhave: %q", wantContent, string(haveContent))
+		}
+
+		if !have.Date.Equal(want.Date) || have.Updated == nil || !have.Updated.Equal(*want.Updated) || !have.Event.Start.Equal(want.Event.Start) || have.Name != want.Name {
+			t.Errorf(r.Name+": \nwant: %+v \nhave: %+v", want, have)
+		}
+	}
+
+	if _, err := YAMLEncoding.DecodeString("---\ndate: 10-10-2016\n---\n\n"+wantContent, &metaData{}); err == nil {
+		t.Error("(without): want a decode error")
+	}
+
+	m := make(map[string]interface{})
+	if _, err := YAMLEncoding.Clone(WithTimeLayouts("01-02-2006")).DecodeString("---\ndate: 10-10-2016\n---\n\n"+wantContent, &m); err != nil || !reflect.DeepEqual(map[string]interface{}{"date": "10-10-2016"}, m) {
+		t.Errorf("Map: want the string left as is have: %v %v", m, err)
+	}
+}
@@ -0,0 +1,208 @@
+// Copyright 2016 Nika Jones. All rights reserved.
+// Use of this source code is governed by the MIT license.
+// license that can be found in the LICENSE file.
+
+package particle
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+var (
+	jsonMarshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	yamlMarshalerType = reflect.TypeOf((*yaml.Marshaler)(nil)).Elem()
+)
+
+// encodeKeys returns v with its struct fields and map keys renamed by the
+// encode key transform of e. Structs and maps are copied to maps of
+// interface{} values, a struct field with a name in its tag for the format
+// keeps that name.
+func (e *Encoding) encodeKeys(v interface{}) interface{} {
+	return e.keyValue(reflect.ValueOf(v))
+}
+
+func (e *Encoding) keyValue(rv reflect.Value) interface{} {
+	if !rv.IsValid() {
+		return nil
+	}
+
+	if marshalsItself(rv.Type()) {
+		return rv.Interface() // i.e. a time.Time, it has no keys to rename
+	}
+
+	switch rv.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if rv.IsNil() {
+			return nil
+		}
+		return e.keyValue(rv.Elem())
+	case reflect.Struct:
+		m := make(map[string]interface{})
+		for i := 0; i < rv.NumField(); i++ {
+			field := rv.Type().Field(i)
+			if field.PkgPath != "" {
+				continue
+			}
+
+			tag := strings.Split(field.Tag.Get(e.tag()), ",")
+			if tag[0] == "-" || (hasTagOption(tag[1:], "omitempty") && rv.Field(i).IsZero()) {
+				continue
+			}
+
+			key := tag[0]
+			if key == "" {
+				key = e.keyEncode(field.Name)
+			}
+			m[key] = e.keyValue(rv.Field(i))
+		}
+		return m
+	case reflect.Map:
+		m := make(map[string]interface{}, rv.Len())
+		for _, k := range rv.MapKeys() {
+			m[e.keyEncode(fmt.Sprint(k.Interface()))] = e.keyValue(rv.MapIndex(k))
+		}
+		return m
+	case reflect.Slice, reflect.Array:
+		if rv.Type().Elem().Kind() == reflect.Uint8 {
+			return rv.Interface() // bytes
+		}
+
+		s := make([]interface{}, rv.Len())
+		for i := range s {
+			s[i] = e.keyValue(rv.Index(i))
+		}
+		return s
+	}
+	return rv.Interface()
+}
+
+// decodeKeys renames the keys of the frontmatter metadata f with the decode
+// key transform of e, to the keys the unmarshal func of e matches to the
+// fields of v, and returns the metadata marshaled again. Keys of a struct
+// that match a name in a field tag for the format are kept as they are.
+func (e *Encoding) decodeKeys(f []byte, v interface{}) ([]byte, error) {
+	m := make(map[string]interface{})
+	if err := e.unmarshalFunc(f, &m); err != nil {
+		return nil, err
+	}
+	return e.marshalValue(e.renameKeys(m, reflect.TypeOf(v)))
+}
+
+// renameKeys returns the metadata value val, that is unmarshaled to a value
+// of type t, with the keys of its maps renamed.
+func (e *Encoding) renameKeys(val interface{}, t reflect.Type) interface{} {
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	if t != nil && marshalsItself(t) {
+		return val
+	}
+
+	if rv := reflect.ValueOf(val); rv.Kind() == reflect.Slice && rv.Type().Elem().Kind() != reflect.Uint8 {
+		var elem reflect.Type
+		if t != nil && (t.Kind() == reflect.Slice || t.Kind() == reflect.Array) {
+			elem = t.Elem()
+		}
+
+		renamed := make([]interface{}, rv.Len()) // TOML tables are a []map[string]interface{}
+		for i := range renamed {
+			renamed[i] = e.renameKeys(rv.Index(i).Interface(), elem)
+		}
+		return renamed
+	}
+
+	m, ok := stringMap(val)
+	if !ok {
+		return val
+	}
+
+	renamed := make(map[string]interface{}, len(m))
+	for k, v := range m {
+		key, kt := e.keyDecode(k), (reflect.Type)(nil)
+		switch {
+		case t == nil:
+		case t.Kind() == reflect.Struct:
+			key = k // keys that don't match a field are kept
+			if field, ok := e.keyField(t, k); ok {
+				key, _ = fieldKey(field, e.tag())
+				kt = field.Type
+			}
+		case t.Kind() == reflect.Map || t.Kind() == reflect.Interface:
+			kt = t
+			if t.Kind() == reflect.Map {
+				kt = t.Elem()
+			}
+		}
+		renamed[key] = e.renameKeys(v, kt)
+	}
+	return renamed
+}
+
+// keyField returns the field of the struct type t for the metadata key k,
+// the field with k as the name in its tag for the format, or else the field
+// without a tag name that is named the decoded key.
+func (e *Encoding) keyField(t reflect.Type, k string) (reflect.StructField, bool) {
+	name := e.keyDecode(k)
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+
+		switch tag := strings.Split(field.Tag.Get(e.tag()), ",")[0]; tag {
+		case "-":
+		case "":
+			if field.Name == name {
+				return field, true
+			}
+		default:
+			if tag == k {
+				return field, true
+			}
+		}
+	}
+	return reflect.StructField{}, false
+}
+
+// keyEncode returns the key k transformed by the encode key transform of e.
+func (e *Encoding) keyEncode(k string) string {
+	if e.keyEncodeFunc == nil {
+		return k
+	}
+	return e.keyEncodeFunc(k)
+}
+
+// keyDecode returns the key k transformed by the decode key transform of e.
+func (e *Encoding) keyDecode(k string) string {
+	if e.keyDecodeFunc == nil {
+		return k
+	}
+	return e.keyDecodeFunc(k)
+}
+
+// marshalsItself reports whether a value of type t (or a pointer to it)
+// marshals itself, so its fields are not metadata keys.
+func marshalsItself(t reflect.Type) bool {
+	for _, iface := range []reflect.Type{textMarshalerType, jsonMarshalerType, yamlMarshalerType} {
+		if t.Implements(iface) || reflect.PtrTo(t).Implements(iface) {
+			return true
+		}
+	}
+	return false
+}
+
+// hasTagOption reports whether the struct tag options hold opt.
+func hasTagOption(options []string, opt string) bool {
+	for _, o := range options {
+		if o == opt {
+			return true
+		}
+	}
+	return false
+}
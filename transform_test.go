@@ -0,0 +1,122 @@
+package particle
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"unicode"
+)
+
+// toKebab returns the Go name s in kebab-case, i.e. "FirstName" is
+// "first-name".
+func toKebab(s string) string {
+	var b strings.Builder
+	for i, r := range s {
+		if unicode.IsUpper(r) {
+			if i > 0 {
+				b.WriteByte('-')
+			}
+			r = unicode.ToLower(r)
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// fromKebab returns the kebab-case key s as a Go name, i.e. "first-name" is
+// "FirstName".
+func fromKebab(s string) string {
+	parts := strings.Split(s, "-")
+	for i, p := range parts {
+		if p != "" {
+			parts[i] = strings.ToUpper(p[:1]) + p[1:]
+		}
+	}
+	return strings.Join(parts, "")
+}
+
+type kebabLink struct {
+	LinkText string
+}
+
+type kebabMetaData struct {
+	FirstName string
+	PostTitle string `yaml:"title" toml:"title" json:"title"`
+	Draft     bool   `yaml:",omitempty"`
+	Author    struct{ DisplayName string }
+	Links     []kebabLink
+	Extra     map[string]interface{}
+}
+
+func TestKeyTransform(t *testing.T) {
+	wantMetaData := kebabMetaData{FirstName: "John", PostTitle: "example"}
+	wantMetaData.Author.DisplayName = "John Doe"
+	wantMetaData.Links = []kebabLink{{LinkText: "home"}}
+	wantMetaData.Extra = map[string]interface{}{"SiteName": "example"}
+
+	wantYAML := `---
+author:
+  display-name: John Doe
+extra:
+  site-name: example
+first-name: John
+links:
+- link-text: home
+title: example
+---
+
+` + wantContent
+
+	var runner = []struct {
+		Name     string
+		Encoding *Encoding
+	}{
+		{"YAML", YAMLEncoding.Clone(WithKeyTransform(toKebab, fromKebab))},
+		{"TOML", TOMLEncoding.Clone(WithKeyTransform(toKebab, fromKebab))},
+		{"JSON", JSONEncoding.Clone(WithKeyTransform(toKebab, fromKebab))},
+	}
+
+	for _, r := range runner {
+		haveFile, err := r.Encoding.AppendEncode(nil, []byte(wantContent), wantMetaData)
+		if err != nil {
+			t.Errorf(r.Name+"(AppendEncode): err: %s", err)
+		}
+
+		if r.Name == "YAML" && wantYAML != string(haveFile) {
+			t.Errorf(r.Name+"(AppendEncode): \nwant: %q \nhave: %q", wantYAML, string(haveFile))
+		}
+
+		if !strings.Contains(string(haveFile), "first-name") || strings.Contains(string(haveFile), "post-title") {
+			t.Errorf(r.Name+"(AppendEncode): want kebab-case keys and tags have: %q", string(haveFile))
+		}
+
+		haveMetaData := kebabMetaData{}
+		haveContent, err := r.Encoding.DecodeString(string(haveFile), &haveMetaData)
+		if err != nil {
+			t.Errorf(r.Name+"(DecodeString): err: %s", err)
+		}
+
+		if wantContent != string(haveContent) {
+			t.Errorf(r.Name+"(DecodeString): \nwant: %q \nhave: %q", wantContent, string(haveContent))
+		}
+
+		if !reflect.DeepEqual(wantMetaData, haveMetaData) {
+			t.Errorf(r.Name+"(DecodeString): \nwant: %+v \nhave: %+v", wantMetaData, haveMetaData)
+		}
+
+		haveMap := map[string]interface{}{}
+		if _, err := r.Encoding.DecodeString(string(haveFile), &haveMap); err != nil {
+			t.Errorf(r.Name+"(DecodeString map): err: %s", err)
+		}
+
+		if _, ok := haveMap["FirstName"]; !ok {
+			t.Errorf(r.Name+"(DecodeString map): want the key %q have: %v", "FirstName", haveMap)
+		}
+	}
+
+	// without the transform the struct has no kebab-case keys
+	haveMetaData := kebabMetaData{}
+	if _, err := YAMLEncoding.DecodeString(wantYAML, &haveMetaData); err != nil || haveMetaData.FirstName != "" {
+		t.Errorf("(without): want no first name have: %+v %v", haveMetaData, err)
+	}
+}
@@ -0,0 +1,119 @@
+// Copyright 2016 Nika Jones. All rights reserved.
+// Use of this source code is governed by the MIT license.
+// license that can be found in the LICENSE file.
+
+package particle
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// UpdateFile decodes the frontmatter metadata of the named file with e to a
+// map, calls update to change it, and rewrites the file with the updated
+// metadata and the content as it was. The content bytes are kept exactly,
+// they aren't trimmed even with WithTrimSpace, and a stripped byte order
+// mark is written back. The blank lines between a header block and the
+// content are kept as they were, rather than the separator of e. A file without frontmatter gets a block when update
+// adds metadata. The metadata is marshaled again, so the comments and the
+// key order of the old block aren't kept, nor are preamble lines before it.
+//
+// The file is written to a temporary file in the same directory, which is
+// renamed over it, so the file is never left half written. A symbolic link
+// is followed, and the file it points to is rewritten. The file mode is
+// kept. Nothing is written when update returns an error, or the file would
+// be the same.
+func (e *Encoding) UpdateFile(path string, update func(v map[string]interface{}) error) error {
+	path, err := filepath.EvalSymlinks(path) // write to the file a link points to, not over the link
+	if err != nil {
+		return err
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+
+	src, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	c := e.Clone()
+	c.trimSpace = false // the content is written back as it is
+
+	v := make(map[string]interface{})
+	content, err := c.DecodeReader(bytes.NewReader(src), &v)
+	if err != nil {
+		return err
+	}
+
+	if err := update(v); err != nil {
+		return err
+	}
+
+	var dst []byte
+	if c.stripBOM && bytes.HasPrefix(src, utf8BOM) {
+		dst = append(dst, utf8BOM...)
+	}
+	if dst, err = c.AppendEncode(dst, content, v); err != nil {
+		return err
+	}
+
+	// the content is at the end of both, so the separator of src replaces
+	// the one that was written before it
+	if c.position == HeaderPosition && len(content) < len(src) {
+		old, block := src[:len(src)-len(content)], dst[:len(dst)-len(content)]
+		block = block[:len(block)-len(separatorAfter(block))]
+		dst = append(append(block[:len(block):len(block)], separatorAfter(old)...), content...)
+	}
+
+	if bytes.Equal(src, dst) {
+		return nil
+	}
+	return writeFileAtomic(path, dst, info.Mode().Perm())
+}
+
+// separatorAfter returns the blank lines at the end of the frontmatter block
+// b, after the line ending of its closing delimiter.
+func separatorAfter(b []byte) []byte {
+	tail := b[len(bytes.TrimRight(b, "\r\n")):]
+	if bytes.HasPrefix(tail, []byte("\r\n")) {
+		return tail[2:]
+	}
+	if len(tail) > 0 {
+		return tail[1:]
+	}
+	return tail
+}
+
+// writeFileAtomic writes b to a temporary file next to the named file, and
+// renames it over the named file.
+func writeFileAtomic(path string, b []byte, perm os.FileMode) (err error) {
+	f, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			f.Close()
+			os.Remove(f.Name())
+		}
+	}()
+
+	if _, err = f.Write(b); err != nil {
+		return err
+	}
+	if err = f.Chmod(perm); err != nil {
+		return err
+	}
+	if err = f.Sync(); err != nil {
+		return err
+	}
+	if err = f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
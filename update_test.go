@@ -0,0 +1,97 @@
+package particle
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestUpdateFile(t *testing.T) {
+	var runner = []struct {
+		Name    string
+		File    string
+		Update  func(map[string]interface{}) error
+		WantErr bool
+		Want    string
+	}{
+		{
+			"Set", "---\ntitle: old\n---\n\n  some content  \n\n",
+			func(v map[string]interface{}) error { v["title"] = "new"; return nil },
+			false, "---\ntitle: new\n---\n\n  some content  \n\n",
+		},
+		{
+			"NoSeparator", "---\na: 1\n---\nBody\n",
+			func(v map[string]interface{}) error { v["a"] = 2; return nil },
+			false, "---\na: 2\n---\nBody\n",
+		},
+		{
+			"TwoBlankLines", "---\na: 1\n---\n\n\nBody\n",
+			func(v map[string]interface{}) error { v["a"] = 2; return nil },
+			false, "---\na: 2\n---\n\n\nBody\n",
+		},
+		{
+			"Add", "no frontmatter\n",
+			func(v map[string]interface{}) error { v["draft"] = true; return nil },
+			false, "---\ndraft: true\n---\n\nno frontmatter\n",
+		},
+		{
+			"Error", "---\ntitle: old\n---\ncontent",
+			func(v map[string]interface{}) error { v["title"] = "new"; return errors.New("no") },
+			true, "---\ntitle: old\n---\ncontent",
+		},
+	}
+
+	dir := t.TempDir()
+	for _, r := range runner {
+		path := filepath.Join(dir, r.Name+".md")
+		if err := ioutil.WriteFile(path, []byte(r.File), 0600); err != nil {
+			t.Fatal(err)
+		}
+
+		err := YAMLEncoding.Clone(WithTrimSpace()).UpdateFile(path, r.Update)
+		if r.WantErr != (err != nil) {
+			t.Errorf(r.Name+": unexpected error: %v", err)
+		}
+
+		have, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if r.Want != string(have) {
+			t.Errorf(r.Name+": \nwant: %q \nhave: %q", r.Want, string(have))
+		}
+
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want, have := os.FileMode(0600), info.Mode().Perm(); want != have {
+			t.Errorf(r.Name+"(mode): \nwant: %v \nhave: %v", want, have)
+		}
+	}
+
+	if files, _ := ioutil.ReadDir(dir); len(files) != len(runner) {
+		t.Errorf("temporary files left: %d files", len(files))
+	}
+
+	// a symbolic link is kept, and the file it points to is updated
+	target, link := filepath.Join(dir, "Set.md"), filepath.Join(dir, "link.md")
+	if err := os.Symlink(target, link); err != nil {
+		t.Skip("no symbolic links:", err)
+	}
+
+	if err := YAMLEncoding.UpdateFile(link, func(v map[string]interface{}) error { v["title"] = "linked"; return nil }); err != nil {
+		t.Errorf("Symlink: err: %s", err)
+	}
+
+	if info, err := os.Lstat(link); err != nil || info.Mode()&os.ModeSymlink == 0 {
+		t.Errorf("Symlink: want the link kept have: %v %v", info, err)
+	}
+
+	want := "---\ntitle: linked\n---\n\n  some content  \n\n"
+	if have, _ := ioutil.ReadFile(target); want != string(have) {
+		t.Errorf("Symlink: \nwant: %q \nhave: %q", want, string(have))
+	}
+}
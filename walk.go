@@ -0,0 +1,62 @@
+// Copyright 2016 Nika Jones. All rights reserved.
+// Use of this source code is governed by the MIT license.
+// license that can be found in the LICENSE file.
+
+package particle
+
+import (
+	"io/fs"
+	"path/filepath"
+	"strings"
+)
+
+// WalkFunc is the type of the function called by WalkDir for each file that
+// has frontmatter, with the decoded frontmatter metadata v and the content.
+type WalkFunc func(path string, v map[string]interface{}, content []byte) error
+
+// WalkErrors is the error returned by WalkDir when files fail to decode. Each
+// error is a *fs.PathError with the path of the file.
+type WalkErrors []error
+
+func (e WalkErrors) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// Unwrap returns the errors of the files, for errors.Is and errors.As.
+func (e WalkErrors) Unwrap() []error { return e }
+
+// WalkDir walks the file tree rooted at root in lexical order, decoding the
+// frontmatter of each regular file with e and calling fn. Files without
+// frontmatter metadata (or with an empty frontmatter block) are skipped. A
+// file that fails to decode doesn't stop the walk, the errors of all of
+// those files are returned together as WalkErrors once the walk is done. An
+// error from fn, or from reading the tree, stops the walk and is returned.
+func WalkDir(root string, e *Encoding, fn WalkFunc) error {
+	var errs WalkErrors
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || !d.Type().IsRegular() {
+			return err
+		}
+
+		v := make(map[string]interface{})
+		content, err := e.DecodeFile(path, &v)
+		if err != nil {
+			errs = append(errs, &fs.PathError{Op: "decode", Path: path, Err: err})
+			return nil
+		}
+
+		if len(v) == 0 {
+			return nil // no frontmatter
+		}
+		return fn(path, v, content)
+	})
+
+	if err == nil && len(errs) > 0 {
+		return errs
+	}
+	return err
+}
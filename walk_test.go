@@ -0,0 +1,87 @@
+package particle
+
+import (
+	"errors"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestWalkDir(t *testing.T) {
+	root := t.TempDir()
+
+	var files = map[string]string{
+		"a.md":         testCaseData["YAML"]["file"],
+		"b.md":         wantContent,
+		"posts/c.md":   "---\ntitle: nested\n---\n\n" + wantContent,
+		"posts/d.html": "---\ntitle: html\n---\n\n" + wantContent,
+	}
+
+	for name, file := range files {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := ioutil.WriteFile(path, []byte(file), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var havePaths, haveTitles []string
+	err := WalkDir(root, YAMLEncoding, func(path string, v map[string]interface{}, content []byte) error {
+		if wantContent != string(content) {
+			t.Errorf("%s: \nwant: %q \nhave: %q", path, wantContent, string(content))
+		}
+
+		rel, _ := filepath.Rel(root, path)
+		havePaths = append(havePaths, filepath.ToSlash(rel))
+		haveTitles = append(haveTitles, v["title"].(string))
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if want := []string{"a.md", "posts/c.md", "posts/d.html"}; !reflect.DeepEqual(want, havePaths) {
+		t.Errorf("\nwant: %v \nhave: %v", want, havePaths)
+	}
+
+	if want := []string{"example YAML", "nested", "html"}; !reflect.DeepEqual(want, haveTitles) {
+		t.Errorf("\nwant: %v \nhave: %v", want, haveTitles)
+	}
+
+	wantErr := errors.New("stop")
+	var haveCalls int
+	err = WalkDir(root, YAMLEncoding, func(string, map[string]interface{}, []byte) error {
+		haveCalls++
+		return wantErr
+	})
+	if err != wantErr || haveCalls != 1 {
+		t.Errorf("want: %v after %d call have: %v after %d", wantErr, 1, err, haveCalls)
+	}
+
+	// a file that fails to decode doesn't stop the walk
+	bad := filepath.Join(root, "posts/b.md")
+	if err := ioutil.WriteFile(bad, []byte("---\ntitle: [bad\n---\n\n"+wantContent), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	havePaths = nil
+	err = WalkDir(root, YAMLEncoding, func(path string, v map[string]interface{}, content []byte) error {
+		havePaths = append(havePaths, path)
+		return nil
+	})
+	if want := 3; want != len(havePaths) {
+		t.Errorf("(decode error): want: %d calls have: %d", want, len(havePaths))
+	}
+
+	var haveErrs WalkErrors
+	var havePathErr *fs.PathError
+	if !errors.As(err, &haveErrs) || len(haveErrs) != 1 || !errors.As(haveErrs[0], &havePathErr) || havePathErr.Path != bad {
+		t.Errorf("(decode error): want a WalkErrors for %s have: %v", bad, err)
+	}
+}
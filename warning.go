@@ -0,0 +1,140 @@
+// Copyright 2016 Nika Jones. All rights reserved.
+// Use of this source code is governed by the MIT license.
+// license that can be found in the LICENSE file.
+
+package particle
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// WarningCode identifies the kind of a non-fatal decode issue.
+type WarningCode int
+
+const (
+	// WarnBOMStripped is reported when a leading UTF-8 byte order mark is
+	// removed from the input (see WithStripBOM).
+	WarnBOMStripped WarningCode = iota + 1
+
+	// WarnCRLFNormalized is reported when an opening or closing delimiter
+	// line that ends with "\r\n" is read as if it ended with "\n" (see
+	// WithCRLFDelimiters).
+	WarnCRLFNormalized
+
+	// WarnUnknownKey is reported once for each top level metadata key that
+	// doesn't match a field of the struct that is decoded to. The key is
+	// ignored by the unmarshal func.
+	WarnUnknownKey
+
+	// WarnLenientFallback is reported when a leading delimited block fails
+	// to unmarshal, and is left as content (see WithLenientFallback).
+	WarnLenientFallback
+)
+
+var warningCodeNames = map[WarningCode]string{
+	WarnBOMStripped:     "bom stripped",
+	WarnCRLFNormalized:  "crlf normalized",
+	WarnUnknownKey:      "unknown key",
+	WarnLenientFallback: "lenient fallback",
+}
+
+func (c WarningCode) String() string {
+	if s, ok := warningCodeNames[c]; ok {
+		return s
+	}
+	return fmt.Sprintf("WarningCode(%d)", int(c))
+}
+
+// Warning is a non-fatal issue found while decoding. The input is still
+// decoded, a Warning only reports something that was quietly worked around.
+type Warning struct {
+	Code    WarningCode
+	Message string
+}
+
+func (w Warning) String() string {
+	return w.Code.String() + ": " + w.Message
+}
+
+// WithWarningHandler calls fn with each non-fatal issue that is found while
+// decoding (see the Warn codes). The handler is called from the goroutine
+// that decodes, which is not always the caller's goroutine when decoding from
+// a reader, so fn must be safe to call concurrently when the encoding is
+// shared.
+func WithWarningHandler(fn func(Warning)) EncodingOptionFunc {
+	return func(e *Encoding) error {
+		e.warnFunc = fn
+		return nil
+	}
+}
+
+// WithCRLFDelimiters accepts opening and closing delimiter lines that end
+// with "\r\n" (i.e. files saved on Windows) when decoding. Those lines are
+// read as if they ended with "\n", and a WarnCRLFNormalized warning is
+// reported. The metadata and the content keep their line endings.
+func WithCRLFDelimiters() EncodingOptionFunc {
+	return func(e *Encoding) error {
+		e.crlfDelimiters = true
+		return nil
+	}
+}
+
+// warn calls the warning handler of e, if there is one.
+func (e *Encoding) warn(code WarningCode, format string, args ...interface{}) {
+	if e.warnFunc != nil {
+		e.warnFunc(Warning{Code: code, Message: fmt.Sprintf(format, args...)})
+	}
+}
+
+// warnUnknownKeys reports the top level keys of the metadata f that don't
+// match a field of the struct that v points to. Keys are matched without
+// regard to case, and the fields of embedded structs count as fields of v.
+func (e *Encoding) warnUnknownKeys(f []byte, v interface{}) {
+	t := reflect.TypeOf(v)
+	if t == nil || t.Kind() != reflect.Ptr || t.Elem().Kind() != reflect.Struct {
+		return
+	}
+
+	m := make(map[string]interface{})
+	if err := e.unmarshalFunc(f, &m); err != nil {
+		return // the unmarshal func reports the error
+	}
+
+	known := make(map[string]bool)
+	fieldKeys(t.Elem(), e.tag(), known)
+
+	var unknown []string
+	for k := range m {
+		if !known[strings.ToLower(k)] {
+			unknown = append(unknown, k)
+		}
+	}
+	sort.Strings(unknown)
+
+	for _, k := range unknown {
+		e.warn(WarnUnknownKey, "key %q has no matching field in %s", k, t.Elem())
+	}
+}
+
+// fieldKeys adds the lower cased metadata keys of the fields of the struct
+// type t to keys, with the fields of embedded structs.
+func fieldKeys(t reflect.Type, tag string, keys map[string]bool) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+
+		ft := field.Type
+		if ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		if field.Anonymous && ft.Kind() == reflect.Struct {
+			fieldKeys(ft, tag, keys)
+		}
+
+		if key, ok := fieldKey(field, tag); ok {
+			keys[strings.ToLower(key)] = true
+		}
+	}
+}
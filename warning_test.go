@@ -0,0 +1,90 @@
+package particle
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type testWarningMetaData struct {
+	Title string
+}
+
+func TestWarningHandler(t *testing.T) {
+	var runner = []struct {
+		Name        string
+		Options     []EncodingOptionFunc
+		File        string
+		WantContent string
+		WantTitle   string
+		WantCodes   []WarningCode
+	}{
+		{"None", nil, "---\ntitle: Hello\n---\n\n" + wantContent, wantContent, "Hello", nil},
+		{"BOM", []EncodingOptionFunc{WithStripBOM()}, "\ufeff---\ntitle: Hello\n---\n\n" + wantContent, wantContent, "Hello", []WarningCode{WarnBOMStripped}},
+		{"CRLF", []EncodingOptionFunc{WithCRLFDelimiters()}, "---\r\ntitle: Hello\r\n---\r\n\r\nThis is a file.\r\n", "This is a file.\r\n", "Hello", []WarningCode{WarnCRLFNormalized, WarnCRLFNormalized}},
+		{"UnknownKey", nil, "---\ntitle: Hello\nauthor: John Doe\n---\n\n" + wantContent, wantContent, "Hello", []WarningCode{WarnUnknownKey}},
+		{"LenientFallback", []EncodingOptionFunc{WithLenientFallback()}, "---\ntitle: [Hello\n---\n\n" + wantContent, "---\ntitle: [Hello\n---\n\n" + wantContent, "", []WarningCode{WarnLenientFallback}},
+	}
+
+	for _, r := range runner {
+		var haveWarnings []Warning
+		e := YAMLEncoding.Clone(append(r.Options, WithWarningHandler(func(w Warning) { haveWarnings = append(haveWarnings, w) }))...)
+
+		decoders := []struct {
+			Name   string
+			Decode func(v interface{}) ([]byte, error)
+		}{
+			{"DecodeString", func(v interface{}) ([]byte, error) { return e.DecodeString(r.File, v) }},
+			{"DecodeReader", func(v interface{}) ([]byte, error) {
+				var buf bytes.Buffer
+				err := e.DecodeTo(strings.NewReader(r.File), v, &buf)
+				return buf.Bytes(), err
+			}},
+		}
+
+		for _, d := range decoders {
+			haveWarnings = nil
+
+			var haveMetaData testWarningMetaData
+			haveContent, err := d.Decode(&haveMetaData)
+			if err != nil {
+				t.Errorf(r.Name+"("+d.Name+"): err: %s", err)
+			}
+
+			if r.WantContent != string(haveContent) {
+				t.Errorf(r.Name+"("+d.Name+"): \nwant: %q \nhave: %q", r.WantContent, string(haveContent))
+			}
+
+			if r.WantTitle != haveMetaData.Title {
+				t.Errorf(r.Name+"("+d.Name+"): \nwant: %q \nhave: %q", r.WantTitle, haveMetaData.Title)
+			}
+
+			var haveCodes []WarningCode
+			for _, w := range haveWarnings {
+				if w.Message == "" {
+					t.Errorf(r.Name+"("+d.Name+"): want a message for %s", w.Code)
+				}
+				haveCodes = append(haveCodes, w.Code)
+			}
+
+			if !reflect.DeepEqual(r.WantCodes, haveCodes) {
+				t.Errorf(r.Name+"("+d.Name+"): \nwant: %v \nhave: %v", r.WantCodes, haveWarnings)
+			}
+		}
+	}
+}
+
+func TestCRLFDelimitersWithoutOption(t *testing.T) {
+	file := "---\r\ntitle: Hello\r\n---\r\n\r\nThis is a file.\r\n"
+
+	var haveMetaData testWarningMetaData
+	haveContent, err := YAMLEncoding.DecodeString(file, &haveMetaData)
+	if err != nil {
+		t.Errorf("(DecodeString): err: %s", err)
+	}
+
+	if file != string(haveContent) {
+		t.Errorf("(DecodeString): \nwant: %q \nhave: %q", file, string(haveContent))
+	}
+}